@@ -81,7 +81,7 @@ func getEnv(key, defaultValue string) string {
 }
 
 func runMigrations() error {
-	if err := DB.AutoMigrate(&model.Palette{}, &model.Theme{}, &model.User{}, &model.UserPreferences{}); err != nil {
+	if err := DB.AutoMigrate(&model.Palette{}, &model.Theme{}, &model.ThemeRevision{}, &model.User{}, &model.UserPreferences{}, &model.WallhavenCredential{}); err != nil {
 		return err
 	}
 
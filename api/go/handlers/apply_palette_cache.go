@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultApplyPaletteCacheBytes int64 = 256 << 20
+	defaultSourceCacheBytes       int64 = 256 << 20
+	headerSourceHash                    = "X-ThemeSmith-Source-Hash"
+)
+
+type cachedImage struct {
+	Data        []byte
+	ContentType string
+	Metrics     *RecolorMetrics
+}
+
+// lruCache is a size-bounded least-recently-used cache. Entries larger than the
+// whole budget are not stored. onEvict, when set, runs under the cache lock for
+// every entry dropped to make room and must not call back into the cache.
+type lruCache[V any] struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	sizeOf   func(V) int64
+	onEvict  func(key string, value V)
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+	size  int64
+}
+
+func newLRUCache[V any](maxBytes int64, sizeOf func(V) int64) *lruCache[V] {
+	return &lruCache[V]{
+		maxBytes: maxBytes,
+		sizeOf:   sizeOf,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (c *lruCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+func (c *lruCache[V]) Add(key string, value V) {
+	size := c.sizeOf(value)
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		c.size += size - entry.size
+		entry.value = value
+		entry.size = size
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, size: size})
+		c.size += size
+	}
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		entry := oldest.Value.(*lruEntry[V])
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= entry.size
+		if c.onEvict != nil {
+			c.onEvict(entry.key, entry.value)
+		}
+	}
+}
+
+func (c *lruCache[V]) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		c.size -= elem.Value.(*lruEntry[V]).size
+	}
+}
+
+func (c *lruCache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func cachedImageSize(img cachedImage) int64 {
+	return int64(len(img.Data))
+}
+
+var (
+	applyPaletteCachesOnce sync.Once
+	applyPaletteResults    *lruCache[cachedImage]
+	applyPaletteSources    *lruCache[cachedImage]
+)
+
+// Cache budgets come from APPLY_PALETTE_CACHE_BYTES and
+// APPLY_PALETTE_SOURCE_CACHE_BYTES and are fixed at first use.
+func initApplyPaletteCaches() {
+	applyPaletteCachesOnce.Do(func() {
+		applyPaletteResults = newLRUCache(envInt64("APPLY_PALETTE_CACHE_BYTES", defaultApplyPaletteCacheBytes), cachedImageSize)
+		applyPaletteSources = newLRUCache(envInt64("APPLY_PALETTE_SOURCE_CACHE_BYTES", defaultSourceCacheBytes), cachedImageSize)
+	})
+}
+
+func applyPaletteResultCache() *lruCache[cachedImage] {
+	initApplyPaletteCaches()
+	return applyPaletteResults
+}
+
+func applyPaletteSourceCache() *lruCache[cachedImage] {
+	initApplyPaletteCaches()
+	return applyPaletteSources
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func storeSourceImage(data []byte) string {
+	hash := hashBytes(data)
+	applyPaletteSourceCache().Add(hash, cachedImage{Data: data})
+	return hash
+}
+
+// cacheKey identifies a recolor result by the source image hash and every
+// parameter that affects the output pixels or encoding. Metrics are left out
+// because they do not change the image.
+func (p applyPaletteParams) cacheKey(sourceHash string) string {
+	var b strings.Builder
+	b.WriteString("v1\n")
+	b.WriteString(sourceHash)
+	b.WriteString("\npalette=")
+	for i, c := range p.Palette {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "#%02X%02X%02X", c.R, c.G, c.B)
+	}
+	fmt.Fprintf(&b, "\nluminosity=%g\nnearest=%d\npower=%g\nmaxDistanceSq=%g", p.Luminosity, min(p.Nearest, len(p.Palette)), p.Power, p.MaxDistanceSq)
+	fmt.Fprintf(&b, "\nresize=%dx%d/%s", p.Resize.Width, p.Resize.Height, p.Resize.Fit)
+	fmt.Fprintf(&b, "\noutput=%s/%d/%t", p.Output.Format, p.Output.Quality, p.Output.StripMetadata)
+
+	return hashBytes([]byte(b.String()))
+}
+
+func quoteETag(key string) string {
+	return `"` + key + `"`
+}
+
+func etagMatches(ifNoneMatch string, key string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == quoteETag(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache(10, cachedImageSize)
+
+	cache.Add("a", cachedImage{Data: make([]byte, 4)})
+	cache.Add("b", cachedImage{Data: make([]byte, 4)})
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Add("c", cachedImage{Data: make([]byte, 4)})
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+
+	cache.Add("huge", cachedImage{Data: make([]byte, 11)})
+	_, ok = cache.Get("huge")
+	assert.False(t, ok, "entries larger than the budget are skipped")
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Add("a", cachedImage{Data: make([]byte, 8)})
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestApplyPaletteCacheKey(t *testing.T) {
+	base := applyPaletteParams{
+		Palette:    []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}},
+		Luminosity: 1,
+		Nearest:    30,
+		Power:      4,
+		Resize:     ResizeOptions{Fit: ResizeFitCover},
+		Output:     OutputOptions{Format: OutputFormatPNG, Quality: 92, StripMetadata: true},
+	}
+
+	key := base.cacheKey("source")
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, base.cacheKey("source"))
+	assert.NotEqual(t, key, base.cacheKey("other-source"))
+
+	withMetrics := base
+	withMetrics.Metrics = RecolorMetricsMultipart
+	assert.Equal(t, key, withMetrics.cacheKey("source"))
+
+	// Asking for more neighbours than there are palette colors is equivalent.
+	moreNeighbours := base
+	moreNeighbours.Nearest = 2
+	assert.Equal(t, key, moreNeighbours.cacheKey("source"))
+
+	otherPower := base
+	otherPower.Power = 2
+	assert.NotEqual(t, key, otherPower.cacheKey("source"))
+
+	reordered := base
+	reordered.Palette = []color.RGBA{{0, 0, 255, 255}, {255, 0, 0, 255}}
+	assert.NotEqual(t, key, reordered.cacheKey("source"))
+}
+
+func TestETagMatches(t *testing.T) {
+	assert.True(t, etagMatches(`"abc"`, "abc"))
+	assert.True(t, etagMatches(`"x", W/"abc"`, "abc"))
+	assert.True(t, etagMatches("*", "abc"))
+	assert.False(t, etagMatches(`"abcd"`, "abc"))
+	assert.False(t, etagMatches("", "abc"))
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Themes, palettes and preferences carry a version that increases on every
+// content change. Reads return it as a version field and, for single
+// resources, as an ETag; updates must name it in If-Match so that two clients
+// editing the same row cannot silently overwrite each other.
+
+// errStaleVersion reports that If-Match named a version other than the
+// current one.
+var errStaleVersion = errors.New("stale version")
+
+var errIfMatchRequired = &statusError{Status: http.StatusPreconditionRequired, Message: "If-Match header is required"}
+
+func versionETag(version int) string {
+	return quoteETag(strconv.Itoa(version))
+}
+
+// requireIfMatch returns the If-Match header, or errIfMatchRequired when it is
+// missing.
+func requireIfMatch(c *gin.Context) (string, error) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" {
+		return "", errIfMatchRequired
+	}
+	return ifMatch, nil
+}
+
+// ifMatchVersion reports whether an If-Match header names version. "*"
+// matches any version.
+func ifMatchVersion(ifMatch string, version int) bool {
+	return etagMatches(ifMatch, strconv.Itoa(version))
+}
+
+// respondStaleVersion answers 412 with the server copy under key, so the
+// client can merge and retry with the current ETag.
+func respondStaleVersion(c *gin.Context, version int, key string, current any) {
+	respondCurrentVersion(c, http.StatusPreconditionFailed, "the resource was modified since it was read", version, key, current)
+}
+
+// respondIfMatchRequired answers 428 like respondStaleVersion, for a client
+// that saves without having read the resource and so has no ETag to send.
+func respondIfMatchRequired(c *gin.Context, version int, key string, current any) {
+	respondCurrentVersion(c, errIfMatchRequired.Status, errIfMatchRequired.Message, version, key, current)
+}
+
+func respondCurrentVersion(c *gin.Context, status int, message string, version int, key string, current any) {
+	c.Header("ETag", versionETag(version))
+	c.JSON(status, gin.H{
+		"error":   message,
+		"version": version,
+		key:       current,
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	assert.True(t, ifMatchVersion(`"3"`, 3))
+	assert.True(t, ifMatchVersion(`W/"3"`, 3))
+	assert.True(t, ifMatchVersion(`"1", "3"`, 3))
+	assert.True(t, ifMatchVersion("*", 3))
+	assert.False(t, ifMatchVersion(`"2"`, 3))
+	assert.False(t, ifMatchVersion("3", 3))
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPut, "/themes/1", nil)
+
+	_, err := requireIfMatch(c)
+	assert.Equal(t, errIfMatchRequired, err)
+
+	c.Request.Header.Set("If-Match", ` "4" `)
+	ifMatch, err := requireIfMatch(c)
+	require.NoError(t, err)
+	assert.Equal(t, `"4"`, ifMatch)
+}
+
+func TestRespondStaleVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	respondStaleVersion(c, 5, "theme", map[string]any{"name": "Current"})
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.EqualValues(t, 5, body["version"])
+	assert.Equal(t, map[string]any{"name": "Current"}, body["theme"])
+}
+
+func TestRespondIfMatchRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	respondIfMatchRequired(c, 2, "preferences", map[string]any{"theme": "light"})
+
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "If-Match header is required", body["error"])
+	assert.EqualValues(t, 2, body["version"])
+	assert.Equal(t, map[string]any{"theme": "light"}, body["preferences"])
+}
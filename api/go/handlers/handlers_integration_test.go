@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,6 +15,7 @@ import (
 	authpkg "themesmith/auth"
 	"themesmith/db"
 	"themesmith/model"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -109,6 +111,7 @@ func setupPaletteRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.POST("/palettes", SavePaletteHandler)
+	router.PUT("/palettes/:id", UpdatePaletteHandler)
 	router.GET("/palettes", GetPalettesHandler)
 	router.DELETE("/palettes", DeletePalettesBatchHandler)
 	return router
@@ -118,9 +121,34 @@ func setupThemeRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.POST("/themes/batch", SaveThemesBatchHandler)
+	router.POST("/themes/import", ImportThemesHandler)
+	router.POST("/themes/diff", DiffThemesHandler)
 	router.POST("/themes", SaveThemeHandler)
 	router.POST("/themes/:id/share", ShareThemeHandler)
 	router.DELETE("/themes/:id/share", UnshareThemeHandler)
+	router.GET("/themes/vsix", ThemesVSIXHandler)
+	router.GET("/themes/:id/vsix", ThemeVSIXHandler)
+	router.GET("/themes/zed-extension", ThemesZedExtensionHandler)
+	router.GET("/themes/:id/zed-extension", ThemeZedExtensionHandler)
+	router.GET("/themes/jetbrains", ThemesJetBrainsHandler)
+	router.GET("/themes/:id/jetbrains", ThemeJetBrainsHandler)
+	router.GET("/themes/:id/neovim", ThemeNeovimHandler)
+	router.GET("/themes/:id/vim", ThemeVimHandler)
+	router.GET("/themes/:id/helix", ThemeHelixHandler)
+	router.GET("/themes/:id/sublime", ThemeSublimeHandler)
+	router.GET("/themes/:id/emacs", ThemeEmacsHandler)
+	router.GET("/themes/:id/terminal", ThemeTerminalHandler)
+	router.GET("/themes/:id/kde", ThemeKDEHandler)
+	router.GET("/themes/:id/gtk", ThemeGTKHandler)
+	router.GET("/themes/:id/xresources", ThemeXresourcesHandler)
+	router.GET("/themes/:id/base16", ThemeBase16Handler)
+	router.GET("/themes/:id/base24", ThemeBase24Handler)
+	router.GET("/themes/:id/pywal", ThemePywalHandler)
+	router.GET("/themes/:id/revisions", ListThemeRevisionsHandler)
+	router.GET("/themes/:id/revisions/diff", DiffThemeRevisionsHandler)
+	router.GET("/themes/:id/revisions/:revision", GetThemeRevisionHandler)
+	router.POST("/themes/:id/revisions/:revision/revert", RevertThemeRevisionHandler)
+	router.POST("/themes/:id/convert", ConvertThemeHandler)
 	router.PUT("/themes/:id", UpdateThemeHandler)
 	router.GET("/themes", GetThemesHandler)
 	router.DELETE("/themes/:id", DeleteThemeHandler)
@@ -197,6 +225,7 @@ func setupSharedRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.GET("/shared-items", GetSharedItemsHandler)
+	router.POST("/shared-items/:kind/:id/fork", ForkSharedItemHandler)
 	return router
 }
 
@@ -486,11 +515,13 @@ func TestUpdateThemeHandler_UpdatesPayload(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/themes/"+fmt.Sprintf("%d", saved.ID), bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
 
 	var updated model.Theme
 	if err := db.DB.First(&updated, saved.ID).Error; err != nil {
@@ -498,6 +529,124 @@ func TestUpdateThemeHandler_UpdatesPayload(t *testing.T) {
 	}
 	assert.Equal(t, "Theme Updated", updated.Name)
 	assert.Equal(t, "sig-2", updated.Signature)
+	assert.Equal(t, 2, updated.Version)
+}
+
+func TestUpdateThemeHandler_RejectsStaleVersion(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	saved, _, err := saveUserTheme(user.ID, "Theme", "vscode", "sig-1", `{"name":"Theme"}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	router := setupThemeRouter()
+	update := func(name string, ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(buildThemePayload(name, "vscode", "sig-1"))
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/themes/%d", saved.ID), bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update("No Precondition", "")
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	w = update("First Device", `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = update("Second Device", `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var resp struct {
+		Version int            `json:"version"`
+		Theme   map[string]any `json:"theme"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, 2, resp.Version)
+	assert.Equal(t, "First Device", resp.Theme["name"])
+	assert.EqualValues(t, 2, resp.Theme["version"])
+
+	var current model.Theme
+	if err := db.DB.First(&current, saved.ID).Error; err != nil {
+		t.Fatalf("load theme: %v", err)
+	}
+	assert.Equal(t, "First Device", current.Name)
+}
+
+func TestUpdateThemeHandler_UnchangedRoundTrip(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	router := setupThemeRouter()
+	do := func(method string, path string, body []byte, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	body, _ := json.Marshal(buildThemePayload("Theme", "vscode", "sig-1"))
+	w := do("POST", "/themes", body, "")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = do("GET", "/themes", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Themes []json.RawMessage `json:"themes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode themes: %v", err)
+	}
+	if !assert.Len(t, list.Themes, 1) {
+		return
+	}
+	var loaded struct {
+		ID      string `json:"id"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(list.Themes[0], &loaded); err != nil {
+		t.Fatalf("decode theme: %v", err)
+	}
+
+	// The client sends back exactly what it loaded, row keys included.
+	w = do("PUT", "/themes/"+loaded.ID+"?strict=true", list.Themes[0], fmt.Sprintf(`"%d"`, loaded.Version))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, fmt.Sprintf(`"%d"`, loaded.Version), w.Header().Get("ETag"))
+
+	var stored model.Theme
+	if err := db.DB.First(&stored, loaded.ID).Error; err != nil {
+		t.Fatalf("load theme: %v", err)
+	}
+	assert.Equal(t, loaded.Version, stored.Version)
+	assert.NotContains(t, stored.JsonData, `"version"`)
+	assert.NotContains(t, stored.JsonData, `"createdAt"`)
+
+	var revisions int64
+	db.DB.Model(&model.ThemeRevision{}).Where("theme_id = ?", stored.ID).Count(&revisions)
+	assert.Equal(t, int64(0), revisions)
 }
 
 func TestDeleteThemeHandler_RemovesTheme(t *testing.T) {
@@ -1149,16 +1298,19 @@ func TestSavePreferencesHandler_UpdateExisting(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/auth/preferences", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
 
 	var resp PreferencesResponse
 	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 		t.Fatalf("decode response: %v", err)
 	}
+	assert.Equal(t, 2, resp.Version)
 
 	var savedPrefs map[string]any
 	if err := json.Unmarshal(resp.Preferences, &savedPrefs); err != nil {
@@ -1168,6 +1320,105 @@ func TestSavePreferencesHandler_UpdateExisting(t *testing.T) {
 	assert.Equal(t, "es", savedPrefs["language"])
 }
 
+func TestSavePreferencesHandler_RejectsStaleVersion(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	prefs := model.UserPreferences{UserID: user.ID, JsonData: `{"theme":"light"}`, Version: 3}
+	if err := db.DB.Create(&prefs).Error; err != nil {
+		t.Fatalf("create preferences: %v", err)
+	}
+
+	router := setupPreferencesRouter()
+	save := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/auth/preferences", strings.NewReader(`{"theme":"dark"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest("GET", "/auth/preferences", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	// Both a missing and an old If-Match return the server copy.
+	for _, tc := range []struct {
+		ifMatch string
+		status  int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{`"2"`, http.StatusPreconditionFailed},
+	} {
+		w = save(tc.ifMatch)
+		assert.Equal(t, tc.status, w.Code)
+		var resp PreferencesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		assert.Equal(t, 3, resp.Version)
+		assert.JSONEq(t, `{"theme":"light"}`, string(resp.Preferences))
+	}
+
+	w = save(`"3"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+}
+
+func TestSavePreferencesHandler_FirstSaveRace(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	// Another device's first save is inserted but not yet committed, so the
+	// handler finds no row to lock and its own insert waits on this one.
+	other := db.DB.Begin()
+	if err := other.Create(&model.UserPreferences{UserID: user.ID, JsonData: `{"theme":"light"}`}).Error; err != nil {
+		other.Rollback()
+		t.Fatalf("create preferences: %v", err)
+	}
+
+	router := setupPreferencesRouter()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest("PUT", "/auth/preferences", strings.NewReader(`{"theme":"dark"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		done <- w
+	}()
+	time.Sleep(500 * time.Millisecond)
+	if err := other.Commit().Error; err != nil {
+		t.Fatalf("commit preferences: %v", err)
+	}
+
+	w := <-done
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body.String())
+	var resp PreferencesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, 1, resp.Version)
+	assert.JSONEq(t, `{"theme":"light"}`, string(resp.Preferences))
+}
+
 func TestGetPreferencesHandler_ReturnsExisting(t *testing.T) {
 	setupTestDB(t)
 	resetTestDB(t)
@@ -1254,6 +1505,56 @@ func TestSavePaletteHandler_InvalidJSON(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestUpdatePaletteHandler_RequiresCurrentVersion(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	if err := saveUserPalette(user.ID, "Palette", []model.Color{{Hex: "#112233"}}); err != nil {
+		t.Fatalf("save palette: %v", err)
+	}
+	var saved model.Palette
+	if err := db.DB.Where("user_id = ?", user.ID).First(&saved).Error; err != nil {
+		t.Fatalf("load palette: %v", err)
+	}
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupPaletteRouter()
+	update := func(name string, ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(SavePaletteRequest{Name: name, Palette: []model.Color{{Hex: "#445566"}}})
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/palettes/%d", saved.ID), bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusPreconditionRequired, update("Renamed", "").Code)
+
+	w := update("Renamed", `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = update("Stale", `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	var resp struct {
+		Palette PaletteData `json:"palette"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, "Renamed", resp.Palette.Name)
+	assert.Equal(t, 2, resp.Palette.Version)
+	assert.Equal(t, []model.Color{{Hex: "#445566"}}, resp.Palette.Palette)
+}
+
 func TestSaveThemeHandler_InvalidJSON(t *testing.T) {
 	setupTestDB(t)
 	resetTestDB(t)
@@ -1297,6 +1598,7 @@ func TestUpdateThemeHandler_NotFound(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/themes/99999", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", "*")
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
@@ -1423,3 +1725,751 @@ func TestGetSharedItemsHandler_ReturnsSharedPalettesAndThemes(t *testing.T) {
 	assert.Equal(t, "Shared Theme", resp.Items[1].Name)
 	assert.Equal(t, SharedItemKindTheme, resp.Items[1].Kind)
 }
+
+func TestForkSharedItemHandler_CopiesThemesAndPalettes(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	forker := createTestUser(t)
+	owner := model.User{Name: "Fork Owner", Email: "fork-owner@example.com", PasswordHash: "hash"}
+	if err := db.DB.Create(&owner).Error; err != nil {
+		t.Fatalf("create owner: %v", err)
+	}
+	theme, _, err := saveUserTheme(owner.ID, "Community", "vscode", "sig-fork", `{"name":"Community","themeResult":{"theme":{"name":"Community"},"colors":[{"hex":"#AABBCC"}]}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	if _, err := setThemeShared(owner.ID, fmt.Sprintf("%d", theme.ID), true); err != nil {
+		t.Fatalf("share theme: %v", err)
+	}
+	if err := saveUserPalette(owner.ID, "Community Palette", []model.Color{{Hex: "#112233"}}); err != nil {
+		t.Fatalf("save palette: %v", err)
+	}
+	var palette model.Palette
+	if err := db.DB.Where("user_id = ?", owner.ID).First(&palette).Error; err != nil {
+		t.Fatalf("load palette: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(forker)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	router := setupSharedRouter()
+	fork := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := fork(fmt.Sprintf("/shared-items/theme/theme:%d/fork", theme.ID))
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var themeResp struct {
+		Theme map[string]any `json:"theme"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &themeResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, "Community", themeResp.Theme["name"])
+	assert.Equal(t, fmt.Sprintf("theme:%d", theme.ID), themeResp.Theme["forkedFromId"])
+	assert.EqualValues(t, owner.ID, themeResp.Theme["forkedFromUserId"])
+
+	w = fork(fmt.Sprintf("/shared-items/theme/%d/fork", theme.ID))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The palette is not shared yet.
+	w = fork(fmt.Sprintf("/shared-items/palette/%d/fork", palette.ID))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	if _, err := setPaletteShared(owner.ID, fmt.Sprintf("%d", palette.ID), true); err != nil {
+		t.Fatalf("share palette: %v", err)
+	}
+	w = fork(fmt.Sprintf("/shared-items/palette/%d/fork", palette.ID))
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var paletteResp struct {
+		Palette PaletteData `json:"palette"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &paletteResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, []model.Color{{Hex: "#112233"}}, paletteResp.Palette.Palette)
+	assert.Equal(t, fmt.Sprintf("palette:%d", palette.ID), paletteResp.Palette.ForkedFromID)
+	if assert.NotNil(t, paletteResp.Palette.ForkedFromUserID) {
+		assert.Equal(t, owner.ID, *paletteResp.Palette.ForkedFromUserID)
+	}
+
+	var original model.Theme
+	if err := db.DB.First(&original, theme.ID).Error; err != nil {
+		t.Fatalf("load theme: %v", err)
+	}
+	assert.Equal(t, 1, original.ForkCount)
+	if err := db.DB.First(&palette, palette.ID).Error; err != nil {
+		t.Fatalf("load palette: %v", err)
+	}
+	assert.Equal(t, 1, palette.ForkCount)
+
+	// Shared forks report their origin in the same form as the fork response.
+	if _, err := setThemeShared(forker.ID, themeResp.Theme["id"].(string), true); err != nil {
+		t.Fatalf("share forked theme: %v", err)
+	}
+	if _, err := setPaletteShared(forker.ID, paletteResp.Palette.ID, true); err != nil {
+		t.Fatalf("share forked palette: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/shared-items?sort=name", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var shared SharedItemsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &shared); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	items := map[string]SharedItem{}
+	for _, item := range shared.Items {
+		items[item.ID] = item
+	}
+	assert.Len(t, items, 4)
+	assert.Equal(t, 1, items[fmt.Sprintf("theme:%d", theme.ID)].ForkCount)
+	assert.Equal(t, 1, items[fmt.Sprintf("palette:%d", palette.ID)].ForkCount)
+	assert.Equal(t, themeResp.Theme["forkedFromId"], items["theme:"+themeResp.Theme["id"].(string)].ForkedFromID)
+	assert.Equal(t, paletteResp.Palette.ForkedFromID, items["palette:"+paletteResp.Palette.ID].ForkedFromID)
+}
+
+func setupWallhavenKeyRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authGroup := router.Group("/auth")
+	authGroup.Use(authpkg.AuthMiddleware())
+	authGroup.GET("/wallhaven-key", GetWallhavenKeyHandler)
+	authGroup.PUT("/wallhaven-key", SetWallhavenKeyHandler)
+	authGroup.POST("/wallhaven-key/test", VerifyWallhavenKeyHandler)
+	authGroup.DELETE("/wallhaven-key", DeleteWallhavenKeyHandler)
+	router.GET("/wallhaven/search", WallhavenSearchHandler)
+	return router
+}
+
+func TestWallhavenKeyHandlers_StoreInjectAndClear(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+	useTestWallhavenCache(t)
+
+	t.Setenv("WALLHAVEN_KEY_SECRET", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+
+	var seenKeys []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKeys = append(seenKeys, r.Header.Get("X-API-Key"))
+		if r.URL.Path == "/settings" && r.Header.Get("X-API-Key") != "stored-key-1234" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer upstream.Close()
+	t.Setenv("WALLHAVEN_API_BASE", upstream.URL)
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupWallhavenKeyRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("PUT", "/auth/wallhaven-key", `{"apiKey":"stored-key-1234"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"keyHint":"1234"`)
+	assert.NotContains(t, w.Body.String(), "stored-key")
+
+	var credential model.WallhavenCredential
+	if err := db.DB.Where("user_id = ?", user.ID).First(&credential).Error; err != nil {
+		t.Fatalf("load credential: %v", err)
+	}
+	assert.NotContains(t, credential.EncryptedKey, "stored-key-1234")
+
+	w = do("POST", "/auth/wallhaven-key/test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"valid":true}`, w.Body.String())
+
+	w = do("POST", "/auth/wallhaven-key/test", `{"apiKey":"other"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"valid":false}`, w.Body.String())
+
+	w = do("GET", "/wallhaven/search?q=cats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "stored-key-1234", seenKeys[len(seenKeys)-1])
+
+	w = do("DELETE", "/auth/wallhaven-key", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("GET", "/auth/wallhaven-key", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"configured":false}`, w.Body.String())
+
+	w = do("POST", "/auth/wallhaven-key/test", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSetWallhavenKeyHandler_RequiresServerSecret(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+	t.Setenv("WALLHAVEN_KEY_SECRET", "")
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/auth/wallhaven-key", strings.NewReader(`{"apiKey":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	setupWallhavenKeyRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestThemeRevisions_SnapshotDiffAndRevert(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	saved, _, err := saveUserTheme(user.ID, "Theme", "vscode", "sig-rev", `{"name":"Theme","themeResult":{"theme":{"colors":{"editor.background":"#000000"}}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	if _, err := updateUserTheme(user.ID, fmt.Sprintf("%d", saved.ID), "*", "Theme v2", "vscode", "sig-rev", `{"name":"Theme v2","themeResult":{"theme":{"colors":{"editor.background":"#111111","editor.foreground":"#ffffff"}}}}`); err != nil {
+		t.Fatalf("update theme: %v", err)
+	}
+	// Saving the same payload again records no revision.
+	if _, _, err := saveUserTheme(user.ID, "Theme v2", "vscode", "sig-rev", `{"themeResult":{"theme":{"colors":{"editor.foreground":"#ffffff","editor.background":"#111111"}}},"name":"Theme v2"}`); err != nil {
+		t.Fatalf("resave theme: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	do := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	base := fmt.Sprintf("/themes/%d/revisions", saved.ID)
+
+	w := do("GET", base)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Revisions []ThemeRevisionSummary `json:"revisions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode revisions: %v", err)
+	}
+	if assert.Len(t, list.Revisions, 1) {
+		assert.Equal(t, 1, list.Revisions[0].Revision)
+		assert.Equal(t, "Theme", list.Revisions[0].Name)
+	}
+
+	w = do("GET", base+"/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"#000000"`)
+
+	w = do("GET", base+"/diff?from=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff ThemeRevisionDiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	assert.Equal(t, []ThemeDiffChange{
+		{Key: "/name", Change: "changed", Old: "Theme", New: "Theme v2"},
+		{Key: "/themeResult/theme/colors/editor.background", Change: "changed", Old: "#000000", New: "#111111"},
+		{Key: "/themeResult/theme/colors/editor.foreground", Change: "added", New: "#ffffff"},
+	}, diff.Changes)
+
+	revert := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", base+"/1/revert", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusPreconditionRequired, revert("").Code)
+	w = revert(`"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = revert(`"2"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	var reverted model.Theme
+	if err := db.DB.First(&reverted, saved.ID).Error; err != nil {
+		t.Fatalf("load theme: %v", err)
+	}
+	assert.Equal(t, "Theme", reverted.Name)
+
+	var count int64
+	db.DB.Model(&model.ThemeRevision{}).Where("theme_id = ?", saved.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	assert.Equal(t, http.StatusNotFound, do("GET", base+"/9").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", base+"/abc").Code)
+}
+
+func TestThemeRevisions_RespectsUserLimit(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	limit := 2
+	if err := db.DB.Model(&user).Update("theme_revision_limit", limit).Error; err != nil {
+		t.Fatalf("set limit: %v", err)
+	}
+
+	saved, _, err := saveUserTheme(user.ID, "Theme", "zed", "sig-limit", `{"name":"Theme"}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	for i := range 4 {
+		if _, _, err := saveUserTheme(user.ID, fmt.Sprintf("Theme %d", i), "zed", "sig-limit", `{"name":"Theme"}`); err != nil {
+			t.Fatalf("resave theme: %v", err)
+		}
+	}
+
+	var revisions []model.ThemeRevision
+	if err := db.DB.Where("theme_id = ?", saved.ID).Order("revision").Find(&revisions).Error; err != nil {
+		t.Fatalf("load revisions: %v", err)
+	}
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 3, revisions[0].Revision)
+		assert.Equal(t, 4, revisions[1].Revision)
+		assert.Equal(t, "Theme 2", revisions[1].Name)
+	}
+}
+
+func TestThemeVSIXHandler_SharedOwnedAndPrivate(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	private, _, err := saveUserTheme(user.ID, "Private", "vscode", "sig-private", `{"name":"Private","themeResult":{"theme":{"name":"Private","type":"dark"}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	shared, _, err := saveUserTheme(user.ID, "Shared", "vscode", "sig-shared", `{"name":"Shared","themeResult":{"theme":{"name":"Shared","type":"light"}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	if _, err := setThemeShared(user.ID, fmt.Sprintf("%d", shared.ID), true); err != nil {
+		t.Fatalf("share theme: %v", err)
+	}
+	zed, _, err := saveUserTheme(user.ID, "Zed", "zed", "sig-zed", `{"name":"Zed","themeResult":{"theme":{"name":"Zed","themes":[]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	get := func(path string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(fmt.Sprintf("/themes/%d/vsix", shared.ID), false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vsix", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "themesmith-shared-")
+
+	assert.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/themes/%d/vsix", private.ID), false).Code)
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/themes/%d/vsix", private.ID), true).Code)
+	assert.Equal(t, http.StatusBadRequest, get(fmt.Sprintf("/themes/%d/vsix", zed.ID), true).Code)
+
+	w = get(fmt.Sprintf("/themes/vsix?ids=%d,%d", private.ID, shared.ID), true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusBadRequest, get("/themes/vsix", true).Code)
+}
+
+func TestThemeZedExtensionHandler_BundlesFamilies(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	first, _, err := saveUserTheme(user.ID, "Dusk", "zed", "sig-zed-1", `{"name":"Dusk","themeResult":{"theme":{"name":"Dusk","themes":[{"name":"Dusk","appearance":"dark","style":{}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	second, _, err := saveUserTheme(user.ID, "Dawn", "zed", "sig-zed-2", `{"name":"Dawn","themeResult":{"theme":{"name":"Dawn","themes":[{"name":"Dusk","appearance":"light","style":{}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/themes/zed-extension?ids=%d&ids=%d", first.ID, second.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	entries := readZipEntries(t, w.Body.Bytes())
+	manifest := string(entries["themesmith-collection-dusk/extension.toml"])
+	assert.Contains(t, manifest, `authors = ["Test User"]`)
+	assert.Contains(t, manifest, `name = "Dusk and 1 more"`)
+
+	var family map[string]any
+	if err := json.Unmarshal(entries["themesmith-collection-dusk/themes/dusk.json"], &family); err != nil {
+		t.Fatalf("decode family: %v", err)
+	}
+	variants, _ := family["themes"].([]any)
+	if assert.Len(t, variants, 2) {
+		assert.Equal(t, "Dusk (2)", variants[1].(map[string]any)["name"])
+	}
+}
+
+func TestConvertThemeHandler_SavesConvertedCopy(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	source, _, err := saveUserTheme(user.ID, "Dusk", "vscode", "sig-convert-1", `{"name":"Dusk","editorType":"vscode","themeResult":{"theme":{"name":"Dusk","type":"dark","colors":{"editor.background":"#101010"},"tokenColors":[{"scope":"keyword","settings":{"foreground":"#ff0000"}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	convert := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/themes/%d/convert?%s", source.ID, query), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, convert("to=emacs").Code)
+	assert.Equal(t, http.StatusBadRequest, convert("to=vscode").Code)
+
+	w := convert("to=zed")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Theme map[string]any `json:"theme"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, "Dusk (Zed)", response.Theme["name"])
+	assert.Equal(t, "zed", response.Theme["editorType"])
+	assert.NotEqual(t, "sig-convert-1", response.Theme["signature"])
+
+	var count int64
+	db.DB.Model(&model.Theme{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	assert.Equal(t, http.StatusOK, convert("to=zed").Code)
+}
+
+func TestImportThemesHandler_JSONCAndZedFamily(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	files := map[string]string{
+		"dusk.json":    `{"name": "Dusk", /* comment */ "colors": {"editor.background": "#101010",}, "tokenColors": [],}`,
+		"seasons.json": `{"name": "Seasons", "themes": [{"name": "Winter", "appearance": "dark", "style": {"background": "#000000"}}, {"name": "Summer", "appearance": "light", "style": {"background": "#ffffff"}}]}`,
+		"notes.txt":    `not a theme`,
+	}
+	for _, name := range []string{"dusk.json", "seasons.json", "notes.txt"} {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write([]byte(files[name]))
+	}
+	writer.Close()
+
+	router := setupThemeRouter()
+	req := httptest.NewRequest("POST", "/themes/import", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Themes []map[string]any   `json:"themes"`
+		Errors []ThemeImportIssue `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if assert.Len(t, response.Themes, 3) {
+		assert.Equal(t, "Dusk", response.Themes[0]["name"])
+		assert.Equal(t, "zed", response.Themes[1]["editorType"])
+	}
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "notes.txt", response.Errors[0].Source)
+	}
+
+	req = httptest.NewRequest("POST", "/themes/import", strings.NewReader(`{"foo": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestThemeJetBrainsHandler_Formats(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	theme, _, err := saveUserTheme(user.ID, "Dusk", "vscode", "sig-jetbrains-1", `{"name":"Dusk","themeResult":{"theme":{"name":"Dusk","type":"dark","colors":{"editor.background":"#101010"}},"themeOverrides":{"c6":"#ff00ff"}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(fmt.Sprintf("/themes/%d/jetbrains", theme.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/java-archive", w.Header().Get("Content-Type"))
+	assert.Contains(t, readZipEntries(t, w.Body.Bytes()), "META-INF/plugin.xml")
+
+	w = get(fmt.Sprintf("/themes/%d/jetbrains?format=icls", theme.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<option name="FOREGROUND" value="ff00ff" />`)
+
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/themes/%d/jetbrains?format=theme", theme.ID)).Code)
+	assert.Equal(t, http.StatusBadRequest, get(fmt.Sprintf("/themes/%d/jetbrains?format=jar", theme.ID)).Code)
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/themes/jetbrains?ids=%d", theme.ID)).Code)
+}
+
+func TestThemeVimHandlers_RenderColorschemes(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	theme, _, err := saveUserTheme(user.ID, "Dusk Theme", "zed", "sig-vim-1", `{"name":"Dusk Theme","themeResult":{"theme":{"name":"Dusk","themes":[{"name":"Dusk","appearance":"dark","style":{"background":"#101010","text":"#eeeeee"}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	db.DB.Model(&theme).Update("is_shared", true)
+
+	router := setupThemeRouter()
+	for path, want := range map[string]string{
+		fmt.Sprintf("/themes/%d/neovim", theme.ID):  `vim.g.colors_name = "dusk-theme"`,
+		fmt.Sprintf("/themes/%d/vim", theme.ID):     "let g:colors_name = 'dusk-theme'",
+		fmt.Sprintf("/themes/%d/helix", theme.ID):   `background = "#101010"`,
+		fmt.Sprintf("/themes/%d/sublime", theme.ID): `"background": "#101010"`,
+		fmt.Sprintf("/themes/%d/emacs", theme.ID):   "(deftheme dusk-theme ",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Body.String(), want)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "filename=dusk-theme")
+	}
+}
+
+func TestTerminalHandlers_ThemeAndPalette(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	theme, _, err := saveUserTheme(user.ID, "Dusk Theme", "zed", "sig-terminal-1", `{"name":"Dusk Theme","themeResult":{"theme":{"name":"Dusk","themes":[{"name":"Dusk","appearance":"dark","style":{"background":"#101010","text":"#eeeeee"}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	if err := saveUserPalette(user.ID, "Sunset", []model.Color{{Hex: "#101010"}, {Hex: "#F0F0F0"}, {Hex: "#E04040"}}); err != nil {
+		t.Fatalf("save palette: %v", err)
+	}
+	var palette model.Palette
+	if err := db.DB.Where("user_id = ?", user.ID).First(&palette).Error; err != nil {
+		t.Fatalf("load saved palette: %v", err)
+	}
+
+	token, err := authpkg.GenerateJWTToken(user)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	router := setupThemeRouter()
+	router.GET("/palettes/:id/terminal", PaletteTerminalHandler)
+
+	for _, tc := range []struct {
+		path     string
+		auth     bool
+		status   int
+		contains string
+	}{
+		{fmt.Sprintf("/themes/%d/terminal?format=kitty", theme.ID), true, http.StatusOK, "background #101010"},
+		{fmt.Sprintf("/themes/%d/terminal?format=rxvt", theme.ID), true, http.StatusBadRequest, "format must be one of"},
+		{fmt.Sprintf("/themes/%d/terminal?format=kitty", theme.ID), false, http.StatusNotFound, "theme not found"},
+		{fmt.Sprintf("/palettes/%d/terminal?format=alacritty", palette.ID), true, http.StatusOK, `red = "#e04040"`},
+		{fmt.Sprintf("/palettes/%d/terminal?format=alacritty", palette.ID), false, http.StatusNotFound, "palette not found"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.auth {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, tc.path)
+		assert.Contains(t, w.Body.String(), tc.contains, tc.path)
+	}
+}
+
+func TestToolkitHandlers_RenderThemeAndPalette(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	user := createTestUser(t)
+	theme, _, err := saveUserTheme(user.ID, "Dusk Theme", "zed", "sig-toolkit-1", `{"name":"Dusk Theme","themeResult":{"theme":{"name":"Dusk","themes":[{"name":"Dusk","appearance":"dark","style":{"background":"#101010","text":"#eeeeee"}}]}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	db.DB.Model(&theme).Update("is_shared", true)
+	if err := saveUserPalette(user.ID, "Sunset", []model.Color{{Hex: "#101010"}, {Hex: "#F0F0F0"}, {Hex: "#E04040"}}); err != nil {
+		t.Fatalf("save palette: %v", err)
+	}
+	var palette model.Palette
+	if err := db.DB.Where("user_id = ?", user.ID).First(&palette).Error; err != nil {
+		t.Fatalf("load saved palette: %v", err)
+	}
+	db.DB.Model(&palette).Update("is_shared", true)
+
+	router := setupThemeRouter()
+	router.GET("/palettes/:id/gtk", PaletteGTKHandler)
+	router.GET("/palettes/:id/base24", PaletteBase24Handler)
+
+	for path, want := range map[string]string{
+		fmt.Sprintf("/themes/%d/kde", theme.ID):        "BackgroundNormal=16,16,16",
+		fmt.Sprintf("/themes/%d/gtk", theme.ID):        "@define-color view_bg_color #101010;",
+		fmt.Sprintf("/themes/%d/xresources", theme.ID): "*.background: #101010",
+		fmt.Sprintf("/themes/%d/base16", theme.ID):     `system: "base16"`,
+		fmt.Sprintf("/themes/%d/base24", theme.ID):     `system: "base24"`,
+		fmt.Sprintf("/themes/%d/pywal", theme.ID):      `"background": "#101010"`,
+		fmt.Sprintf("/palettes/%d/gtk", palette.ID):    "@define-color view_fg_color #f0f0f0;",
+		fmt.Sprintf("/palettes/%d/base24", palette.ID): `base08: "#e04040"`,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Body.String(), want, path)
+		assert.NotEmpty(t, w.Header().Get("Content-Disposition"), path)
+	}
+}
+
+func TestDiffThemesHandler_OwnedAndSharedThemes(t *testing.T) {
+	setupTestDB(t)
+	resetTestDB(t)
+
+	owner := createTestUser(t)
+	other := model.User{Name: "Diff Other", Email: "diff-other@example.com", PasswordHash: "hash"}
+	if err := db.DB.Create(&other).Error; err != nil {
+		t.Fatalf("create other user: %v", err)
+	}
+	mine, _, err := saveUserTheme(owner.ID, "Mine", "vscode", "sig-diff-1", `{"name":"Mine","themeResult":{"theme":{"colors":{"editor.background":"#101010"}}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	shared, _, err := saveUserTheme(other.ID, "Shared", "vscode", "sig-diff-2", `{"name":"Shared","themeResult":{"theme":{"colors":{"editor.background":"#202020"}}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	private, _, err := saveUserTheme(other.ID, "Private", "vscode", "sig-diff-3", `{"name":"Private","themeResult":{"theme":{"colors":{}}}}`)
+	if err != nil {
+		t.Fatalf("save theme: %v", err)
+	}
+	db.DB.Model(&shared).Update("is_shared", true)
+
+	token, err := authpkg.GenerateJWTToken(owner)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	router := setupThemeRouter()
+	diff := func(ids ...uint) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"ids": []string{fmt.Sprintf("%d", ids[0]), fmt.Sprintf("%d", ids[1])}})
+		req := httptest.NewRequest("POST", "/themes/diff", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := diff(mine.ID, shared.ID)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ThemeDiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	assert.Equal(t, "Mine", resp.From.Name)
+	assert.Equal(t, "Shared", resp.To.Name)
+	if assert.Len(t, resp.Changed, 1) {
+		assert.Equal(t, "/colors/editor.background", resp.Changed[0].Key)
+		assert.NotNil(t, resp.Changed[0].DeltaE)
+	}
+
+	w = diff(mine.ID, private.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"themesmith/model"
 
@@ -77,8 +80,9 @@ func TestSavePaletteHandler_InvalidRequest(t *testing.T) {
 }
 
 func TestWallhavenHandlers(t *testing.T) {
-	origTransport := http.DefaultTransport
-	defer func() { http.DefaultTransport = origTransport }()
+	origTransport := outboundTransport
+	defer func() { outboundTransport = origTransport }()
+	useTestWallhavenCache(t)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -88,15 +92,16 @@ func TestWallhavenHandlers(t *testing.T) {
 
 	makeResp := func(status int, body []byte, contentType string) *http.Response {
 		return &http.Response{
-			StatusCode: status,
-			Body:       io.NopCloser(bytes.NewReader(body)),
-			Header:     http.Header{"Content-Type": []string{contentType}},
+			StatusCode:    status,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			Header:        http.Header{"Content-Type": []string{contentType}},
+			ContentLength: -1,
 		}
 	}
 
 	t.Run("SearchSuccess", func(t *testing.T) {
 		fakeBody := []byte(`{"data": [{"id":"abc123"}]}`)
-		http.DefaultTransport = &mockRoundTripper{resp: makeResp(200, fakeBody, "application/json")}
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, fakeBody, "application/json")}
 
 		req := httptest.NewRequest("GET", "/wallhaven/search?q=test", nil)
 		w := httptest.NewRecorder()
@@ -112,7 +117,7 @@ func TestWallhavenHandlers(t *testing.T) {
 
 	t.Run("GetWallpaperSuccess", func(t *testing.T) {
 		fakeBody := []byte("<html>wallpaper</html>")
-		http.DefaultTransport = &mockRoundTripper{resp: makeResp(200, fakeBody, "text/html")}
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, fakeBody, "text/html")}
 
 		req := httptest.NewRequest("GET", "/wallhaven/w/abc123", nil)
 		w := httptest.NewRecorder()
@@ -133,9 +138,9 @@ func TestWallhavenHandlers(t *testing.T) {
 			return b.Bytes()
 		}()
 
-		http.DefaultTransport = &mockRoundTripper{resp: makeResp(200, fakePNG, "image/png")}
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, fakePNG, "image/png")}
 
-		req := httptest.NewRequest("GET", "/wallhaven/download?url=https://example.com/img.png", nil)
+		req := httptest.NewRequest("GET", "/wallhaven/download?url=https://w.wallhaven.cc/full/ab/wallhaven-abc123.png", nil)
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
@@ -144,6 +149,38 @@ func TestWallhavenHandlers(t *testing.T) {
 		assert.Greater(t, w.Body.Len(), 0)
 	})
 
+	t.Run("DownloadTooManyPixels", func(t *testing.T) {
+		t.Setenv("IMAGE_MAX_PIXELS", "1000")
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, buildPNGHeader(5000, 5000), "image/png")}
+
+		req := httptest.NewRequest("GET", "/wallhaven/download?url=https://w.wallhaven.cc/full/ab/wallhaven-bomb.png", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("DownloadDisallowedHost", func(t *testing.T) {
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, []byte("secret"), "text/plain")}
+
+		req := httptest.NewRequest("GET", "/wallhaven/download?url=http://169.254.169.254/latest/meta-data/", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret")
+	})
+
+	t.Run("DownloadRejectsNonImage", func(t *testing.T) {
+		outboundTransport = &mockRoundTripper{resp: makeResp(200, []byte("<html></html>"), "text/html")}
+
+		req := httptest.NewRequest("GET", "/wallhaven/download?url=https://w.wallhaven.cc/full/ab/page.html", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+	})
+
 	t.Run("DownloadInvalidURL", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/wallhaven/download", nil)
 		w := httptest.NewRecorder()
@@ -153,7 +190,7 @@ func TestWallhavenHandlers(t *testing.T) {
 	})
 
 	t.Run("ProxyNetworkError", func(t *testing.T) {
-		http.DefaultTransport = &mockRoundTripper{err: io.ErrUnexpectedEOF}
+		outboundTransport = &mockRoundTripper{err: io.ErrUnexpectedEOF}
 
 		req := httptest.NewRequest("GET", "/wallhaven/search?q=err", nil)
 		w := httptest.NewRecorder()
@@ -213,3 +250,369 @@ func TestApplyPaletteHandler(t *testing.T) {
 	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
 	assert.Greater(t, w.Body.Len(), 0)
 }
+
+func newApplyPaletteRequest(t *testing.T, path string, imageBytes []byte, fields map[string]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if imageBytes != nil {
+		part, err := writer.CreateFormFile("file", "test.png")
+		if err != nil {
+			t.Fatalf("create multipart file: %v", err)
+		}
+		if _, err := part.Write(imageBytes); err != nil {
+			t.Fatalf("write multipart file: %v", err)
+		}
+	}
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("write %s field: %v", key, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", path, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func encodeTestPNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestApplyPaletteHandler_Metrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apply-palette", ApplyPaletteHandler)
+
+	imageBytes := encodeTestPNG(t, createTestImage(10, 10))
+	palette := `["#FF0000","#00FF00","#0000FF"]`
+
+	t.Run("Headers", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{"palette": palette, "metrics": "true"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, "100", w.Header().Get("X-ThemeSmith-Pixel-Count"))
+		assert.NotEmpty(t, w.Header().Get("X-ThemeSmith-DeltaE-Mean"))
+		assert.NotEmpty(t, w.Header().Get("X-ThemeSmith-DeltaE-P95"))
+		assert.Equal(t, "0.000000", w.Header().Get("X-ThemeSmith-Untouched-Ratio"))
+
+		var usage []PaletteColorUsage
+		assert.NoError(t, json.Unmarshal([]byte(w.Header().Get("X-ThemeSmith-Palette-Usage")), &usage))
+		assert.Len(t, usage, 3)
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{"palette": palette, "metrics": "multipart"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		assert.NoError(t, err)
+
+		reader := multipart.NewReader(w.Body, params["boundary"])
+		imagePart, err := reader.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", imagePart.Header.Get("Content-Type"))
+		_, err = png.Decode(imagePart)
+		assert.NoError(t, err)
+
+		metricsPart, err := reader.NextPart()
+		assert.NoError(t, err)
+		var metrics RecolorMetrics
+		assert.NoError(t, json.NewDecoder(metricsPart).Decode(&metrics))
+		assert.Equal(t, 100, metrics.PixelCount)
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{"palette": palette})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-ThemeSmith-DeltaE-Mean"))
+	})
+}
+
+func TestApplyPaletteHandler_Resize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apply-palette", ApplyPaletteHandler)
+
+	imageBytes := encodeTestPNG(t, createTestImage(40, 20))
+	palette := `["#FF0000","#00FF00","#0000FF"]`
+
+	t.Run("Width and height", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{
+			"palette": palette,
+			"width":   "16",
+			"height":  "16",
+			"fit":     "cover",
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		cfg, err := png.DecodeConfig(w.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, 16, cfg.Width)
+		assert.Equal(t, 16, cfg.Height)
+	})
+
+	t.Run("Unknown preset", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{
+			"palette": palette,
+			"preset":  "8k",
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestApplyPaletteHandler_ExifOrientation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apply-palette", ApplyPaletteHandler)
+
+	imageBytes := encodeTestJPEG(t, createTestImage(12, 6), imageMetadata{Exif: buildTestExif(binary.LittleEndian, 6)})
+	palette := `["#FF0000","#00FF00","#0000FF"]`
+
+	t.Run("Rotates and strips metadata by default", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{"palette": palette})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		output := w.Body.Bytes()
+		cfg, err := png.DecodeConfig(bytes.NewReader(output))
+		assert.NoError(t, err)
+		assert.Equal(t, 6, cfg.Width)
+		assert.Equal(t, 12, cfg.Height)
+		assert.Nil(t, readImageMetadata(output).Exif)
+	})
+
+	t.Run("Keeps metadata as JPEG when requested", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{
+			"palette":       palette,
+			"format":        "jpeg",
+			"stripMetadata": "false",
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		meta := readImageMetadata(w.Body.Bytes())
+		assert.NotNil(t, meta.Exif)
+		assert.Equal(t, 1, meta.Orientation)
+	})
+
+	t.Run("Invalid format", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, map[string]string{"palette": palette, "format": "tiff"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestApplyPaletteHandler_Limits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apply-palette", ApplyPaletteHandler)
+
+	palette := `["#FF0000","#00FF00","#0000FF"]`
+
+	t.Run("Decompression bomb", func(t *testing.T) {
+		t.Setenv("IMAGE_MAX_PIXELS", "1000000")
+
+		req := newApplyPaletteRequest(t, "/apply-palette", buildPNGHeader(50000, 50000), map[string]string{"palette": palette})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var resp ImageLimitError
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "too_many_pixels", resp.Code)
+		assert.Equal(t, int64(1000000), resp.Limit)
+	})
+
+	t.Run("Resize target", func(t *testing.T) {
+		t.Setenv("IMAGE_MAX_PIXELS", "1000000")
+
+		req := newApplyPaletteRequest(t, "/apply-palette", encodeTestPNG(t, createTestImage(16, 16)), map[string]string{
+			"palette": palette,
+			"width":   "2000",
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var resp ImageLimitError
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "too_many_pixels", resp.Code)
+		assert.Equal(t, int64(4000000), resp.Actual)
+	})
+
+	t.Run("Encoded size", func(t *testing.T) {
+		t.Setenv("IMAGE_MAX_ENCODED_BYTES", "64")
+
+		req := newApplyPaletteRequest(t, "/apply-palette", encodeTestPNG(t, createTestImage(32, 32)), map[string]string{"palette": palette})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "image_too_large")
+	})
+
+	t.Run("Request body size", func(t *testing.T) {
+		t.Setenv("IMAGE_MAX_REQUEST_BYTES", "512")
+
+		req := newApplyPaletteRequest(t, "/apply-palette", encodeTestPNG(t, createTestImage(64, 64)), map[string]string{"palette": palette})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "request_too_large")
+	})
+}
+
+func TestApplyPaletteHandler_Cache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apply-palette", ApplyPaletteHandler)
+	router.GET("/apply-palette/:hash", GetAppliedPaletteHandler)
+
+	imageBytes := encodeTestPNG(t, createTestImage(14, 9))
+	fields := map[string]string{"palette": `["#123456","#ABCDEF"]`}
+
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, newApplyPaletteRequest(t, "/apply-palette", imageBytes, fields))
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	sourceHash := first.Header().Get("X-ThemeSmith-Source-Hash")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, hashBytes(imageBytes), sourceHash)
+
+	t.Run("Same input yields same ETag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, newApplyPaletteRequest(t, "/apply-palette", imageBytes, fields))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Equal(t, first.Body.Bytes(), w.Body.Bytes())
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/apply-palette", imageBytes, fields)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, 0, w.Body.Len())
+	})
+
+	t.Run("Fetch by hash", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/apply-palette/"+strings.Trim(etag, `"`), nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, first.Body.Bytes(), w.Body.Bytes())
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/apply-palette/unknown", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Reuse source hash without upload", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, newApplyPaletteRequest(t, "/apply-palette", nil, map[string]string{
+			"palette":    `["#FF0000"]`,
+			"sourceHash": sourceHash,
+		}))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, newApplyPaletteRequest(t, "/apply-palette", nil, map[string]string{
+			"palette":    `["#FF0000"]`,
+			"sourceHash": "missing",
+		}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestWallhavenApplyPaletteHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/wallhaven/w/:id/apply-palette", WallhavenApplyPaletteHandler)
+
+	imageBytes := encodeTestPNG(t, createTestImage(16, 10))
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/w/abc123":
+			assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data":{"id":"abc123","path":"` + upstream.URL + `/full/abc123.png","file_type":"image/png"}}`))
+		case "/full/abc123.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(imageBytes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	t.Setenv("WALLHAVEN_API_BASE", upstream.URL)
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+	useTestWallhavenCache(t)
+
+	newRequest := func(id string) *http.Request {
+		req := newApplyPaletteRequest(t, "/wallhaven/w/"+id+"/apply-palette", nil, map[string]string{
+			"palette": `["#FF0000","#00FF00","#0000FF"]`,
+			"width":   "8",
+		})
+		req.Header.Set("X-API-Key", "secret")
+		return req
+	}
+
+	t.Run("Recolors the full image", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, newRequest("abc123"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, hashBytes(imageBytes), w.Header().Get("X-ThemeSmith-Source-Hash"))
+		cfg, err := png.DecodeConfig(w.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, cfg.Width)
+		assert.Equal(t, 5, cfg.Height)
+	})
+
+	t.Run("Unknown wallpaper", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, newRequest("missing"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Missing palette", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/wallhaven/w/abc123/apply-palette", nil, map[string]string{})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxRequestBytes int64 = 64 << 20
+	defaultMaxEncodedBytes int64 = 40 << 20
+	defaultMaxPixels       int64 = 50_000_000
+)
+
+const (
+	imageLimitRequestTooLarge = "request_too_large"
+	imageLimitImageTooLarge   = "image_too_large"
+	imageLimitTooManyPixels   = "too_many_pixels"
+)
+
+// ImageLimits bound the work an image endpoint will do for one request. They are
+// read from IMAGE_MAX_REQUEST_BYTES, IMAGE_MAX_ENCODED_BYTES and IMAGE_MAX_PIXELS.
+type ImageLimits struct {
+	MaxRequestBytes int64
+	MaxEncodedBytes int64
+	MaxPixels       int64
+}
+
+type ImageLimitError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+	Limit   int64  `json:"limit"`
+	Actual  int64  `json:"actual,omitempty"`
+}
+
+func (e *ImageLimitError) Error() string {
+	return e.Message
+}
+
+func loadImageLimits() ImageLimits {
+	return ImageLimits{
+		MaxRequestBytes: envInt64("IMAGE_MAX_REQUEST_BYTES", defaultMaxRequestBytes),
+		MaxEncodedBytes: envInt64("IMAGE_MAX_ENCODED_BYTES", defaultMaxEncodedBytes),
+		MaxPixels:       envInt64("IMAGE_MAX_PIXELS", defaultMaxPixels),
+	}
+}
+
+func envInt64(key string, fallback int64) int64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
+
+func (l ImageLimits) requestTooLarge() *ImageLimitError {
+	return &ImageLimitError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    imageLimitRequestTooLarge,
+		Message: fmt.Sprintf("request body exceeds %d bytes", l.MaxRequestBytes),
+		Limit:   l.MaxRequestBytes,
+	}
+}
+
+// asRequestTooLarge reports whether err was caused by the body limit installed
+// with http.MaxBytesReader.
+func (l ImageLimits) asRequestTooLarge(err error) (*ImageLimitError, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return l.requestTooLarge(), true
+	}
+	return nil, false
+}
+
+func (l ImageLimits) checkEncodedSize(size int64) *ImageLimitError {
+	if size > l.MaxEncodedBytes {
+		return &ImageLimitError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    imageLimitImageTooLarge,
+			Message: fmt.Sprintf("image exceeds %d bytes", l.MaxEncodedBytes),
+			Limit:   l.MaxEncodedBytes,
+			Actual:  size,
+		}
+	}
+	return nil
+}
+
+// checkDecodedSize reads only the image header, so oversized images are
+// rejected before any pixel buffer is allocated. Header parse failures are
+// returned as plain errors.
+func (l ImageLimits) checkDecodedSize(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if cfg.Width <= 0 || cfg.Height <= 0 || pixels > l.MaxPixels {
+		return &ImageLimitError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    imageLimitTooManyPixels,
+			Message: fmt.Sprintf("image is %dx%d, which exceeds the %d pixel limit", cfg.Width, cfg.Height, l.MaxPixels),
+			Limit:   l.MaxPixels,
+			Actual:  pixels,
+		}
+	}
+	return nil
+}
+
+// checkResizedSize applies the pixel limit to the output of a resize, which
+// can be much larger than the image that was uploaded.
+func (l ImageLimits) checkResizedSize(width int, height int) *ImageLimitError {
+	pixels := int64(width) * int64(height)
+	if pixels > l.MaxPixels {
+		return &ImageLimitError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    imageLimitTooManyPixels,
+			Message: fmt.Sprintf("resized image is %dx%d, which exceeds the %d pixel limit", width, height, l.MaxPixels),
+			Limit:   l.MaxPixels,
+			Actual:  pixels,
+		}
+	}
+	return nil
+}
+
+func respondImageLimitError(c *gin.Context, err *ImageLimitError) {
+	c.JSON(err.Status, err)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildPNGHeader returns a PNG that only declares its dimensions, which is all
+// image.DecodeConfig needs to see.
+func buildPNGHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8] = 8
+	ihdr[9] = 6
+	writePNGChunk(&buf, "IHDR", ihdr)
+	writePNGChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+func TestLoadImageLimits(t *testing.T) {
+	t.Setenv("IMAGE_MAX_REQUEST_BYTES", "1024")
+	t.Setenv("IMAGE_MAX_ENCODED_BYTES", "not-a-number")
+	t.Setenv("IMAGE_MAX_PIXELS", "-1")
+
+	limits := loadImageLimits()
+	assert.Equal(t, int64(1024), limits.MaxRequestBytes)
+	assert.Equal(t, defaultMaxEncodedBytes, limits.MaxEncodedBytes)
+	assert.Equal(t, defaultMaxPixels, limits.MaxPixels)
+}
+
+func TestImageLimitsCheckDecodedSize(t *testing.T) {
+	limits := ImageLimits{MaxPixels: 1_000_000}
+
+	assert.NoError(t, limits.checkDecodedSize(buildPNGHeader(1000, 1000)))
+
+	err := limits.checkDecodedSize(buildPNGHeader(50000, 50000))
+	var limitErr *ImageLimitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.Equal(t, http.StatusUnprocessableEntity, limitErr.Status)
+		assert.Equal(t, imageLimitTooManyPixels, limitErr.Code)
+		assert.Equal(t, int64(2_500_000_000), limitErr.Actual)
+	}
+
+	err = limits.checkDecodedSize([]byte("not an image"))
+	assert.Error(t, err)
+	assert.False(t, isImageLimitError(err))
+}
+
+func TestImageLimitsCheckResizedSize(t *testing.T) {
+	limits := ImageLimits{MaxPixels: 50_000_000}
+
+	assert.Nil(t, limits.checkResizedSize(3840, 2160))
+
+	limitErr := limits.checkResizedSize(maxResizeDimension, maxResizeDimension)
+	if assert.NotNil(t, limitErr) {
+		assert.Equal(t, http.StatusUnprocessableEntity, limitErr.Status)
+		assert.Equal(t, imageLimitTooManyPixels, limitErr.Code)
+		assert.Equal(t, int64(maxResizeDimension*maxResizeDimension), limitErr.Actual)
+	}
+}
+
+func TestImageLimitsCheckEncodedSize(t *testing.T) {
+	limits := ImageLimits{MaxEncodedBytes: 100}
+
+	assert.Nil(t, limits.checkEncodedSize(100))
+	limitErr := limits.checkEncodedSize(101)
+	if assert.NotNil(t, limitErr) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, limitErr.Status)
+		assert.Equal(t, imageLimitImageTooLarge, limitErr.Code)
+	}
+}
+
+func isImageLimitError(err error) bool {
+	_, ok := err.(*ImageLimitError)
+	return ok
+}
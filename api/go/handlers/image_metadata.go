@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+)
+
+const (
+	exifOrientationTag     = 0x0112
+	exifImageWidthTag      = 0x0100
+	exifImageLengthTag     = 0x0101
+	exifIFDPointerTag      = 0x8769
+	exifPixelXDimensionTag = 0xA002
+	exifPixelYDimensionTag = 0xA003
+	maxJPEGSegmentData     = 65533
+	iccChunkMaxData        = 65519
+)
+
+var (
+	pngSignature   = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader     = []byte("Exif\x00\x00")
+	iccHeader      = []byte("ICC_PROFILE\x00")
+	pngICCProfName = []byte("ICC Profile")
+)
+
+// imageMetadata is the subset of source metadata ThemeSmith understands. Exif
+// holds a raw TIFF structure (without the JPEG "Exif\0\0" prefix) and ICC the
+// uncompressed color profile.
+type imageMetadata struct {
+	Orientation int
+	Exif        []byte
+	ICC         []byte
+
+	orientationOffset int
+	dimensionFields   []exifDimensionField
+	byteOrder         binary.ByteOrder
+}
+
+// exifDimensionField locates a single-valued pixel width or height tag, which
+// is rewritten to the size of the encoded output.
+type exifDimensionField struct {
+	offset int
+	long   bool
+	height bool
+}
+
+func readImageMetadata(data []byte) imageMetadata {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return readJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return readPNGMetadata(data)
+	default:
+		return imageMetadata{Orientation: 1}
+	}
+}
+
+func readJPEGMetadata(data []byte) imageMetadata {
+	meta := imageMetadata{Orientation: 1}
+	var iccChunks [][]byte
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		// Start of scan or end of image: no metadata segments follow.
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) && meta.Exif == nil:
+			meta.setExif(segment[len(exifHeader):])
+		case marker == 0xE2 && bytes.HasPrefix(segment, iccHeader) && len(segment) > len(iccHeader)+2:
+			iccChunks = append(iccChunks, segment[len(iccHeader)+2:])
+		}
+
+		pos += 2 + length
+	}
+
+	if len(iccChunks) > 0 {
+		meta.ICC = bytes.Join(iccChunks, nil)
+	}
+
+	return meta
+}
+
+func readPNGMetadata(data []byte) imageMetadata {
+	meta := imageMetadata{Orientation: 1}
+
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if pos+12+length > len(data) {
+			break
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		chunk := data[pos+8 : pos+8+length]
+
+		switch chunkType {
+		case "eXIf":
+			meta.setExif(chunk)
+		case "iCCP":
+			if profile, ok := decodePNGICCProfile(chunk); ok {
+				meta.ICC = profile
+			}
+		case "IDAT", "IEND":
+			return meta
+		}
+
+		pos += 12 + length
+	}
+
+	return meta
+}
+
+func decodePNGICCProfile(chunk []byte) ([]byte, bool) {
+	nameEnd := bytes.IndexByte(chunk, 0)
+	if nameEnd < 0 || nameEnd+2 > len(chunk) || chunk[nameEnd+1] != 0 {
+		return nil, false
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(chunk[nameEnd+2:]))
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+
+	profile, err := io.ReadAll(io.LimitReader(reader, 4<<20))
+	if err != nil {
+		return nil, false
+	}
+	return profile, true
+}
+
+// setExif keeps a copy of the TIFF structure and locates the orientation tag in
+// IFD0 and the pixel dimension tags in IFD0 and the Exif IFD, so they can be
+// corrected once the pixels have been rotated and resized.
+func (m *imageMetadata) setExif(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return
+	}
+
+	m.Exif = append([]byte(nil), tiff...)
+	m.byteOrder = order
+
+	exifIFD := 0
+	m.scanExifIFD(int(order.Uint32(tiff[4:])), func(tag uint16, entry int) {
+		switch tag {
+		case exifOrientationTag:
+			value := int(order.Uint16(tiff[entry+8:]))
+			if m.orientationOffset == 0 && value >= 1 && value <= 8 {
+				m.Orientation = value
+				m.orientationOffset = entry + 8
+			}
+		case exifImageWidthTag, exifImageLengthTag:
+			m.addDimensionField(entry, tag == exifImageLengthTag)
+		case exifIFDPointerTag:
+			exifIFD = int(order.Uint32(tiff[entry+8:]))
+		}
+	})
+	m.scanExifIFD(exifIFD, func(tag uint16, entry int) {
+		if tag == exifPixelXDimensionTag || tag == exifPixelYDimensionTag {
+			m.addDimensionField(entry, tag == exifPixelYDimensionTag)
+		}
+	})
+}
+
+// scanExifIFD calls visit with the tag and offset of every entry of the IFD at
+// offset, stopping at the end of the Exif block.
+func (m *imageMetadata) scanExifIFD(offset int, visit func(tag uint16, entry int)) {
+	if offset < 8 || offset+2 > len(m.Exif) {
+		return
+	}
+
+	count := int(m.byteOrder.Uint16(m.Exif[offset:]))
+	for i := range count {
+		entry := offset + 2 + i*12
+		if entry+12 > len(m.Exif) {
+			return
+		}
+		visit(m.byteOrder.Uint16(m.Exif[entry:]), entry)
+	}
+}
+
+func (m *imageMetadata) addDimensionField(entry int, height bool) {
+	fieldType := m.byteOrder.Uint16(m.Exif[entry+2:])
+	if (fieldType != 3 && fieldType != 4) || m.byteOrder.Uint32(m.Exif[entry+4:]) != 1 {
+		return
+	}
+	m.dimensionFields = append(m.dimensionFields, exifDimensionField{offset: entry + 8, long: fieldType == 4, height: height})
+}
+
+// normalizedExif returns the Exif block with the orientation tag set to 1 and
+// the pixel dimension tags set to size, matching pixels that have already been
+// rotated upright and resized.
+func (m imageMetadata) normalizedExif(size image.Point) []byte {
+	if m.Exif == nil {
+		return nil
+	}
+
+	exif := append([]byte(nil), m.Exif...)
+	if m.orientationOffset > 0 {
+		m.byteOrder.PutUint16(exif[m.orientationOffset:], 1)
+	}
+	for _, field := range m.dimensionFields {
+		value := size.X
+		if field.height {
+			value = size.Y
+		}
+		if field.long {
+			m.byteOrder.PutUint32(exif[field.offset:], uint32(value))
+		} else {
+			m.byteOrder.PutUint16(exif[field.offset:], uint16(min(value, math.MaxUint16)))
+		}
+	}
+	return exif
+}
+
+// applyOrientation rotates and flips img so that it displays upright for the
+// given EXIF orientation value.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w := bounds.Dx()
+	h := bounds.Dy()
+	outW, outH := w, h
+	if orientation >= 5 {
+		outW, outH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	for y := range outH {
+		for x := range outW {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+func embedJPEGMetadata(encoded []byte, meta imageMetadata, size image.Point) []byte {
+	if len(encoded) < 2 {
+		return encoded
+	}
+
+	var segments bytes.Buffer
+	if exif := meta.normalizedExif(size); exif != nil && len(exifHeader)+len(exif) <= maxJPEGSegmentData {
+		writeJPEGSegment(&segments, 0xE1, exifHeader, exif)
+	}
+
+	if len(meta.ICC) > 0 {
+		chunks := (len(meta.ICC) + iccChunkMaxData - 1) / iccChunkMaxData
+		if chunks <= 255 {
+			for i := range chunks {
+				start := i * iccChunkMaxData
+				end := min(start+iccChunkMaxData, len(meta.ICC))
+				header := append(append([]byte(nil), iccHeader...), byte(i+1), byte(chunks))
+				writeJPEGSegment(&segments, 0xE2, header, meta.ICC[start:end])
+			}
+		}
+	}
+
+	if segments.Len() == 0 {
+		return encoded
+	}
+
+	out := make([]byte, 0, len(encoded)+segments.Len())
+	out = append(out, encoded[:2]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, encoded[2:]...)
+}
+
+func writeJPEGSegment(w *bytes.Buffer, marker byte, header []byte, payload []byte) {
+	length := 2 + len(header) + len(payload)
+	w.Write([]byte{0xFF, marker, byte(length >> 8), byte(length)})
+	w.Write(header)
+	w.Write(payload)
+}
+
+func embedPNGMetadata(encoded []byte, meta imageMetadata, size image.Point) []byte {
+	// The signature is followed by the 25-byte IHDR chunk; ancillary chunks
+	// describing color and Exif data must come before any IDAT.
+	const insertAt = 8 + 25
+	if len(encoded) < insertAt || !bytes.HasPrefix(encoded, pngSignature) {
+		return encoded
+	}
+
+	var chunks bytes.Buffer
+	if len(meta.ICC) > 0 {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(meta.ICC); err == nil && zw.Close() == nil {
+			data := append(append([]byte(nil), pngICCProfName...), 0, 0)
+			writePNGChunk(&chunks, "iCCP", append(data, compressed.Bytes()...))
+		}
+	}
+	if exif := meta.normalizedExif(size); exif != nil {
+		writePNGChunk(&chunks, "eXIf", exif)
+	}
+
+	if chunks.Len() == 0 {
+		return encoded
+	}
+
+	out := make([]byte, 0, len(encoded)+chunks.Len())
+	out = append(out, encoded[:insertAt]...)
+	out = append(out, chunks.Bytes()...)
+	return append(out, encoded[insertAt:]...)
+}
+
+func writePNGChunk(w *bytes.Buffer, chunkType string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	w.WriteString(chunkType)
+	w.Write(data)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestExif(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	return tiff
+}
+
+// buildTestExifWithDimensions returns an Exif block whose IFD0 holds the
+// orientation and a pointer to an Exif IFD with a LONG PixelXDimension and a
+// SHORT PixelYDimension.
+func buildTestExifWithDimensions(order binary.ByteOrder, orientation uint16, width uint32, height uint16) []byte {
+	tiff := make([]byte, 68)
+	copy(tiff, "II")
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	order.PutUint16(tiff[22:], exifIFDPointerTag)
+	order.PutUint16(tiff[24:], 4)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint32(tiff[30:], 38)
+
+	order.PutUint16(tiff[38:], 2)
+	order.PutUint16(tiff[40:], exifPixelXDimensionTag)
+	order.PutUint16(tiff[42:], 4)
+	order.PutUint32(tiff[44:], 1)
+	order.PutUint32(tiff[48:], width)
+	order.PutUint16(tiff[52:], exifPixelYDimensionTag)
+	order.PutUint16(tiff[54:], 3)
+	order.PutUint32(tiff[56:], 1)
+	order.PutUint16(tiff[60:], height)
+	return tiff
+}
+
+func encodeTestJPEG(t *testing.T, img image.Image, meta imageMetadata) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode test jpeg: %v", err)
+	}
+
+	var segments bytes.Buffer
+	if meta.Exif != nil {
+		writeJPEGSegment(&segments, 0xE1, exifHeader, meta.Exif)
+	}
+
+	encoded := buf.Bytes()
+	out := append([]byte{}, encoded[:2]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, encoded[2:]...)
+}
+
+func TestReadImageMetadata(t *testing.T) {
+	img := createTestImage(8, 4)
+
+	t.Run("JPEG orientation little endian", func(t *testing.T) {
+		data := encodeTestJPEG(t, img, imageMetadata{Exif: buildTestExif(binary.LittleEndian, 6)})
+		meta := readImageMetadata(data)
+		assert.Equal(t, 6, meta.Orientation)
+		assert.NotNil(t, meta.Exif)
+	})
+
+	t.Run("JPEG orientation big endian", func(t *testing.T) {
+		data := encodeTestJPEG(t, img, imageMetadata{Exif: buildTestExif(binary.BigEndian, 3)})
+		assert.Equal(t, 3, readImageMetadata(data).Orientation)
+	})
+
+	t.Run("No metadata", func(t *testing.T) {
+		meta := readImageMetadata(encodeTestPNG(t, img))
+		assert.Equal(t, 1, meta.Orientation)
+		assert.Nil(t, meta.Exif)
+		assert.Nil(t, meta.ICC)
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		assert.Equal(t, 1, readImageMetadata([]byte("GIF89a")).Orientation)
+	})
+}
+
+func TestApplyOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	marker := color.RGBA{255, 0, 0, 255}
+	img.Set(0, 0, marker)
+
+	tests := []struct {
+		orientation int
+		bounds      image.Rectangle
+		markerAt    image.Point
+	}{
+		{1, image.Rect(0, 0, 3, 2), image.Pt(0, 0)},
+		{2, image.Rect(0, 0, 3, 2), image.Pt(2, 0)},
+		{3, image.Rect(0, 0, 3, 2), image.Pt(2, 1)},
+		{4, image.Rect(0, 0, 3, 2), image.Pt(0, 1)},
+		{5, image.Rect(0, 0, 2, 3), image.Pt(0, 0)},
+		{6, image.Rect(0, 0, 2, 3), image.Pt(1, 0)},
+		{7, image.Rect(0, 0, 2, 3), image.Pt(1, 2)},
+		{8, image.Rect(0, 0, 2, 3), image.Pt(0, 2)},
+	}
+
+	for _, tt := range tests {
+		out := applyOrientation(img, tt.orientation)
+		assert.Equal(t, tt.bounds, out.Bounds(), "orientation %d", tt.orientation)
+		assert.Equal(t, marker, toTestRGBA(out.At(tt.markerAt.X, tt.markerAt.Y)), "orientation %d", tt.orientation)
+	}
+}
+
+func TestEmbedMetadata(t *testing.T) {
+	img := createTestImage(4, 4)
+	meta := imageMetadata{ICC: bytes.Repeat([]byte{0xAB}, 70000)}
+	meta.setExif(buildTestExif(binary.LittleEndian, 8))
+
+	t.Run("JPEG keeps ICC and resets orientation", func(t *testing.T) {
+		encoded, err := encodeRecolorOutput(img, OutputOptions{Format: OutputFormatJPEG, Quality: 90}, meta)
+		assert.NoError(t, err)
+
+		roundTrip := readImageMetadata(encoded)
+		assert.Equal(t, 1, roundTrip.Orientation)
+		assert.Equal(t, meta.ICC, roundTrip.ICC)
+
+		_, err = jpeg.Decode(bytes.NewReader(encoded))
+		assert.NoError(t, err)
+	})
+
+	t.Run("PNG keeps ICC and resets orientation", func(t *testing.T) {
+		encoded, err := encodeRecolorOutput(img, OutputOptions{Format: OutputFormatPNG}, meta)
+		assert.NoError(t, err)
+
+		roundTrip := readImageMetadata(encoded)
+		assert.Equal(t, 1, roundTrip.Orientation)
+		assert.NotNil(t, roundTrip.Exif)
+		assert.Equal(t, meta.ICC, roundTrip.ICC)
+
+		_, _, err = image.Decode(bytes.NewReader(encoded))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Exif dimensions follow the output", func(t *testing.T) {
+		resized := createTestImage(6, 3)
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			var source imageMetadata
+			source.setExif(buildTestExifWithDimensions(order, 6, 3000, 4000))
+			assert.Equal(t, 6, source.Orientation)
+			assert.Len(t, source.dimensionFields, 2)
+
+			encoded, err := encodeRecolorOutput(resized, OutputOptions{Format: OutputFormatJPEG, Quality: 90}, source)
+			assert.NoError(t, err)
+
+			roundTrip := readImageMetadata(encoded)
+			assert.Equal(t, 1, roundTrip.Orientation)
+			assert.Equal(t, uint32(6), order.Uint32(roundTrip.Exif[48:]))
+			assert.Equal(t, uint16(3), order.Uint16(roundTrip.Exif[60:]))
+		}
+	})
+
+	t.Run("Strip metadata", func(t *testing.T) {
+		encoded, err := encodeRecolorOutput(img, OutputOptions{Format: OutputFormatPNG, StripMetadata: true}, meta)
+		assert.NoError(t, err)
+
+		roundTrip := readImageMetadata(encoded)
+		assert.Nil(t, roundTrip.Exif)
+		assert.Nil(t, roundTrip.ICC)
+	})
+}
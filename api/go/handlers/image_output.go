@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+type OutputFormat string
+
+const (
+	OutputFormatPNG  OutputFormat = "png"
+	OutputFormatJPEG OutputFormat = "jpeg"
+)
+
+type OutputOptions struct {
+	Format        OutputFormat
+	Quality       int
+	StripMetadata bool
+}
+
+func parseOutputOptions(format, quality, stripMetadata string) (OutputOptions, error) {
+	opts := OutputOptions{Format: OutputFormatPNG, Quality: 92, StripMetadata: true}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "png":
+		opts.Format = OutputFormatPNG
+	case "jpeg", "jpg":
+		opts.Format = OutputFormatJPEG
+	default:
+		return OutputOptions{}, fmt.Errorf("format must be png or jpeg")
+	}
+
+	if s := strings.TrimSpace(quality); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > 100 {
+			return OutputOptions{}, fmt.Errorf("quality must be between 1 and 100")
+		}
+		opts.Quality = v
+	}
+
+	if s := strings.TrimSpace(stripMetadata); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return OutputOptions{}, fmt.Errorf("stripMetadata must be a boolean")
+		}
+		opts.StripMetadata = v
+	}
+
+	return opts, nil
+}
+
+func (o OutputOptions) contentType() string {
+	if o.Format == OutputFormatJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// encodeRecolorOutput encodes img in the requested format. Unless metadata is
+// stripped, the source ICC profile and Exif block are carried over, with the
+// Exif orientation and pixel dimensions corrected for img.
+func encodeRecolorOutput(img image.Image, opts OutputOptions, meta imageMetadata) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch opts.Format {
+	case OutputFormatJPEG:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+		if opts.StripMetadata {
+			return buf.Bytes(), nil
+		}
+		return embedJPEGMetadata(buf.Bytes(), meta, img.Bounds().Size()), nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		if opts.StripMetadata {
+			return buf.Bytes(), nil
+		}
+		return embedPNGMetadata(buf.Bytes(), meta, img.Bounds().Size()), nil
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+type ResizeFit string
+
+const (
+	ResizeFitCover   ResizeFit = "cover"
+	ResizeFitContain ResizeFit = "contain"
+	ResizeFitFill    ResizeFit = "fill"
+)
+
+const maxResizeDimension = 8192
+
+type resizePreset struct {
+	Width  int
+	Height int
+}
+
+var resizePresets = map[string]resizePreset{
+	"1080p":     {Width: 1920, Height: 1080},
+	"1440p":     {Width: 2560, Height: 1440},
+	"4k":        {Width: 3840, Height: 2160},
+	"ultrawide": {Width: 3440, Height: 1440},
+	"phone":     {Width: 1170, Height: 2532},
+}
+
+type ResizeOptions struct {
+	Width  int
+	Height int
+	Fit    ResizeFit
+}
+
+func (o ResizeOptions) enabled() bool {
+	return o.Width > 0 || o.Height > 0
+}
+
+// parseResizeOptions reads the preset, width, height and fit fields. An explicit
+// width or height overrides the matching preset dimension.
+func parseResizeOptions(preset, width, height, fit string) (ResizeOptions, error) {
+	opts := ResizeOptions{Fit: ResizeFitCover}
+
+	if name := strings.ToLower(strings.TrimSpace(preset)); name != "" {
+		p, ok := resizePresets[name]
+		if !ok {
+			return ResizeOptions{}, fmt.Errorf("unknown preset %q", preset)
+		}
+		opts.Width = p.Width
+		opts.Height = p.Height
+	}
+
+	if s := strings.TrimSpace(width); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > maxResizeDimension {
+			return ResizeOptions{}, fmt.Errorf("width must be between 1 and %d", maxResizeDimension)
+		}
+		opts.Width = v
+	}
+
+	if s := strings.TrimSpace(height); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > maxResizeDimension {
+			return ResizeOptions{}, fmt.Errorf("height must be between 1 and %d", maxResizeDimension)
+		}
+		opts.Height = v
+	}
+
+	switch ResizeFit(strings.ToLower(strings.TrimSpace(fit))) {
+	case "", ResizeFitCover:
+		opts.Fit = ResizeFitCover
+	case ResizeFitContain:
+		opts.Fit = ResizeFitContain
+	case ResizeFitFill:
+		opts.Fit = ResizeFitFill
+	default:
+		return ResizeOptions{}, fmt.Errorf("fit must be one of cover, contain or fill")
+	}
+
+	return opts, nil
+}
+
+// resizedSize returns the size resizeImage produces for a source of the given
+// bounds. A dimension derived from the aspect ratio is capped at
+// maxResizeDimension, scaling the requested one down to match, so a very
+// narrow or tall source cannot blow up the output.
+func resizedSize(src image.Rectangle, opts ResizeOptions) (int, int) {
+	srcW := float64(src.Dx())
+	srcH := float64(src.Dy())
+	if !opts.enabled() || srcW == 0 || srcH == 0 {
+		return src.Dx(), src.Dy()
+	}
+
+	width := opts.Width
+	height := opts.Height
+	switch {
+	case width == 0:
+		if derived := srcW * float64(height) / srcH; derived > maxResizeDimension {
+			width = maxResizeDimension
+			height = max(int(math.Round(srcH*maxResizeDimension/srcW)), 1)
+		} else {
+			width = max(int(math.Round(derived)), 1)
+		}
+	case height == 0:
+		if derived := srcH * float64(width) / srcW; derived > maxResizeDimension {
+			height = maxResizeDimension
+			width = max(int(math.Round(srcW*maxResizeDimension/srcH)), 1)
+		} else {
+			height = max(int(math.Round(derived)), 1)
+		}
+	}
+	return width, height
+}
+
+// resizeImage scales img according to opts. With a single dimension the aspect
+// ratio is kept; with both, cover center-crops, contain letterboxes on a
+// transparent background and fill stretches.
+func resizeImage(img image.Image, opts ResizeOptions) image.Image {
+	if !opts.enabled() {
+		return img
+	}
+
+	src := img.Bounds()
+	srcW := float64(src.Dx())
+	srcH := float64(src.Dy())
+	if srcW == 0 || srcH == 0 {
+		return img
+	}
+
+	width, height := resizedSize(src, opts)
+	canvas := image.Rect(0, 0, width, height)
+	if opts.Width == 0 || opts.Height == 0 {
+		return scaleInto(img, src, canvas, canvas)
+	}
+
+	switch opts.Fit {
+	case ResizeFitFill:
+		return scaleInto(img, src, canvas, canvas)
+	case ResizeFitContain:
+		scale := math.Min(float64(width)/srcW, float64(height)/srcH)
+		w := max(int(math.Round(srcW*scale)), 1)
+		h := max(int(math.Round(srcH*scale)), 1)
+		offsetX := (width - w) / 2
+		offsetY := (height - h) / 2
+		return scaleInto(img, src, canvas, image.Rect(offsetX, offsetY, offsetX+w, offsetY+h))
+	default:
+		scale := math.Max(float64(width)/srcW, float64(height)/srcH)
+		cropW := min(int(math.Round(float64(width)/scale)), src.Dx())
+		cropH := min(int(math.Round(float64(height)/scale)), src.Dy())
+		x0 := src.Min.X + (src.Dx()-cropW)/2
+		y0 := src.Min.Y + (src.Dy()-cropH)/2
+		return scaleInto(img, image.Rect(x0, y0, x0+cropW, y0+cropH), canvas, canvas)
+	}
+}
+
+func scaleInto(img image.Image, srcRect image.Rectangle, canvas image.Rectangle, dstRect image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(canvas)
+	draw.CatmullRom.Scale(dst, dstRect, img, srcRect, draw.Src, nil)
+	return dst
+}
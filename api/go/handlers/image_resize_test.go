@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResizeOptions(t *testing.T) {
+	t.Run("Preset", func(t *testing.T) {
+		opts, err := parseResizeOptions("4K", "", "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, ResizeOptions{Width: 3840, Height: 2160, Fit: ResizeFitCover}, opts)
+	})
+
+	t.Run("Explicit dimension overrides preset", func(t *testing.T) {
+		opts, err := parseResizeOptions("1080p", "1280", "", "contain")
+		assert.NoError(t, err)
+		assert.Equal(t, ResizeOptions{Width: 1280, Height: 1080, Fit: ResizeFitContain}, opts)
+	})
+
+	t.Run("No resize requested", func(t *testing.T) {
+		opts, err := parseResizeOptions("", "", "", "")
+		assert.NoError(t, err)
+		assert.False(t, opts.enabled())
+	})
+
+	t.Run("Rejects invalid values", func(t *testing.T) {
+		_, err := parseResizeOptions("8k", "", "", "")
+		assert.Error(t, err)
+		_, err = parseResizeOptions("", "-5", "", "")
+		assert.Error(t, err)
+		_, err = parseResizeOptions("", "", "99999", "")
+		assert.Error(t, err)
+		_, err = parseResizeOptions("", "100", "100", "stretch")
+		assert.Error(t, err)
+	})
+}
+
+func TestResizeImage(t *testing.T) {
+	src := createTestImage(400, 200)
+
+	t.Run("Single dimension keeps aspect ratio", func(t *testing.T) {
+		out := resizeImage(src, ResizeOptions{Width: 100, Fit: ResizeFitCover})
+		assert.Equal(t, image.Rect(0, 0, 100, 50), out.Bounds())
+
+		out = resizeImage(src, ResizeOptions{Height: 100, Fit: ResizeFitCover})
+		assert.Equal(t, image.Rect(0, 0, 200, 100), out.Bounds())
+	})
+
+	t.Run("Derived dimension is capped", func(t *testing.T) {
+		tall := image.Rect(0, 0, 1, 10000)
+		width, height := resizedSize(tall, ResizeOptions{Width: maxResizeDimension, Fit: ResizeFitCover})
+		assert.Equal(t, 1, width)
+		assert.Equal(t, maxResizeDimension, height)
+
+		wide := image.Rect(0, 0, 40000, 100)
+		width, height = resizedSize(wide, ResizeOptions{Height: 1000, Fit: ResizeFitCover})
+		assert.Equal(t, maxResizeDimension, width)
+		assert.Equal(t, 20, height)
+
+		out := resizeImage(createTestImage(1, 2000), ResizeOptions{Width: 100, Fit: ResizeFitCover})
+		assert.Equal(t, image.Rect(0, 0, 4, maxResizeDimension), out.Bounds())
+	})
+
+	t.Run("Cover crops to exact size", func(t *testing.T) {
+		out := resizeImage(src, ResizeOptions{Width: 100, Height: 100, Fit: ResizeFitCover})
+		assert.Equal(t, image.Rect(0, 0, 100, 100), out.Bounds())
+		assert.Equal(t, uint8(255), toTestRGBA(out.At(0, 0)).A)
+	})
+
+	t.Run("Contain letterboxes with transparency", func(t *testing.T) {
+		out := resizeImage(src, ResizeOptions{Width: 100, Height: 100, Fit: ResizeFitContain})
+		assert.Equal(t, image.Rect(0, 0, 100, 100), out.Bounds())
+		assert.Equal(t, uint8(0), toTestRGBA(out.At(50, 0)).A)
+		assert.Equal(t, uint8(255), toTestRGBA(out.At(50, 50)).A)
+	})
+
+	t.Run("Fill stretches", func(t *testing.T) {
+		out := resizeImage(src, ResizeOptions{Width: 50, Height: 80, Fit: ResizeFitFill})
+		assert.Equal(t, image.Rect(0, 0, 50, 80), out.Bounds())
+		assert.Equal(t, uint8(255), toTestRGBA(out.At(25, 0)).A)
+	})
+
+	t.Run("Disabled returns source", func(t *testing.T) {
+		out := resizeImage(src, ResizeOptions{Fit: ResizeFitCover})
+		assert.Same(t, src, out)
+	})
+}
+
+func toTestRGBA(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
@@ -3,13 +3,16 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"themesmith/auth"
 	"themesmith/db"
@@ -18,16 +21,38 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaletteData struct {
-	ID        string        `json:"id"`
-	Name      string        `json:"name"`
-	Palette   []model.Color `json:"palette"`
-	CreatedAt time.Time     `json:"createdAt"`
-	IsSystem  bool          `json:"isSystem"`
-	IsShared  bool          `json:"isShared"`
-	SharedAt  *time.Time    `json:"sharedAt"`
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Palette          []model.Color `json:"palette"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	IsSystem         bool          `json:"isSystem"`
+	IsShared         bool          `json:"isShared"`
+	SharedAt         *time.Time    `json:"sharedAt"`
+	Version          int           `json:"version"`
+	ForkedFromID     string        `json:"forkedFromId,omitempty"`
+	ForkedFromUserID *uint         `json:"forkedFromUserId,omitempty"`
+	ForkCount        int           `json:"forkCount"`
+}
+
+func newPaletteData(row model.Palette, colors []model.Color) PaletteData {
+	return PaletteData{
+		ID:               fmt.Sprintf("%d", row.ID),
+		Name:             row.Name,
+		Palette:          colors,
+		CreatedAt:        row.CreatedAt,
+		IsSystem:         row.IsSystem,
+		IsShared:         row.IsShared,
+		SharedAt:         row.SharedAt,
+		Version:          row.Version,
+		ForkedFromID:     formatSharedItemID(SharedItemKindPalette, row.ForkedFromID),
+		ForkedFromUserID: row.ForkedFromUserID,
+		ForkCount:        row.ForkCount,
+	}
 }
 
 type SavePaletteRequest struct {
@@ -106,6 +131,51 @@ func SavePalettesBatchHandler(c *gin.Context) {
 	})
 }
 
+// UpdatePaletteHandler replaces the name and colors of a saved palette. The
+// If-Match header must name the palette's current version.
+func UpdatePaletteHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to update palettes"})
+		return
+	}
+
+	ifMatch, err := requireIfMatch(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	var req SavePaletteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	palette, err := updateUserPalette(userID, c.Param("id"), ifMatch, req.Name, req.Palette)
+	if errors.Is(err, errStaleVersion) {
+		var colors []model.Color
+		if err := json.Unmarshal([]byte(palette.JsonData), &colors); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode palette"})
+			return
+		}
+		respondStaleVersion(c, palette.Version, "palette", newPaletteData(palette, colors))
+		return
+	}
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(palette.Version))
+	c.JSON(http.StatusOK, gin.H{"message": "Palette updated successfully", "palette": newPaletteData(palette, req.Palette)})
+}
+
 func GetPalettesHandler(c *gin.Context) {
 	userID, err := auth.GetUserFromRequest(c)
 	if err != nil {
@@ -234,6 +304,40 @@ func saveUserPalette(userID uint, name string, palette []model.Color) error {
 	return db.DB.Create(&dbPalette).Error
 }
 
+// updateUserPalette overwrites a palette if ifMatch names its current
+// version. On errStaleVersion the returned palette is the current server copy.
+func updateUserPalette(userID uint, paletteID string, ifMatch string, name string, palette []model.Color) (model.Palette, error) {
+	paletteJSON, err := json.Marshal(palette)
+	if err != nil {
+		return model.Palette{}, err
+	}
+
+	var dbPalette model.Palette
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", paletteID, userID).First(&dbPalette).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &statusError{Status: http.StatusNotFound, Message: "palette not found"}
+			}
+			return err
+		}
+		if !ifMatchVersion(ifMatch, dbPalette.Version) {
+			return errStaleVersion
+		}
+		dbPalette.Name = name
+		dbPalette.JsonData = string(paletteJSON)
+		dbPalette.Version++
+		dbPalette.UpdatedAt = time.Now().UTC()
+		return tx.Save(&dbPalette).Error
+	})
+	if errors.Is(err, errStaleVersion) {
+		return dbPalette, err
+	}
+	if err != nil {
+		return model.Palette{}, err
+	}
+	return dbPalette, nil
+}
+
 func saveUserPalettesBatch(userID uint, palettes []SavePalettesBatchItem) error {
 	if db.DB == nil {
 		return fmt.Errorf("database not available")
@@ -276,15 +380,7 @@ func getUserPalettes(userID uint) ([]PaletteData, error) {
 			continue
 		}
 
-		palettes[i] = PaletteData{
-			ID:        fmt.Sprintf("%d", dbPalette.ID),
-			Name:      dbPalette.Name,
-			Palette:   colors,
-			CreatedAt: dbPalette.CreatedAt,
-			IsSystem:  dbPalette.IsSystem,
-			IsShared:  dbPalette.IsShared,
-			SharedAt:  dbPalette.SharedAt,
-		}
+		palettes[i] = newPaletteData(dbPalette, colors)
 	}
 
 	return palettes, nil
@@ -353,15 +449,7 @@ func setPaletteShared(userID uint, paletteID string, shared bool) (PaletteData,
 		return PaletteData{}, err
 	}
 
-	return PaletteData{
-		ID:        fmt.Sprintf("%d", dbPalette.ID),
-		Name:      dbPalette.Name,
-		Palette:   colors,
-		CreatedAt: dbPalette.CreatedAt,
-		IsSystem:  dbPalette.IsSystem,
-		IsShared:  dbPalette.IsShared,
-		SharedAt:  dbPalette.SharedAt,
-	}, nil
+	return newPaletteData(dbPalette, colors), nil
 }
 
 func processImageWithShepardsMethod(
@@ -422,34 +510,135 @@ type ExtractResult struct {
 }
 
 func ApplyPaletteHandler(c *gin.Context) {
+	limits := loadImageLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxRequestBytes)
+
+	sourceHash := c.PostForm("sourceHash")
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
-		return
+		if limitErr, ok := limits.asRequestTooLarge(err); ok {
+			respondImageLimitError(c, limitErr)
+			return
+		}
+		if sourceHash == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+			return
+		}
+		fileHeader = nil
 	}
-	file, err := fileHeader.Open()
+
+	params, err := parseApplyPaletteParams(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open uploaded file: " + err.Error()})
+		respondStatusError(c, err)
 		return
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			_ = c.Error(err)
+
+	var data []byte
+	if fileHeader != nil {
+		data, err = readUploadedImage(fileHeader, limits)
+		if err != nil {
+			respondStatusError(c, err)
+			return
 		}
-	}()
+		sourceHash = storeSourceImage(data)
+	} else {
+		cached, ok := applyPaletteSourceCache().Get(sourceHash)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source image is no longer cached; upload the file again"})
+			return
+		}
+		data = cached.Data
+	}
+
+	serveRecolor(c, data, sourceHash, params, limits)
+}
+
+func GetAppliedPaletteHandler(c *gin.Context) {
+	key := strings.ToLower(c.Param("hash"))
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Result hash is required"})
+		return
+	}
+
+	cached, ok := applyPaletteResultCache().Get(key)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found in cache"})
+		return
+	}
+
+	c.Header("ETag", quoteETag(key))
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), key) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	mode := RecolorMetricsOff
+	if cached.Metrics != nil {
+		mode = RecolorMetricsHeaders
+	}
+	writeRecolorResult(c, cached, mode)
+}
+
+type applyPaletteParams struct {
+	Palette       []color.RGBA
+	Luminosity    float64
+	Nearest       int
+	Power         float64
+	MaxDistanceSq float64
+	Resize        ResizeOptions
+	Output        OutputOptions
+	Metrics       RecolorMetricsMode
+}
+
+type statusError struct {
+	Status  int
+	Message string
+}
+
+func (e *statusError) Error() string {
+	return e.Message
+}
+
+func badRequestError(message string) *statusError {
+	return &statusError{Status: http.StatusBadRequest, Message: message}
+}
+
+func respondStatusError(c *gin.Context, err error) {
+	var limitErr *ImageLimitError
+	if errors.As(err, &limitErr) {
+		respondImageLimitError(c, limitErr)
+		return
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		c.JSON(statusErr.Status, gin.H{"error": statusErr.Message})
+		return
+	}
 
+	var rateLimitErr *upstreamRateLimitedError
+	if errors.As(err, &rateLimitErr) {
+		retryAfter := rateLimitErr.retryAfterSeconds()
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": rateLimitErr.Error(), "retryAfter": retryAfter})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func parseApplyPaletteParams(c *gin.Context) (applyPaletteParams, error) {
 	paletteStr := c.PostForm("palette")
 	if paletteStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Palette is required (JSON array of hex strings or [{\"hex\":\"#RRGGBB\"}])"})
-		return
+		return applyPaletteParams{}, badRequestError("Palette is required (JSON array of hex strings or [{\"hex\":\"#RRGGBB\"}])")
 	}
 
 	var hexes []string
 	if err := json.Unmarshal([]byte(paletteStr), &hexes); err != nil {
 		var objs []model.Color
 		if err2 := json.Unmarshal([]byte(paletteStr), &objs); err2 != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid palette JSON"})
-			return
+			return applyPaletteParams{}, badRequestError("Invalid palette JSON")
 		}
 		for _, o := range objs {
 			hexes = append(hexes, o.Hex)
@@ -463,48 +652,149 @@ func ApplyPaletteHandler(c *gin.Context) {
 		}
 	}
 	if len(paletteRGBAs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Palette contained no valid colors"})
-		return
+		return applyPaletteParams{}, badRequestError("Palette contained no valid colors")
+	}
+
+	params := applyPaletteParams{
+		Palette:    paletteRGBAs,
+		Luminosity: 1.0,
+		Nearest:    30,
+		Power:      4.0,
+		Metrics:    parseRecolorMetricsMode(c.PostForm("metrics")),
 	}
 
-	luminosity := 1.0
 	if s := c.PostForm("luminosity"); s != "" {
 		if v, err := strconv.ParseFloat(s, 64); err == nil && v > 0 {
-			luminosity = v
+			params.Luminosity = v
 		}
 	}
-	nearest := 30
 	if s := c.PostForm("nearest"); s != "" {
 		if v, err := strconv.Atoi(s); err == nil && v >= 1 {
-			nearest = v
+			params.Nearest = v
 		}
 	}
-	power := 4.0
 	if s := c.PostForm("power"); s != "" {
 		if v, err := strconv.ParseFloat(s, 64); err == nil && v > 0 {
-			power = v
+			params.Power = v
 		}
 	}
-
-	maxDistanceSq := 0.0
 	if s := c.PostForm("maxDistance"); s != "" {
 		if v, err := strconv.ParseFloat(s, 64); err == nil && v > 0 {
-			maxDistanceSq = v * v
+			params.MaxDistanceSq = v * v
 		}
 	}
 
-	img, _, err := image.Decode(file)
+	resizeOpts, err := parseResizeOptions(c.PostForm("preset"), c.PostForm("width"), c.PostForm("height"), c.PostForm("fit"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to decode image: " + err.Error()})
+		return applyPaletteParams{}, badRequestError(err.Error())
+	}
+	params.Resize = resizeOpts
+
+	outputOpts, err := parseOutputOptions(c.PostForm("format"), c.PostForm("quality"), c.PostForm("stripMetadata"))
+	if err != nil {
+		return applyPaletteParams{}, badRequestError(err.Error())
+	}
+	params.Output = outputOpts
+
+	return params, nil
+}
+
+func readUploadedImage(fileHeader *multipart.FileHeader, limits ImageLimits) ([]byte, error) {
+	if limitErr := limits.checkEncodedSize(fileHeader.Size); limitErr != nil {
+		return nil, limitErr
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, &statusError{Status: http.StatusInternalServerError, Message: "Failed to open uploaded file: " + err.Error()}
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, badRequestError("Failed to read uploaded file: " + err.Error())
+	}
+	return data, nil
+}
+
+// serveRecolor answers from the result cache when it can and otherwise runs the
+// recolor pipeline on data, caching the encoded output under its content hash.
+func serveRecolor(c *gin.Context, data []byte, sourceHash string, params applyPaletteParams, limits ImageLimits) {
+	key := params.cacheKey(sourceHash)
+	c.Header("ETag", quoteETag(key))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header(headerSourceHash, sourceHash)
+
+	if etagMatches(c.GetHeader("If-None-Match"), key) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	out := processImageWithShepardsMethod(img, paletteRGBAs, luminosity, nearest, power, maxDistanceSq)
+	results := applyPaletteResultCache()
+	if cached, ok := results.Get(key); ok && (params.Metrics == RecolorMetricsOff || cached.Metrics != nil) {
+		writeRecolorResult(c, cached, params.Metrics)
+		return
+	}
 
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, out); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode PNG: " + err.Error()})
+	result, err := recolorImageData(data, params, limits)
+	if err != nil {
+		respondStatusError(c, err)
 		return
 	}
-	c.Data(http.StatusOK, "image/png", buf.Bytes())
+	results.Add(key, result)
+
+	writeRecolorResult(c, result, params.Metrics)
+}
+
+func recolorImageData(data []byte, params applyPaletteParams, limits ImageLimits) (cachedImage, error) {
+	if err := limits.checkDecodedSize(data); err != nil {
+		var limitErr *ImageLimitError
+		if errors.As(err, &limitErr) {
+			return cachedImage{}, limitErr
+		}
+		return cachedImage{}, badRequestError("Failed to decode image: " + err.Error())
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return cachedImage{}, badRequestError("Failed to decode image: " + err.Error())
+	}
+
+	meta := readImageMetadata(data)
+	img = applyOrientation(img, meta.Orientation)
+	if limitErr := limits.checkResizedSize(resizedSize(img.Bounds(), params.Resize)); limitErr != nil {
+		return cachedImage{}, limitErr
+	}
+	img = resizeImage(img, params.Resize)
+
+	out := processImageWithShepardsMethod(img, params.Palette, params.Luminosity, params.Nearest, params.Power, params.MaxDistanceSq)
+
+	encoded, err := encodeRecolorOutput(out, params.Output, meta)
+	if err != nil {
+		return cachedImage{}, err
+	}
+
+	result := cachedImage{Data: encoded, ContentType: params.Output.contentType()}
+	if params.Metrics != RecolorMetricsOff {
+		metrics := computeRecolorMetrics(img, out, params.Palette, params.MaxDistanceSq)
+		result.Metrics = &metrics
+	}
+
+	return result, nil
+}
+
+func writeRecolorResult(c *gin.Context, result cachedImage, mode RecolorMetricsMode) {
+	switch mode {
+	case RecolorMetricsHeaders:
+		if result.Metrics != nil {
+			setRecolorMetricsHeaders(c, *result.Metrics)
+		}
+	case RecolorMetricsMultipart:
+		if result.Metrics != nil {
+			writeRecolorMultipart(c, result.Data, result.ContentType, *result.Metrics)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, result.ContentType, result.Data)
 }
@@ -62,3 +62,45 @@ func TestProcessImageWithShepardsMethod(t *testing.T) {
 		assert.Equal(t, uint8(0), rgba2.A)
 	})
 }
+
+func TestComputeRecolorMetrics(t *testing.T) {
+	palette := []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.RGBA{250, 5, 5, 255})
+	img.Set(1, 0, color.RGBA{5, 5, 250, 255})
+	img.Set(2, 0, color.RGBA{0, 255, 0, 255})
+	img.Set(3, 0, color.RGBA{0, 0, 0, 0})
+
+	t.Run("Counts untouched pixels and palette usage", func(t *testing.T) {
+		maxDistanceSq := 50.0 * 50.0
+		out := processImageWithShepardsMethod(img, palette, 1.0, 1, 2.0, maxDistanceSq)
+		metrics := computeRecolorMetrics(img, out, palette, maxDistanceSq)
+
+		assert.Equal(t, 3, metrics.PixelCount)
+		assert.InDelta(t, 1.0/3.0, metrics.UntouchedRatio, 1e-9)
+		assert.Equal(t, "#FF0000", metrics.PaletteUsage[0].Hex)
+		assert.Equal(t, 1, metrics.PaletteUsage[0].Pixels)
+		assert.Equal(t, 1, metrics.PaletteUsage[1].Pixels)
+		assert.InDelta(t, 0.5, metrics.PaletteUsage[0].Share, 1e-9)
+		assert.Greater(t, metrics.DeltaEMean, 0.0)
+		assert.GreaterOrEqual(t, metrics.DeltaEP95, metrics.DeltaEMean)
+	})
+
+	t.Run("Identity recolor has no drift", func(t *testing.T) {
+		same := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		for y := range 2 {
+			for x := range 2 {
+				same.Set(x, y, palette[0])
+			}
+		}
+
+		out := processImageWithShepardsMethod(same, palette, 1.0, 2, 2.0, 0)
+		metrics := computeRecolorMetrics(same, out, palette, 0)
+
+		assert.Equal(t, 4, metrics.PixelCount)
+		assert.Equal(t, 0.0, metrics.DeltaEMean)
+		assert.Equal(t, 0.0, metrics.DeltaEP95)
+		assert.Equal(t, 4, metrics.PaletteUsage[0].Pixels)
+	})
+}
@@ -10,10 +10,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PreferencesResponse struct {
 	Preferences json.RawMessage `json:"preferences"`
+	Version     int             `json:"version,omitempty"`
 }
 
 func GetPreferencesHandler(c *gin.Context) {
@@ -38,9 +40,13 @@ func GetPreferencesHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, PreferencesResponse{Preferences: json.RawMessage(prefs.JsonData)})
+	c.Header("ETag", versionETag(prefs.Version))
+	c.JSON(http.StatusOK, PreferencesResponse{Preferences: json.RawMessage(prefs.JsonData), Version: prefs.Version})
 }
 
+// SavePreferencesHandler creates or replaces the caller's preferences.
+// Replacing existing preferences requires If-Match with their version; a save
+// without one, or with an old one, gets the current preferences back.
 func SavePreferencesHandler(c *gin.Context) {
 	if db.DB == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
@@ -59,28 +65,53 @@ func SavePreferencesHandler(c *gin.Context) {
 		return
 	}
 
+	ifMatch := c.GetHeader("If-Match")
 	var prefs model.UserPreferences
-	if err := db.DB.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
-			return
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&prefs).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			prefs = model.UserPreferences{
+				UserID:   userID,
+				JsonData: string(payload),
+			}
+			// There is no row to lock yet, so two first saves can race. The
+			// one that loses reads the winner's row and is told it is stale.
+			created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&prefs)
+			if created.Error != nil || created.RowsAffected > 0 {
+				return created.Error
+			}
+			if err := tx.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+				return err
+			}
+			return errStaleVersion
+		}
+		if err != nil {
+			return err
 		}
 
-		prefs = model.UserPreferences{
-			UserID:   userID,
-			JsonData: string(payload),
+		if ifMatch == "" {
+			return errIfMatchRequired
 		}
-		if err := db.DB.Create(&prefs).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
-			return
+		if !ifMatchVersion(ifMatch, prefs.Version) {
+			return errStaleVersion
 		}
-	} else {
 		prefs.JsonData = string(payload)
-		if err := db.DB.Save(&prefs).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
-			return
-		}
+		prefs.Version++
+		return tx.Save(&prefs).Error
+	})
+	if errors.Is(err, errStaleVersion) {
+		respondStaleVersion(c, prefs.Version, "preferences", json.RawMessage(prefs.JsonData))
+		return
+	}
+	if errors.Is(err, errIfMatchRequired) {
+		respondIfMatchRequired(c, prefs.Version, "preferences", json.RawMessage(prefs.JsonData))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
+		return
 	}
 
-	c.JSON(http.StatusOK, PreferencesResponse{Preferences: json.RawMessage(prefs.JsonData)})
+	c.Header("ETag", versionETag(prefs.Version))
+	c.JSON(http.StatusOK, PreferencesResponse{Preferences: json.RawMessage(prefs.JsonData), Version: prefs.Version})
 }
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"runtime"
+	"strings"
+	"sync"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecolorMetricsMode string
+
+const (
+	RecolorMetricsOff       RecolorMetricsMode = ""
+	RecolorMetricsHeaders   RecolorMetricsMode = "headers"
+	RecolorMetricsMultipart RecolorMetricsMode = "multipart"
+)
+
+const (
+	headerDeltaEMean     = "X-ThemeSmith-DeltaE-Mean"
+	headerDeltaEP95      = "X-ThemeSmith-DeltaE-P95"
+	headerUntouchedRatio = "X-ThemeSmith-Untouched-Ratio"
+	headerPixelCount     = "X-ThemeSmith-Pixel-Count"
+	headerPaletteUsage   = "X-ThemeSmith-Palette-Usage"
+)
+
+var recolorMetricsHeaders = []string{
+	headerDeltaEMean,
+	headerDeltaEP95,
+	headerUntouchedRatio,
+	headerPixelCount,
+	headerPaletteUsage,
+}
+
+// ΔE2000 values are bucketed at this resolution to compute percentiles
+// without keeping one float per pixel around.
+const (
+	deltaEHistogramStep = 0.01
+	deltaEHistogramMax  = 120.0
+)
+
+type PaletteColorUsage struct {
+	Hex    string  `json:"hex"`
+	Pixels int     `json:"pixels"`
+	Share  float64 `json:"share"`
+}
+
+type RecolorMetrics struct {
+	PixelCount     int                 `json:"pixelCount"`
+	DeltaEMean     float64             `json:"deltaEMean"`
+	DeltaEP95      float64             `json:"deltaEP95"`
+	UntouchedRatio float64             `json:"untouchedRatio"`
+	PaletteUsage   []PaletteColorUsage `json:"paletteUsage"`
+}
+
+type recolorMetricsAccumulator struct {
+	pixels    int
+	untouched int
+	sumDeltaE float64
+	histogram []int
+	usage     []int
+}
+
+func newRecolorMetricsAccumulator(paletteSize int) *recolorMetricsAccumulator {
+	return &recolorMetricsAccumulator{
+		histogram: make([]int, int(deltaEHistogramMax/deltaEHistogramStep)+1),
+		usage:     make([]int, paletteSize),
+	}
+}
+
+func (a *recolorMetricsAccumulator) merge(other *recolorMetricsAccumulator) {
+	a.pixels += other.pixels
+	a.untouched += other.untouched
+	a.sumDeltaE += other.sumDeltaE
+	for i, n := range other.histogram {
+		a.histogram[i] += n
+	}
+	for i, n := range other.usage {
+		a.usage[i] += n
+	}
+}
+
+func (a *recolorMetricsAccumulator) percentile(p float64) float64 {
+	if a.pixels == 0 {
+		return 0
+	}
+
+	target := int(float64(a.pixels)*p + 0.5)
+	target = max(target, 1)
+
+	seen := 0
+	for i, n := range a.histogram {
+		seen += n
+		if seen >= target {
+			return float64(i) * deltaEHistogramStep
+		}
+	}
+	return deltaEHistogramMax
+}
+
+func parseRecolorMetricsMode(raw string) RecolorMetricsMode {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "1", "true", "yes", string(RecolorMetricsHeaders):
+		return RecolorMetricsHeaders
+	case string(RecolorMetricsMultipart):
+		return RecolorMetricsMultipart
+	default:
+		return RecolorMetricsOff
+	}
+}
+
+// computeRecolorMetrics compares the source image with its recolored output.
+// Pixels skipped by the maxDistance cutoff count as untouched, and palette usage
+// attributes every recolored pixel to the palette color nearest its output value.
+func computeRecolorMetrics(src image.Image, out *image.RGBA, paletteRGBAs []color.RGBA, maxDistanceSq float64) RecolorMetrics {
+	bounds := src.Bounds()
+	height := bounds.Dy()
+
+	numWorkers := max(min(runtime.GOMAXPROCS(0), height), 1)
+	rowsPerWorker := (height + numWorkers - 1) / numWorkers
+
+	partials := make([]*recolorMetricsAccumulator, numWorkers)
+	var wg sync.WaitGroup
+	for workerID := range numWorkers {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			acc := newRecolorMetricsAccumulator(len(paletteRGBAs))
+			partials[id] = acc
+
+			startY := bounds.Min.Y + id*rowsPerWorker
+			endY := min(startY+rowsPerWorker, bounds.Max.Y)
+
+			for y := startY; y < endY; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					original := utils.ToRGBA(src.At(x, y))
+					if original.A == 0 {
+						continue
+					}
+					acc.pixels++
+
+					if maxDistanceSq > 0 && utils.NearestDistanceSquared(original, paletteRGBAs) > maxDistanceSq {
+						acc.untouched++
+						acc.histogram[0]++
+						continue
+					}
+
+					recolored := out.RGBAAt(x, y)
+					deltaE := utils.DeltaE2000(utils.RGBToLab(original), utils.RGBToLab(recolored))
+					acc.sumDeltaE += deltaE
+
+					bucket := min(int(deltaE/deltaEHistogramStep), len(acc.histogram)-1)
+					acc.histogram[bucket]++
+
+					if idx := utils.NearestPaletteIndex(recolored, paletteRGBAs); idx >= 0 {
+						acc.usage[idx]++
+					}
+				}
+			}
+		}(workerID)
+	}
+	wg.Wait()
+
+	total := newRecolorMetricsAccumulator(len(paletteRGBAs))
+	for _, partial := range partials {
+		total.merge(partial)
+	}
+
+	metrics := RecolorMetrics{
+		PixelCount:   total.pixels,
+		DeltaEP95:    total.percentile(0.95),
+		PaletteUsage: make([]PaletteColorUsage, len(paletteRGBAs)),
+	}
+
+	recolored := total.pixels - total.untouched
+	if total.pixels > 0 {
+		metrics.DeltaEMean = total.sumDeltaE / float64(total.pixels)
+		metrics.UntouchedRatio = float64(total.untouched) / float64(total.pixels)
+	}
+
+	for i, p := range paletteRGBAs {
+		usage := PaletteColorUsage{
+			Hex:    fmt.Sprintf("#%02X%02X%02X", p.R, p.G, p.B),
+			Pixels: total.usage[i],
+		}
+		if recolored > 0 {
+			usage.Share = float64(total.usage[i]) / float64(recolored)
+		}
+		metrics.PaletteUsage[i] = usage
+	}
+
+	return metrics
+}
+
+func setRecolorMetricsHeaders(c *gin.Context, metrics RecolorMetrics) {
+	c.Header(headerPixelCount, fmt.Sprintf("%d", metrics.PixelCount))
+	c.Header(headerDeltaEMean, fmt.Sprintf("%.4f", metrics.DeltaEMean))
+	c.Header(headerDeltaEP95, fmt.Sprintf("%.4f", metrics.DeltaEP95))
+	c.Header(headerUntouchedRatio, fmt.Sprintf("%.6f", metrics.UntouchedRatio))
+
+	if usage, err := json.Marshal(metrics.PaletteUsage); err == nil {
+		c.Header(headerPaletteUsage, string(usage))
+	}
+}
+
+func writeRecolorMultipart(c *gin.Context, imageBytes []byte, contentType string, metrics RecolorMetrics) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	imageHeader := textproto.MIMEHeader{}
+	imageHeader.Set("Content-Type", contentType)
+	imageHeader.Set("Content-Disposition", `inline; name="image"`)
+	imagePart, err := writer.CreatePart(imageHeader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build multipart response"})
+		return
+	}
+	if _, err := imagePart.Write(imageBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build multipart response"})
+		return
+	}
+
+	metricsHeader := textproto.MIMEHeader{}
+	metricsHeader.Set("Content-Type", "application/json")
+	metricsHeader.Set("Content-Disposition", `inline; name="metrics"`)
+	metricsPart, err := writer.CreatePart(metricsHeader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build multipart response"})
+		return
+	}
+	if err := json.NewEncoder(metricsPart).Encode(metrics); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode metrics"})
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build multipart response"})
+		return
+	}
+
+	c.Data(http.StatusOK, "multipart/mixed; boundary="+writer.Boundary(), body.Bytes())
+}
@@ -15,8 +15,8 @@ func NewRouter() *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://wails.localhost:9245"},
 		AllowMethods:     []string{"POST", "GET", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match", "If-None-Match", "X-API-Key"},
+		ExposeHeaders:    append([]string{"Content-Length", "Content-Disposition", "ETag", "Retry-After", headerSourceHash, headerCacheStatus}, recolorMetricsHeaders...),
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -35,30 +35,79 @@ func NewRouter() *gin.Engine {
 		authGroup.POST("/change-password", auth.ChangePasswordHandler)
 		authGroup.GET("/preferences", GetPreferencesHandler)
 		authGroup.PUT("/preferences", SavePreferencesHandler)
+		authGroup.GET("/wallhaven-key", GetWallhavenKeyHandler)
+		authGroup.PUT("/wallhaven-key", SetWallhavenKeyHandler)
+		authGroup.POST("/wallhaven-key/test", VerifyWallhavenKeyHandler)
+		authGroup.DELETE("/wallhaven-key", DeleteWallhavenKeyHandler)
+		authGroup.GET("/theme-revision-limit", GetThemeRevisionLimitHandler)
+		authGroup.PUT("/theme-revision-limit", SetThemeRevisionLimitHandler)
 	}
 
 	router.GET("/palettes", GetPalettesHandler)
 	router.POST("/palettes/batch", SavePalettesBatchHandler)
 	router.POST("/palettes", SavePaletteHandler)
+	router.PUT("/palettes/:id", UpdatePaletteHandler)
 	router.POST("/palettes/:id/share", SharePaletteHandler)
 	router.DELETE("/palettes/:id/share", UnsharePaletteHandler)
+	router.GET("/palettes/:id/terminal", PaletteTerminalHandler)
+	router.GET("/palettes/:id/kde", PaletteKDEHandler)
+	router.GET("/palettes/:id/gtk", PaletteGTKHandler)
+	router.GET("/palettes/:id/xresources", PaletteXresourcesHandler)
+	router.GET("/palettes/:id/base16", PaletteBase16Handler)
+	router.GET("/palettes/:id/base24", PaletteBase24Handler)
+	router.GET("/palettes/:id/pywal", PalettePywalHandler)
 	router.DELETE("/palettes/:id", DeletePaletteHandler)
 	router.DELETE("/palettes", DeletePalettesBatchHandler)
 
 	router.GET("/themes", GetThemesHandler)
 	router.POST("/themes/batch", SaveThemesBatchHandler)
+	router.POST("/themes/import", ImportThemesHandler)
+	router.POST("/themes/diff", DiffThemesHandler)
 	router.POST("/themes", SaveThemeHandler)
 	router.POST("/themes/:id/share", ShareThemeHandler)
 	router.DELETE("/themes/:id/share", UnshareThemeHandler)
+	router.GET("/themes/vsix", ThemesVSIXHandler)
+	router.GET("/themes/:id/vsix", ThemeVSIXHandler)
+	router.GET("/themes/zed-extension", ThemesZedExtensionHandler)
+	router.GET("/themes/:id/zed-extension", ThemeZedExtensionHandler)
+	router.GET("/themes/jetbrains", ThemesJetBrainsHandler)
+	router.GET("/themes/:id/jetbrains", ThemeJetBrainsHandler)
+	router.GET("/themes/:id/neovim", ThemeNeovimHandler)
+	router.GET("/themes/:id/vim", ThemeVimHandler)
+	router.GET("/themes/:id/helix", ThemeHelixHandler)
+	router.GET("/themes/:id/sublime", ThemeSublimeHandler)
+	router.GET("/themes/:id/emacs", ThemeEmacsHandler)
+	router.GET("/themes/:id/terminal", ThemeTerminalHandler)
+	router.GET("/themes/:id/kde", ThemeKDEHandler)
+	router.GET("/themes/:id/gtk", ThemeGTKHandler)
+	router.GET("/themes/:id/xresources", ThemeXresourcesHandler)
+	router.GET("/themes/:id/base16", ThemeBase16Handler)
+	router.GET("/themes/:id/base24", ThemeBase24Handler)
+	router.GET("/themes/:id/pywal", ThemePywalHandler)
+	router.GET("/themes/:id/revisions", ListThemeRevisionsHandler)
+	router.GET("/themes/:id/revisions/diff", DiffThemeRevisionsHandler)
+	router.GET("/themes/:id/revisions/:revision", GetThemeRevisionHandler)
+	router.POST("/themes/:id/revisions/:revision/revert", RevertThemeRevisionHandler)
+	router.POST("/themes/:id/convert", ConvertThemeHandler)
 	router.PUT("/themes/:id", UpdateThemeHandler)
 	router.DELETE("/themes/:id", DeleteThemeHandler)
 	router.DELETE("/themes", DeleteThemesBatchHandler)
 	router.GET("/shared-items", GetSharedItemsHandler)
+	router.POST("/shared-items/:kind/:id/fork", ForkSharedItemHandler)
 	router.POST("/apply-palette", ApplyPaletteHandler)
+	router.GET("/apply-palette/:hash", GetAppliedPaletteHandler)
 
 	router.GET("/wallhaven/search", WallhavenSearchHandler)
 	router.GET("/wallhaven/w/:id", WallhavenGetWallpaperHandler)
+	router.POST("/wallhaven/w/:id/apply-palette", WallhavenApplyPaletteHandler)
 	router.GET("/wallhaven/download", WallhavenDownloadHandler)
+	router.GET("/wallhaven/thumbnail", WallhavenThumbnailHandler)
+
+	router.GET("/wallpapers/providers", ListWallpaperProvidersHandler)
+	router.GET("/wallpapers/:provider/search", WallpaperSearchHandler)
+	router.GET("/wallpapers/:provider/:id", WallpaperGetHandler)
+	router.GET("/wallpapers/:provider/:id/download", WallpaperDownloadHandler)
+	router.POST("/wallpapers/:provider/:id/apply-palette", WallpaperApplyPaletteHandler)
 	router.GET("/desktop/download", DesktopDownloadHandler)
 
 	return router
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	outboundRequestTimeout  = 30 * time.Second
+	outboundDialTimeout     = 10 * time.Second
+	outboundMaxRedirects    = 5
+	defaultMaxResponseBytes = 5 << 20
+)
+
+var defaultAllowedOutboundHosts = []string{"wallhaven.cc", "w.wallhaven.cc", "th.wallhaven.cc"}
+
+var errBlockedAddress = errors.New("destination address is not allowed")
+
+// blockedPrefixes lists ranges that IsPrivate/IsLoopback and friends do not
+// already cover but that must never be reachable from the proxy.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// outboundTransport is shared by every outbound proxy request. Its dialer
+// re-checks the resolved address of each connection, which also covers
+// redirects and DNS answers that change between lookups.
+var outboundTransport http.RoundTripper = newSafeTransport()
+
+func newSafeTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   outboundDialTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   safeDialControl,
+	}
+
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	}
+}
+
+func safeDialControl(_ string, address string, _ syscall.RawConn) error {
+	if allowPrivateOutbound() {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || isBlockedAddr(addr) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+func isBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowPrivateOutbound lets local development and tests reach servers on
+// loopback or private networks. It must stay off in production.
+func allowPrivateOutbound() bool {
+	v, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS")))
+	return v
+}
+
+// allowedOutboundHosts returns the Wallhaven hosts, the host of a configured
+// WALLHAVEN_API_BASE and any extras listed in WALLHAVEN_EXTRA_HOSTS.
+func allowedOutboundHosts() map[string]struct{} {
+	hosts := map[string]struct{}{}
+	for _, host := range defaultAllowedOutboundHosts {
+		hosts[host] = struct{}{}
+	}
+
+	if u, err := url.Parse(wallhavenBase()); err == nil && u.Hostname() != "" {
+		hosts[strings.ToLower(u.Hostname())] = struct{}{}
+	}
+
+	for host := range strings.SplitSeq(os.Getenv("WALLHAVEN_EXTRA_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = struct{}{}
+		}
+	}
+
+	return hosts
+}
+
+func checkOutboundURL(u *url.URL, allowed map[string]struct{}) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &statusError{Status: http.StatusBadRequest, Message: "invalid url"}
+	}
+	if u.User != nil {
+		return &statusError{Status: http.StatusBadRequest, Message: "invalid url"}
+	}
+	if _, ok := allowed[strings.ToLower(u.Hostname())]; !ok {
+		return &statusError{Status: http.StatusForbidden, Message: fmt.Sprintf("host %q is not allowed", u.Hostname())}
+	}
+	return nil
+}
+
+type fetchOptions struct {
+	Header http.Header
+	// ContentTypes lists accepted media type prefixes for successful
+	// responses. An empty list accepts anything.
+	ContentTypes []string
+	// Limits switches size enforcement to the image limits, reporting
+	// oversized bodies as ImageLimitError. Otherwise MaxBytes applies.
+	Limits   *ImageLimits
+	MaxBytes int64
+}
+
+type fetchedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// CacheStatus is set for responses that went through the Wallhaven cache.
+	CacheStatus string
+}
+
+func (r *fetchedResponse) ContentType() string {
+	return r.Header.Get("Content-Type")
+}
+
+// safeFetch performs a GET against an allowlisted host and returns the whole,
+// size-bounded body. All proxy handlers go through it.
+func safeFetch(ctx context.Context, rawURL string, opts fetchOptions) (*fetchedResponse, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &statusError{Status: http.StatusBadRequest, Message: "invalid url"}
+	}
+
+	allowed := allowedOutboundHosts()
+	if err := checkOutboundURL(u, allowed); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, outboundRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, &statusError{Status: http.StatusBadRequest, Message: "invalid url"}
+	}
+	for key, values := range opts.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+
+	client := &http.Client{
+		Transport: outboundTransport,
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= outboundMaxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkOutboundURL(next.URL, allowed)
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			return nil, statusErr
+		}
+		if errors.Is(err, errBlockedAddress) {
+			return nil, &statusError{Status: http.StatusForbidden, Message: errBlockedAddress.Error()}
+		}
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "failed to contact upstream: " + err.Error()}
+	}
+	defer resp.Body.Close()
+
+	maxBytes := opts.MaxBytes
+	if opts.Limits != nil {
+		maxBytes = opts.Limits.MaxEncodedBytes
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxResponseBytes
+	}
+
+	if resp.ContentLength > maxBytes {
+		return nil, responseTooLarge(opts, maxBytes, resp.ContentLength)
+	}
+
+	if resp.StatusCode == http.StatusOK && len(opts.ContentTypes) > 0 && !hasContentType(resp.Header.Get("Content-Type"), opts.ContentTypes) {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "unexpected upstream content type"}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "failed to read upstream response: " + err.Error()}
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, responseTooLarge(opts, maxBytes, int64(len(body)))
+	}
+
+	return &fetchedResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+func responseTooLarge(opts fetchOptions, maxBytes int64, actual int64) error {
+	if opts.Limits != nil {
+		return opts.Limits.checkEncodedSize(actual)
+	}
+	return &statusError{Status: http.StatusBadGateway, Message: fmt.Sprintf("upstream response exceeds %d bytes", maxBytes)}
+}
+
+func hasContentType(contentType string, accepted []string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, prefix := range accepted {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// formatSharedItemID formats id in the <kind>:<id> form of SharedItem.ID,
+// which is also how every response reports forkedFromId.
+func formatSharedItemID(kind SharedItemKind, id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", kind, *id)
+}
+
+// parseSharedItemRef reads the :kind and :id route parameters. The id may be
+// bare or in the <kind>:<id> form the shared items listing returns.
+func parseSharedItemRef(rawKind string, rawID string) (SharedItemKind, uint, error) {
+	kind := SharedItemKind(strings.ToLower(strings.TrimSpace(rawKind)))
+	if kind != SharedItemKindTheme && kind != SharedItemKindPalette {
+		return "", 0, badRequestError("kind must be theme or palette")
+	}
+	rawID = strings.TrimPrefix(strings.TrimSpace(rawID), string(kind)+":")
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, badRequestError("invalid shared item id")
+	}
+	return kind, uint(id), nil
+}
+
+// ForkSharedItemHandler copies a shared theme or palette into the caller's
+// account. The copy records where it came from, and the original's fork count
+// is incremented in the same transaction.
+func ForkSharedItemHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to fork shared items"})
+		return
+	}
+
+	kind, id, err := parseSharedItemRef(c.Param("kind"), c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	switch kind {
+	case SharedItemKindTheme:
+		theme, err := forkSharedTheme(userID, id)
+		if err != nil {
+			respondStatusError(c, err)
+			return
+		}
+		responseTheme, err := buildThemeResponse(theme, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Theme forked successfully", "theme": responseTheme})
+	case SharedItemKindPalette:
+		palette, err := forkSharedPalette(userID, id)
+		if err != nil {
+			respondStatusError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Palette forked successfully", "palette": palette})
+	}
+}
+
+func forkSharedTheme(userID uint, themeID uint) (model.Theme, error) {
+	var fork model.Theme
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var source model.Theme
+		if err := tx.Where("id = ? AND is_shared = ?", themeID, true).First(&source).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &statusError{Status: http.StatusNotFound, Message: "shared theme not found"}
+			}
+			return err
+		}
+		if source.UserID != nil && *source.UserID == userID {
+			return badRequestError("cannot fork your own theme")
+		}
+
+		// Themes are unique per user, editor type and signature, so a second
+		// fork of the same theme would collide with the first.
+		var existing model.Theme
+		err := tx.Where("user_id = ? AND editor_type = ? AND signature = ?", userID, source.EditorType, source.Signature).First(&existing).Error
+		if err == nil {
+			return &statusError{Status: http.StatusConflict, Message: fmt.Sprintf("theme %d is already in your account", existing.ID)}
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		fork = model.Theme{
+			UserID:           &userID,
+			Name:             source.Name,
+			EditorType:       source.EditorType,
+			Signature:        source.Signature,
+			JsonData:         source.JsonData,
+			ForkedFromID:     &source.ID,
+			ForkedFromUserID: source.UserID,
+		}
+		if err := tx.Create(&fork).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Theme{}).Where("id = ?", source.ID).
+			UpdateColumn("fork_count", gorm.Expr("fork_count + 1")).Error
+	})
+	if err != nil {
+		return model.Theme{}, err
+	}
+	return fork, nil
+}
+
+func forkSharedPalette(userID uint, paletteID uint) (PaletteData, error) {
+	var fork model.Palette
+	var colors []model.Color
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var source model.Palette
+		if err := tx.Where("id = ? AND is_shared = ?", paletteID, true).First(&source).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &statusError{Status: http.StatusNotFound, Message: "shared palette not found"}
+			}
+			return err
+		}
+		if source.UserID != nil && *source.UserID == userID {
+			return badRequestError("cannot fork your own palette")
+		}
+		if err := json.Unmarshal([]byte(source.JsonData), &colors); err != nil {
+			return fmt.Errorf("failed to decode palette %d: %w", source.ID, err)
+		}
+
+		fork = model.Palette{
+			UserID:           &userID,
+			Name:             source.Name,
+			JsonData:         source.JsonData,
+			ForkedFromID:     &source.ID,
+			ForkedFromUserID: source.UserID,
+		}
+		if err := tx.Create(&fork).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Palette{}).Where("id = ?", source.ID).
+			UpdateColumn("fork_count", gorm.Expr("fork_count + 1")).Error
+	})
+	if err != nil {
+		return PaletteData{}, err
+	}
+	return newPaletteData(fork, colors), nil
+}
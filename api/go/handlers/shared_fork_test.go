@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSharedItemRef(t *testing.T) {
+	kind, id, err := parseSharedItemRef("theme", "12")
+	assert.NoError(t, err)
+	assert.Equal(t, SharedItemKindTheme, kind)
+	assert.Equal(t, uint(12), id)
+
+	kind, id, err = parseSharedItemRef("Palette", "palette:7")
+	assert.NoError(t, err)
+	assert.Equal(t, SharedItemKindPalette, kind)
+	assert.Equal(t, uint(7), id)
+
+	for _, tc := range [][2]string{{"wallpaper", "1"}, {"theme", "palette:1"}, {"theme", "0"}, {"palette", "abc"}} {
+		_, _, err := parseSharedItemRef(tc[0], tc[1])
+		assert.Error(t, err, tc)
+	}
+}
+
+func TestFormatSharedItemID(t *testing.T) {
+	id := uint(3)
+	assert.Equal(t, "theme:3", formatSharedItemID(SharedItemKindTheme, &id))
+	assert.Equal(t, "", formatSharedItemID(SharedItemKindPalette, nil))
+}
@@ -30,14 +30,17 @@ const (
 )
 
 type SharedItem struct {
-	ID         string         `json:"id"`
-	Kind       SharedItemKind `json:"kind"`
-	Name       string         `json:"name"`
-	Palette    []model.Color  `json:"palette"`
-	SharedAt   time.Time      `json:"sharedAt"`
-	CreatedAt  time.Time      `json:"createdAt"`
-	EditorType string         `json:"editorType,omitempty"`
-	Theme      any            `json:"theme,omitempty"`
+	ID               string         `json:"id"`
+	Kind             SharedItemKind `json:"kind"`
+	Name             string         `json:"name"`
+	Palette          []model.Color  `json:"palette"`
+	SharedAt         time.Time      `json:"sharedAt"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	EditorType       string         `json:"editorType,omitempty"`
+	Theme            any            `json:"theme,omitempty"`
+	ForkedFromID     string         `json:"forkedFromId,omitempty"`
+	ForkedFromUserID *uint          `json:"forkedFromUserId,omitempty"`
+	ForkCount        int            `json:"forkCount"`
 }
 
 type SharedItemsResponse struct {
@@ -98,12 +101,15 @@ func listSharedPalettes(query string, limit int) ([]SharedItem, error) {
 		}
 
 		items = append(items, SharedItem{
-			ID:        fmt.Sprintf("palette:%d", row.ID),
-			Kind:      SharedItemKindPalette,
-			Name:      row.Name,
-			Palette:   colors,
-			SharedAt:  *row.SharedAt,
-			CreatedAt: row.CreatedAt,
+			ID:               fmt.Sprintf("palette:%d", row.ID),
+			Kind:             SharedItemKindPalette,
+			Name:             row.Name,
+			Palette:          colors,
+			SharedAt:         *row.SharedAt,
+			CreatedAt:        row.CreatedAt,
+			ForkedFromID:     formatSharedItemID(SharedItemKindPalette, row.ForkedFromID),
+			ForkedFromUserID: row.ForkedFromUserID,
+			ForkCount:        row.ForkCount,
 		})
 	}
 
@@ -136,14 +142,17 @@ func listSharedThemes(query string, limit int) ([]SharedItem, error) {
 		itemTheme := extractThemeObject(payload)
 
 		items = append(items, SharedItem{
-			ID:         fmt.Sprintf("theme:%d", row.ID),
-			Kind:       SharedItemKindTheme,
-			Name:       row.Name,
-			Palette:    palette,
-			SharedAt:   *row.SharedAt,
-			CreatedAt:  row.CreatedAt,
-			EditorType: row.EditorType,
-			Theme:      itemTheme,
+			ID:               fmt.Sprintf("theme:%d", row.ID),
+			Kind:             SharedItemKindTheme,
+			Name:             row.Name,
+			Palette:          palette,
+			SharedAt:         *row.SharedAt,
+			CreatedAt:        row.CreatedAt,
+			EditorType:       row.EditorType,
+			Theme:            itemTheme,
+			ForkedFromID:     formatSharedItemID(SharedItemKindTheme, row.ForkedFromID),
+			ForkedFromUserID: row.ForkedFromUserID,
+			ForkCount:        row.ForkCount,
 		})
 	}
 
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+const vscodeThemeSchema = "vscode://schemas/color-theme"
+
+// themeColorMapping pairs a VS Code workbench color with a Zed style key.
+type themeColorMapping struct {
+	VSCode string
+	Zed    string
+}
+
+// themeColorMappings is the workbench half of the conversion table. It is
+// read in both directions: a key may appear in several rows, and when more
+// than one row targets the same key the first row with a source value wins.
+// Zed's players[0] cursor and selection come from editorCursor.foreground and
+// editor.selectionBackground; accents come from the palette overrides.
+var themeColorMappings = append([]themeColorMapping{
+	{"editor.background", "editor.background"},
+	{"editor.background", "background"},
+	{"editor.foreground", "editor.foreground"},
+	{"editor.foreground", "text"},
+	{"foreground", "text"},
+	{"editorGutter.background", "editor.gutter.background"},
+	{"editor.background", "editor.gutter.background"},
+	{"editor.lineHighlightBackground", "editor.active_line.background"},
+	{"editorLineNumber.foreground", "editor.line_number"},
+	{"editorLineNumber.activeForeground", "editor.active_line_number"},
+	{"editorWhitespace.foreground", "editor.invisible"},
+	{"editorIndentGuide.background1", "editor.indent_guide"},
+	{"editorIndentGuide.background", "editor.indent_guide"},
+	{"editorIndentGuide.activeBackground1", "editor.indent_guide_active"},
+	{"editorIndentGuide.activeBackground", "editor.indent_guide_active"},
+	{"editorRuler.foreground", "editor.wrap_guide"},
+	{"editorRuler.foreground", "editor.active_wrap_guide"},
+	{"editorBracketMatch.background", "editor.document_highlight.bracket_background"},
+	{"editor.wordHighlightBackground", "editor.document_highlight.read_background"},
+	{"editor.wordHighlightStrongBackground", "editor.document_highlight.write_background"},
+	{"editor.findMatchHighlightBackground", "search.match_background"},
+	{"editor.findMatchBackground", "search.match_background"},
+	{"editorWidget.background", "elevated_surface.background"},
+	{"sideBar.background", "surface.background"},
+	{"sideBar.background", "panel.background"},
+	{"panel.background", "panel.background"},
+	{"panel.border", "border"},
+	{"widget.border", "border.variant"},
+	{"focusBorder", "border.focused"},
+	{"editorGroup.border", "pane_group.border"},
+	{"statusBar.background", "status_bar.background"},
+	{"titleBar.activeBackground", "title_bar.background"},
+	{"titleBar.inactiveBackground", "title_bar.inactive_background"},
+	{"breadcrumb.background", "toolbar.background"},
+	{"editorGroupHeader.tabsBackground", "tab_bar.background"},
+	{"tab.activeBackground", "tab.active_background"},
+	{"tab.inactiveBackground", "tab.inactive_background"},
+	{"input.background", "element.background"},
+	{"list.hoverBackground", "element.hover"},
+	{"list.hoverBackground", "ghost_element.hover"},
+	{"list.activeSelectionBackground", "element.selected"},
+	{"list.activeSelectionBackground", "ghost_element.selected"},
+	{"descriptionForeground", "text.muted"},
+	{"input.placeholderForeground", "text.placeholder"},
+	{"disabledForeground", "text.disabled"},
+	{"textLink.foreground", "text.accent"},
+	{"textLink.activeForeground", "link_text.hover"},
+	{"icon.foreground", "icon"},
+	{"scrollbarSlider.background", "scrollbar.thumb.background"},
+	{"scrollbarSlider.hoverBackground", "scrollbar.thumb.hover_background"},
+	{"scrollbarSlider.activeBackground", "scrollbar.thumb.active_background"},
+	{"minimapSlider.background", "minimap.thumb.background"},
+	{"minimapSlider.hoverBackground", "minimap.thumb.hover_background"},
+	{"minimapSlider.activeBackground", "minimap.thumb.active_background"},
+	{"editorError.foreground", "error"},
+	{"inputValidation.errorBackground", "error.background"},
+	{"inputValidation.errorBorder", "error.border"},
+	{"editorWarning.foreground", "warning"},
+	{"inputValidation.warningBackground", "warning.background"},
+	{"inputValidation.warningBorder", "warning.border"},
+	{"editorInfo.foreground", "info"},
+	{"inputValidation.infoBackground", "info.background"},
+	{"inputValidation.infoBorder", "info.border"},
+	{"editorHint.foreground", "hint"},
+	{"gitDecoration.addedResourceForeground", "created"},
+	{"gitDecoration.addedResourceForeground", "version_control.added"},
+	{"diffEditor.insertedTextBackground", "created.background"},
+	{"gitDecoration.modifiedResourceForeground", "modified"},
+	{"gitDecoration.modifiedResourceForeground", "version_control.modified"},
+	{"gitDecoration.deletedResourceForeground", "deleted"},
+	{"gitDecoration.deletedResourceForeground", "version_control.deleted"},
+	{"diffEditor.removedTextBackground", "deleted.background"},
+	{"gitDecoration.renamedResourceForeground", "renamed"},
+	{"gitDecoration.renamedResourceForeground", "version_control.renamed"},
+	{"gitDecoration.conflictingResourceForeground", "conflict"},
+	{"gitDecoration.conflictingResourceForeground", "version_control.conflict"},
+	{"gitDecoration.ignoredResourceForeground", "ignored"},
+	{"gitDecoration.ignoredResourceForeground", "version_control.ignored"},
+	{"terminal.background", "terminal.background"},
+	{"editor.background", "terminal.background"},
+	{"terminal.foreground", "terminal.foreground"},
+}, terminalColorMappings()...)
+
+// themeSyntaxMapping ties Zed syntax highlights to the TextMate scopes VS
+// Code themes style. The first Zed key is used when converting to VS Code.
+type themeSyntaxMapping struct {
+	Zed    []string
+	Scopes []string
+}
+
+// themeSyntaxMappings is the syntax half of the conversion table. Converting
+// to Zed, each highlight takes the VS Code token rule whose scope selector
+// best matches one of its scopes, the way TextMate resolves rules.
+var themeSyntaxMappings = []themeSyntaxMapping{
+	{Zed: []string{"comment"}, Scopes: []string{"comment", "punctuation.definition.comment"}},
+	{Zed: []string{"comment.documentation"}, Scopes: []string{"comment.block.documentation"}},
+	{Zed: []string{"keyword"}, Scopes: []string{"keyword", "keyword.control", "storage.type", "storage.modifier"}},
+	{Zed: []string{"operator"}, Scopes: []string{"keyword.operator", "punctuation.operator"}},
+	{Zed: []string{"preproc", "keyword.directive"}, Scopes: []string{"meta.preprocessor", "keyword.control.directive"}},
+	{Zed: []string{"function"}, Scopes: []string{"entity.name.function", "support.function", "meta.function-call", "variable.function"}},
+	{Zed: []string{"function.decorator"}, Scopes: []string{"meta.decorator", "entity.name.function.decorator"}},
+	{Zed: []string{"constructor"}, Scopes: []string{"entity.name.function.constructor", "keyword.operator.new"}},
+	{Zed: []string{"string"}, Scopes: []string{"string", "string.quoted", "string.template", "punctuation.definition.string"}},
+	{Zed: []string{"string.escape"}, Scopes: []string{"constant.character.escape"}},
+	{Zed: []string{"string.regex"}, Scopes: []string{"string.regexp"}},
+	{Zed: []string{"number", "float"}, Scopes: []string{"constant.numeric", "number"}},
+	{Zed: []string{"boolean"}, Scopes: []string{"constant.language.boolean"}},
+	{Zed: []string{"constant"}, Scopes: []string{"constant.language", "constant.other", "support.constant", "variable.other.constant"}},
+	{Zed: []string{"type"}, Scopes: []string{"entity.name.type", "entity.name.class", "support.type", "support.class", "entity.other.inherited-class"}},
+	{Zed: []string{"enum"}, Scopes: []string{"entity.name.type.enum"}},
+	{Zed: []string{"variant"}, Scopes: []string{"variable.other.enummember"}},
+	{Zed: []string{"namespace", "module"}, Scopes: []string{"entity.name.namespace", "entity.name.module", "support.module"}},
+	{Zed: []string{"variable"}, Scopes: []string{"variable", "variable.other.readwrite", "meta.definition.variable"}},
+	{Zed: []string{"variable.special", "variable.builtin"}, Scopes: []string{"variable.language", "support.variable"}},
+	{Zed: []string{"variable.parameter", "parameter"}, Scopes: []string{"variable.parameter", "meta.parameter"}},
+	{Zed: []string{"property", "field", "variable.member"}, Scopes: []string{"variable.other.property", "variable.other.object.property", "meta.object-literal.key", "support.type.property-name"}},
+	{Zed: []string{"attribute"}, Scopes: []string{"meta.attribute", "storage.type.annotation"}},
+	{Zed: []string{"tag"}, Scopes: []string{"entity.name.tag"}},
+	{Zed: []string{"tag.attribute"}, Scopes: []string{"entity.other.attribute-name"}},
+	{Zed: []string{"tag.delimiter"}, Scopes: []string{"punctuation.definition.tag"}},
+	{Zed: []string{"punctuation"}, Scopes: []string{"punctuation", "punctuation.separator", "punctuation.terminator"}},
+	{Zed: []string{"punctuation.bracket"}, Scopes: []string{"punctuation.section.brackets", "punctuation.section.parens", "punctuation.section.braces", "meta.brace"}},
+	{Zed: []string{"punctuation.special"}, Scopes: []string{"punctuation.section.embedded"}},
+	{Zed: []string{"label"}, Scopes: []string{"entity.name.label"}},
+	{Zed: []string{"embedded"}, Scopes: []string{"meta.embedded"}},
+	{Zed: []string{"title"}, Scopes: []string{"markup.heading", "entity.name.section"}},
+	{Zed: []string{"emphasis"}, Scopes: []string{"markup.italic"}},
+	{Zed: []string{"emphasis.strong"}, Scopes: []string{"markup.bold"}},
+	{Zed: []string{"text.literal"}, Scopes: []string{"markup.inline.raw", "markup.fenced_code"}},
+	{Zed: []string{"link_text"}, Scopes: []string{"string.other.link"}},
+	{Zed: []string{"link_uri"}, Scopes: []string{"markup.underline.link"}},
+	{Zed: []string{"diff.plus"}, Scopes: []string{"markup.inserted"}},
+	{Zed: []string{"diff.minus"}, Scopes: []string{"markup.deleted"}},
+}
+
+func terminalColorMappings() []themeColorMapping {
+	names := []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+	mappings := make([]themeColorMapping, 0, len(names)*2)
+	for _, name := range names {
+		title := strings.ToUpper(name[:1]) + name[1:]
+		mappings = append(mappings,
+			themeColorMapping{"terminal.ansi" + title, "terminal.ansi." + name},
+			themeColorMapping{"terminal.ansiBright" + title, "terminal.ansi.bright_" + name},
+		)
+	}
+	return mappings
+}
+
+// themeScopeSpecificity reports how closely a token rule selector matches a
+// scope: the selector length when it equals the scope or is a dotted prefix of
+// it, and -1 otherwise.
+func themeScopeSpecificity(selector string, scope string) int {
+	selector = strings.TrimSpace(selector)
+	if selector == scope || strings.HasPrefix(scope, selector+".") {
+		return len(selector)
+	}
+	return -1
+}
+
+func vscodeTokenScopes(token map[string]any) []string {
+	switch scope := token["scope"].(type) {
+	case string:
+		return strings.Split(scope, ",")
+	case []any:
+		scopes := make([]string, 0, len(scope))
+		for _, item := range scope {
+			if s, ok := item.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// matchVSCodeTokenRule returns the settings of the token rule that best
+// matches any of scopes. Later rules win ties, as they do in VS Code.
+func matchVSCodeTokenRule(tokenColors []any, scopes []string) map[string]any {
+	var best map[string]any
+	bestScore := -1
+	for _, raw := range tokenColors {
+		token, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		settings, ok := token["settings"].(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, selector := range vscodeTokenScopes(token) {
+			for _, scope := range scopes {
+				if score := themeScopeSpecificity(selector, scope); score >= 0 && score >= bestScore {
+					best, bestScore = settings, score
+				}
+			}
+		}
+	}
+	return best
+}
+
+func stringValue(obj map[string]any, key string) (string, bool) {
+	s, ok := obj[key].(string)
+	return s, ok && s != ""
+}
+
+// convertVSCodeToZed builds a Zed theme family from a VS Code theme. Accents
+// come from the palette overrides saved next to the theme.
+func convertVSCodeToZed(theme map[string]any, name string, overrides map[string]any) map[string]any {
+	colors, _ := theme["colors"].(map[string]any)
+	tokenColors, _ := theme["tokenColors"].([]any)
+
+	style := map[string]any{"background.appearance": "opaque"}
+	for _, mapping := range themeColorMappings {
+		if _, done := style[mapping.Zed]; done {
+			continue
+		}
+		if value, ok := stringValue(colors, mapping.VSCode); ok {
+			style[mapping.Zed] = value
+		}
+	}
+
+	var accents []any
+	for i := 1; i <= 8; i++ {
+		if value, ok := stringValue(overrides, fmt.Sprintf("c%d", i)); ok {
+			accents = append(accents, value)
+		}
+	}
+	if len(accents) > 0 {
+		style["accents"] = accents
+	}
+
+	player := map[string]any{}
+	if cursor, ok := stringValue(colors, "editorCursor.foreground"); ok {
+		player["cursor"] = cursor
+		player["background"] = cursor
+	}
+	if selection, ok := stringValue(colors, "editor.selectionBackground"); ok {
+		player["selection"] = selection
+	}
+	if len(player) > 0 {
+		style["players"] = []any{player}
+	}
+
+	syntax := map[string]any{}
+	for _, mapping := range themeSyntaxMappings {
+		settings := matchVSCodeTokenRule(tokenColors, mapping.Scopes)
+		foreground, ok := stringValue(settings, "foreground")
+		if !ok {
+			continue
+		}
+
+		highlight := map[string]any{"color": foreground}
+		fontStyle, _ := settings["fontStyle"].(string)
+		for word := range strings.FieldsSeq(fontStyle) {
+			switch word {
+			case "italic":
+				highlight["font_style"] = "italic"
+			case "bold":
+				highlight["font_weight"] = float64(700)
+			}
+		}
+		for _, key := range mapping.Zed {
+			syntax[key] = highlight
+		}
+	}
+	style["syntax"] = syntax
+
+	appearance := "dark"
+	if vscodeUITheme(theme) == "vs" || vscodeUITheme(theme) == "hc-light" {
+		appearance = "light"
+	}
+
+	return map[string]any{
+		"$schema": zedThemeSchema,
+		"name":    name,
+		"author":  "ThemeSmith",
+		"themes": []any{map[string]any{
+			"name":       name,
+			"appearance": appearance,
+			"style":      style,
+		}},
+	}
+}
+
+// convertZedToVSCode builds a VS Code theme from the first theme of a Zed
+// family.
+func convertZedToVSCode(family map[string]any, name string) (map[string]any, error) {
+	themes, _ := family["themes"].([]any)
+	if len(themes) == 0 {
+		return nil, &statusError{Status: http.StatusUnprocessableEntity, Message: "zed theme has no variants to convert"}
+	}
+	variant, _ := themes[0].(map[string]any)
+	style, _ := variant["style"].(map[string]any)
+
+	colors := map[string]any{}
+	for _, mapping := range themeColorMappings {
+		if _, done := colors[mapping.VSCode]; done {
+			continue
+		}
+		if value, ok := stringValue(style, mapping.Zed); ok {
+			colors[mapping.VSCode] = value
+		}
+	}
+
+	if players, _ := style["players"].([]any); len(players) > 0 {
+		if player, ok := players[0].(map[string]any); ok {
+			if cursor, ok := stringValue(player, "cursor"); ok {
+				colors["editorCursor.foreground"] = cursor
+			}
+			if selection, ok := stringValue(player, "selection"); ok {
+				colors["editor.selectionBackground"] = selection
+			}
+		}
+	}
+
+	syntax, _ := style["syntax"].(map[string]any)
+	tokenColors := make([]any, 0, len(themeSyntaxMappings))
+	for _, mapping := range themeSyntaxMappings {
+		for _, key := range mapping.Zed {
+			highlight, ok := syntax[key].(map[string]any)
+			if !ok {
+				continue
+			}
+			color, ok := stringValue(highlight, "color")
+			if !ok {
+				continue
+			}
+
+			settings := map[string]any{"foreground": color}
+			var fontStyle []string
+			if s, _ := highlight["font_style"].(string); s == "italic" || s == "oblique" {
+				fontStyle = append(fontStyle, "italic")
+			}
+			if weight, ok := highlight["font_weight"].(float64); ok && weight >= 600 {
+				fontStyle = append(fontStyle, "bold")
+			}
+			if len(fontStyle) > 0 {
+				settings["fontStyle"] = strings.Join(fontStyle, " ")
+			}
+
+			scopes := make([]any, len(mapping.Scopes))
+			for i, scope := range mapping.Scopes {
+				scopes[i] = scope
+			}
+			tokenColors = append(tokenColors, map[string]any{
+				"name":     key,
+				"scope":    scopes,
+				"settings": settings,
+			})
+			break
+		}
+	}
+
+	themeType := "dark"
+	if appearance, _ := variant["appearance"].(string); appearance == "light" {
+		themeType = "light"
+	}
+
+	return map[string]any{
+		"$schema":              vscodeThemeSchema,
+		"name":                 name,
+		"type":                 themeType,
+		"semanticHighlighting": true,
+		"colors":               colors,
+		"tokenColors":          tokenColors,
+	}, nil
+}
+
+// themeResultSignature fingerprints a generated theme result the way the
+// frontend does, by its JSON encoding, shortened like any saved signature.
+func themeResultSignature(themeResult map[string]any) (string, error) {
+	encoded, err := json.Marshal(themeResult)
+	if err != nil {
+		return "", err
+	}
+	return normalizeThemeSignature(string(encoded)), nil
+}
+
+func editorDisplayName(editorType string) string {
+	switch editorType {
+	case "vscode":
+		return "VS Code"
+	case "zed":
+		return "Zed"
+	default:
+		return editorType
+	}
+}
+
+// convertThemePayload converts a stored theme payload to another editor and
+// returns the new payload with its name and signature.
+func convertThemePayload(payload map[string]any, sourceEditor string, targetEditor string, name string) (map[string]any, themePayload, error) {
+	result, _ := payload["themeResult"].(map[string]any)
+	theme, _ := result["theme"].(map[string]any)
+	if len(theme) == 0 {
+		return nil, themePayload{}, &statusError{Status: http.StatusUnprocessableEntity, Message: "theme has no generated theme to convert"}
+	}
+	overrides, _ := result["themeOverrides"].(map[string]any)
+
+	var converted map[string]any
+	switch {
+	case sourceEditor == "vscode" && targetEditor == "zed":
+		converted = convertVSCodeToZed(theme, name, overrides)
+	case sourceEditor == "zed" && targetEditor == "vscode":
+		var err error
+		if converted, err = convertZedToVSCode(theme, name); err != nil {
+			return nil, themePayload{}, err
+		}
+	default:
+		return nil, themePayload{}, badRequestError(fmt.Sprintf("cannot convert %s themes to %s", sourceEditor, targetEditor))
+	}
+
+	newResult := map[string]any{"theme": converted}
+	for _, key := range []string{"themeOverrides", "rawThemeOverrides", "colors", "boostCoefficient"} {
+		if value, ok := result[key]; ok {
+			newResult[key] = value
+		}
+	}
+
+	signature, err := themeResultSignature(newResult)
+	if err != nil {
+		return nil, themePayload{}, err
+	}
+
+	newPayload := map[string]any{
+		"name":        name,
+		"editorType":  targetEditor,
+		"signature":   signature,
+		"themeResult": newResult,
+	}
+	if err := validateThemePayload(newPayload, targetEditor, themeValidationOptions{}); err != nil {
+		return nil, themePayload{}, fmt.Errorf("converted theme is invalid: %w", err)
+	}
+
+	return newPayload, themePayload{Name: name, EditorType: targetEditor, Signature: signature}, nil
+}
+
+// ConvertThemeHandler converts a saved or shared theme to the editor given by
+// ?to= and saves the result as a new theme for the caller. ?name= overrides
+// the default "<name> (<editor>)" name.
+func ConvertThemeHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to convert themes"})
+		return
+	}
+
+	target := strings.ToLower(strings.TrimSpace(c.Query("to")))
+	if target != "vscode" && target != "zed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be vscode or zed"})
+		return
+	}
+
+	source, err := findReadableTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	if source.EditorType == target {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("theme is already a %s theme", editorDisplayName(target))})
+		return
+	}
+
+	payload, err := decodeThemePayload(source.JsonData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read theme"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = fmt.Sprintf("%s (%s)", source.Name, editorDisplayName(target))
+	}
+
+	converted, info, err := convertThemePayload(payload, source.EditorType, target, name)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	jsonData, err := storedThemeJSON(converted)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode converted theme"})
+		return
+	}
+
+	theme, created, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, jsonData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save theme"})
+		return
+	}
+
+	responseTheme, err := buildThemeResponse(theme, converted)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"message": "Theme converted successfully", "theme": responseTheme})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertVSCodeToZed(t *testing.T) {
+	theme := map[string]any{
+		"name": "Dusk",
+		"type": "light",
+		"colors": map[string]any{
+			"editor.background":       "#101010",
+			"editor.foreground":       "#eeeeee",
+			"terminal.ansiBrightRed":  "#ff0000",
+			"editorCursor.foreground": "#ffcc00",
+		},
+		"tokenColors": []any{
+			map[string]any{"scope": "keyword", "settings": map[string]any{"foreground": "#111111"}},
+			map[string]any{"scope": []any{"keyword.operator"}, "settings": map[string]any{"foreground": "#222222"}},
+			map[string]any{"scope": "comment, string", "settings": map[string]any{"foreground": "#333333", "fontStyle": "italic bold"}},
+		},
+	}
+
+	family := convertVSCodeToZed(theme, "Dusk (Zed)", map[string]any{"c1": "#aa0000", "c2": "#00aa00"})
+	assert.Equal(t, zedThemeSchema, family["$schema"])
+
+	variants := family["themes"].([]any)
+	require.Len(t, variants, 1)
+	variant := variants[0].(map[string]any)
+	assert.Equal(t, "light", variant["appearance"])
+
+	style := variant["style"].(map[string]any)
+	assert.Equal(t, "#101010", style["background"])
+	assert.Equal(t, "#101010", style["editor.background"])
+	assert.Equal(t, "#eeeeee", style["text"])
+	assert.Equal(t, "#ff0000", style["terminal.ansi.bright_red"])
+	assert.Equal(t, []any{"#aa0000", "#00aa00"}, style["accents"])
+	assert.Equal(t, "#ffcc00", style["players"].([]any)[0].(map[string]any)["cursor"])
+
+	syntax := style["syntax"].(map[string]any)
+	assert.Equal(t, "#111111", syntax["keyword"].(map[string]any)["color"])
+	assert.Equal(t, "#222222", syntax["operator"].(map[string]any)["color"])
+	assert.Equal(t, map[string]any{"color": "#333333", "font_style": "italic", "font_weight": float64(700)}, syntax["comment"])
+	assert.NotContains(t, syntax, "function")
+}
+
+func TestConvertZedToVSCodeRoundTrip(t *testing.T) {
+	family := map[string]any{
+		"themes": []any{map[string]any{
+			"name":       "Dawn",
+			"appearance": "dark",
+			"style": map[string]any{
+				"editor.background":  "#000000",
+				"text":               "#ffffff",
+				"terminal.ansi.blue": "#0000ff",
+				"players":            []any{map[string]any{"cursor": "#ffcc00", "selection": "#44444480"}},
+				"syntax": map[string]any{
+					"field":   map[string]any{"color": "#aa0000"},
+					"comment": map[string]any{"color": "#777777", "font_style": "italic"},
+					"title":   map[string]any{"color": "#bbbbbb", "font_weight": float64(700)},
+				},
+			},
+		}},
+	}
+
+	theme, err := convertZedToVSCode(family, "Dawn (VS Code)")
+	require.NoError(t, err)
+	assert.Equal(t, vscodeThemeSchema, theme["$schema"])
+	assert.Equal(t, "dark", theme["type"])
+
+	colors := theme["colors"].(map[string]any)
+	assert.Equal(t, "#000000", colors["editor.background"])
+	assert.Equal(t, "#ffffff", colors["editor.foreground"])
+	assert.Equal(t, "#0000ff", colors["terminal.ansiBlue"])
+	assert.Equal(t, "#44444480", colors["editor.selectionBackground"])
+
+	back := convertVSCodeToZed(theme, "Dawn", nil)
+	syntax := back["themes"].([]any)[0].(map[string]any)["style"].(map[string]any)["syntax"].(map[string]any)
+	assert.Equal(t, "#aa0000", syntax["property"].(map[string]any)["color"])
+	assert.Equal(t, "#aa0000", syntax["field"].(map[string]any)["color"])
+	assert.Equal(t, "italic", syntax["comment"].(map[string]any)["font_style"])
+	assert.Equal(t, float64(700), syntax["title"].(map[string]any)["font_weight"])
+
+	_, err = convertZedToVSCode(map[string]any{"themes": []any{}}, "Empty")
+	assert.Error(t, err)
+}
+
+func TestConvertThemePayloadKeepsPaletteAndSigns(t *testing.T) {
+	payload := map[string]any{
+		"themeResult": map[string]any{
+			"theme": map[string]any{
+				"name":   "Dusk",
+				"type":   "dark",
+				"colors": map[string]any{"editor.background": "#101010"},
+				"tokenColors": []any{
+					map[string]any{"scope": "keyword", "settings": map[string]any{"foreground": "#ff00ff", "fontStyle": "bold"}},
+				},
+			},
+			"themeOverrides":   map[string]any{"c1": "#aa0000"},
+			"boostCoefficient": 0.5,
+		},
+	}
+
+	converted, info, err := convertThemePayload(payload, "vscode", "zed", "Dusk (Zed)")
+	require.NoError(t, err)
+	assert.Equal(t, "zed", info.EditorType)
+	assert.Equal(t, "Dusk (Zed)", converted["name"])
+	assert.Len(t, info.Signature, 64)
+	assert.Equal(t, info.Signature, converted["signature"])
+
+	result := converted["themeResult"].(map[string]any)
+	assert.Equal(t, 0.5, result["boostCoefficient"])
+	variant := result["theme"].(map[string]any)["themes"].([]any)[0].(map[string]any)
+	keyword := variant["style"].(map[string]any)["syntax"].(map[string]any)["keyword"]
+	assert.Equal(t, map[string]any{"color": "#ff00ff", "font_weight": float64(700)}, keyword)
+	assert.Equal(t, map[string]any{"c1": "#aa0000"}, result["themeOverrides"])
+
+	again, _, err := convertThemePayload(payload, "vscode", "zed", "Dusk (Zed)")
+	require.NoError(t, err)
+	assert.Equal(t, converted["signature"], again["signature"])
+
+	_, _, err = convertThemePayload(payload, "vscode", "vscode", "Dusk")
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"themesmith/db"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ThemeDiffRequest names the two themes to compare, either as two saved
+// theme IDs or as two theme payloads. The first entry is the old side.
+type ThemeDiffRequest struct {
+	IDs    []string         `json:"ids"`
+	Themes []map[string]any `json:"themes"`
+}
+
+type ThemeDiffSide struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	EditorType string `json:"editorType,omitempty"`
+}
+
+type ThemeDiffResponse struct {
+	From    ThemeDiffSide     `json:"from"`
+	To      ThemeDiffSide     `json:"to"`
+	Added   []ThemeDiffChange `json:"added"`
+	Removed []ThemeDiffChange `json:"removed"`
+	Changed []ThemeDiffChange `json:"changed"`
+}
+
+// flattenThemeColors maps the color-bearing parts of a theme to flat keys:
+// /colors/<id> for VS Code workbench colors, /tokenColors/<scope>/<setting>
+// for token rules, and /style/... for Zed style keys. A Zed family with more
+// than one variant keys its styles by variant name, /style/<variant>/....
+// Token rules are expanded per scope, and later rules win, as in VS Code.
+func flattenThemeColors(theme map[string]any) map[string]any {
+	flat := map[string]any{}
+
+	if colors, ok := theme["colors"].(map[string]any); ok {
+		for key, value := range colors {
+			flat[pointerJoin("/colors", key)] = value
+		}
+	}
+
+	if tokenColors, ok := theme["tokenColors"].([]any); ok {
+		for _, raw := range tokenColors {
+			token, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			settings, _ := token["settings"].(map[string]any)
+			scopes := vscodeTokenScopes(token)
+			if len(scopes) == 0 {
+				scopes = []string{"*"}
+			}
+			for _, scope := range scopes {
+				scope = strings.TrimSpace(scope)
+				if scope == "" {
+					continue
+				}
+				for key, value := range settings {
+					flat[pointerJoin(pointerJoin("/tokenColors", scope), key)] = value
+				}
+			}
+		}
+	}
+
+	if variants, ok := theme["themes"].([]any); ok {
+		for i, raw := range variants {
+			variant, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			style, ok := variant["style"].(map[string]any)
+			if !ok {
+				continue
+			}
+			pointer := "/style"
+			if len(variants) > 1 {
+				name, _ := stringValue(variant, "name")
+				if name == "" {
+					name = strconv.Itoa(i)
+				}
+				pointer = pointerJoin(pointer, name)
+			}
+			for key, value := range style {
+				flattenThemeJSON(pointerJoin(pointer, key), value, flat)
+			}
+		}
+	}
+
+	return flat
+}
+
+// themeColorDeltaE is the CIEDE2000 difference between two color values,
+// rounded to two decimals. Alpha is ignored. It returns nil unless both
+// values are hex colors.
+func themeColorDeltaE(oldValue any, newValue any) *float64 {
+	oldHex, _ := oldValue.(string)
+	newHex, _ := newValue.(string)
+	oldRGBA, err := utils.HexToRGBA(normalizeHexColor(oldHex))
+	if err != nil {
+		return nil
+	}
+	newRGBA, err := utils.HexToRGBA(normalizeHexColor(newHex))
+	if err != nil {
+		return nil
+	}
+	deltaE := math.Round(utils.DeltaE2000(utils.RGBToLab(oldRGBA), utils.RGBToLab(newRGBA))*100) / 100
+	return &deltaE
+}
+
+// diffThemeColors diffs the flattened colors of two themes and splits the
+// result by kind of change.
+func diffThemeColors(oldTheme map[string]any, newTheme map[string]any) (added, removed, changed []ThemeDiffChange) {
+	added, removed, changed = []ThemeDiffChange{}, []ThemeDiffChange{}, []ThemeDiffChange{}
+	for _, change := range diffFlattenedThemes(flattenThemeColors(oldTheme), flattenThemeColors(newTheme)) {
+		switch change.Change {
+		case "added":
+			added = append(added, change)
+		case "removed":
+			removed = append(removed, change)
+		default:
+			change.DeltaE = themeColorDeltaE(change.Old, change.New)
+			changed = append(changed, change)
+		}
+	}
+	return added, removed, changed
+}
+
+// loadDiffSide returns the theme object of a saved theme the caller may read.
+func loadDiffSide(c *gin.Context, id string) (ThemeDiffSide, map[string]any, error) {
+	row, err := findReadableTheme(c, id)
+	if err != nil {
+		return ThemeDiffSide{}, nil, err
+	}
+	payload, err := decodeThemePayload(row.JsonData)
+	if err != nil {
+		return ThemeDiffSide{}, nil, fmt.Errorf("failed to decode theme %d: %w", row.ID, err)
+	}
+	theme, _ := extractThemeObject(payload).(map[string]any)
+	return ThemeDiffSide{ID: fmt.Sprintf("%d", row.ID), Name: row.Name, EditorType: row.EditorType}, theme, nil
+}
+
+// payloadDiffSide accepts either a saved-theme payload, with the theme under
+// themeResult, or a bare theme object.
+func payloadDiffSide(payload map[string]any) (ThemeDiffSide, map[string]any) {
+	theme := payload
+	if _, ok := payload["themeResult"]; ok {
+		theme, _ = extractThemeObject(payload).(map[string]any)
+	}
+	side := ThemeDiffSide{}
+	side.Name, _ = stringValue(payload, "name")
+	if side.Name == "" {
+		side.Name, _ = stringValue(theme, "name")
+	}
+	side.EditorType, _ = stringValue(payload, "editorType")
+	return side, theme
+}
+
+// DiffThemesHandler compares the colors of two themes, given as two readable
+// theme IDs or two payloads, and reports added, removed and changed keys with
+// the ΔE of every changed color. Diffing payloads needs no database.
+func DiffThemesHandler(c *gin.Context) {
+	var req ThemeDiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	var sides [2]ThemeDiffSide
+	var themes [2]map[string]any
+	switch {
+	case len(req.IDs) == 2 && len(req.Themes) == 0:
+		if db.DB == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+			return
+		}
+		for i, id := range req.IDs {
+			side, theme, err := loadDiffSide(c, id)
+			if err != nil {
+				respondStatusError(c, err)
+				return
+			}
+			sides[i], themes[i] = side, theme
+		}
+	case len(req.Themes) == 2 && len(req.IDs) == 0:
+		for i, payload := range req.Themes {
+			sides[i], themes[i] = payloadDiffSide(payload)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provide either two theme ids or two theme payloads"})
+		return
+	}
+
+	added, removed, changed := diffThemeColors(themes[0], themes[1])
+	c.JSON(http.StatusOK, ThemeDiffResponse{From: sides[0], To: sides[1], Added: added, Removed: removed, Changed: changed})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenThemeColors(t *testing.T) {
+	flat := flattenThemeColors(map[string]any{
+		"colors": map[string]any{"editor.background": "#101010"},
+		"tokenColors": []any{
+			map[string]any{"scope": "keyword, storage", "settings": map[string]any{"foreground": "#ff00ff"}},
+			map[string]any{"scope": []any{"keyword"}, "settings": map[string]any{"foreground": "#00ff00", "fontStyle": "bold"}},
+			map[string]any{"settings": map[string]any{"background": "#000000"}},
+		},
+	})
+
+	assert.Equal(t, map[string]any{
+		"/colors/editor.background":       "#101010",
+		"/tokenColors/keyword/foreground": "#00ff00",
+		"/tokenColors/keyword/fontStyle":  "bold",
+		"/tokenColors/storage/foreground": "#ff00ff",
+		"/tokenColors/*/background":       "#000000",
+	}, flat)
+
+	single := flattenThemeColors(map[string]any{"themes": []any{
+		map[string]any{"name": "Dusk", "style": map[string]any{"text": "#eeeeee", "syntax": map[string]any{"keyword": map[string]any{"color": "#ff00ff"}}}},
+	}})
+	assert.Equal(t, map[string]any{"/style/text": "#eeeeee", "/style/syntax/keyword/color": "#ff00ff"}, single)
+
+	family := flattenThemeColors(map[string]any{"themes": []any{
+		map[string]any{"name": "Dusk", "style": map[string]any{"text": "#eeeeee"}},
+		map[string]any{"name": "Dawn/Light", "style": map[string]any{"text": "#111111"}},
+	}})
+	assert.Equal(t, map[string]any{"/style/Dusk/text": "#eeeeee", "/style/Dawn~1Light/text": "#111111"}, family)
+}
+
+func TestThemeColorDeltaE(t *testing.T) {
+	same := themeColorDeltaE("#ff0000", "#FF000080")
+	require.NotNil(t, same)
+	assert.Equal(t, 0.0, *same)
+
+	far := themeColorDeltaE("#000000", "#ffffff")
+	require.NotNil(t, far)
+	assert.InDelta(t, 100, *far, 0.01)
+
+	assert.Nil(t, themeColorDeltaE("bold", "italic"))
+}
+
+func TestDiffThemesHandler_Payloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/themes/diff", DiffThemesHandler)
+
+	body, err := json.Marshal(map[string]any{"themes": []any{
+		map[string]any{"name": "Dusk", "themeResult": map[string]any{"theme": map[string]any{
+			"colors":      map[string]any{"editor.background": "#101010", "editor.foreground": "#eeeeee"},
+			"tokenColors": []any{map[string]any{"scope": "comment", "settings": map[string]any{"fontStyle": "italic"}}},
+		}}},
+		map[string]any{
+			"colors":      map[string]any{"editor.background": "#202020", "focusBorder": "#0000ff"},
+			"tokenColors": []any{map[string]any{"scope": "comment", "settings": map[string]any{"fontStyle": "bold"}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/themes/diff", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp ThemeDiffResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Dusk", resp.From.Name)
+
+	require.Len(t, resp.Added, 1)
+	assert.Equal(t, "/colors/focusBorder", resp.Added[0].Key)
+	assert.Equal(t, "#0000ff", resp.Added[0].New)
+
+	require.Len(t, resp.Removed, 1)
+	assert.Equal(t, "/colors/editor.foreground", resp.Removed[0].Key)
+
+	require.Len(t, resp.Changed, 2)
+	assert.Equal(t, "/colors/editor.background", resp.Changed[0].Key)
+	assert.Equal(t, "#101010", resp.Changed[0].Old)
+	assert.Equal(t, "#202020", resp.Changed[0].New)
+	require.NotNil(t, resp.Changed[0].DeltaE)
+	assert.Greater(t, *resp.Changed[0].DeltaE, 0.0)
+	assert.Equal(t, "/tokenColors/comment/fontStyle", resp.Changed[1].Key)
+	assert.Nil(t, resp.Changed[1].DeltaE)
+}
+
+func TestDiffThemesHandler_RequiresTwoSides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/themes/diff", DiffThemesHandler)
+
+	for _, body := range []string{`{"ids":["1"]}`, `{"ids":["1","2"],"themes":[{},{}]}`, `{}`, `not json`} {
+		req := httptest.NewRequest(http.MethodPost, "/themes/diff", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
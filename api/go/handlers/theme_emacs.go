@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"themesmith/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emacsFace styles one Emacs face from the palette bindings of the generated
+// theme. Box draws a one pixel box and Wave a wavy underline in that role's
+// color; Attrs are passed through as-is, e.g. ":weight bold".
+type emacsFace struct {
+	Face    string
+	Fg      string
+	Bg      string
+	Box     string
+	Wave    string
+	Inherit string
+	Attrs   []string
+}
+
+var emacsBaseFaces = []emacsFace{
+	{Face: "default", Fg: "foreground", Bg: "background"},
+	{Face: "cursor", Bg: "cursor"},
+	{Face: "region", Bg: "selection", Attrs: []string{":extend t"}},
+	{Face: "secondary-selection", Bg: "surface", Attrs: []string{":extend t"}},
+	{Face: "highlight", Bg: "line_highlight"},
+	{Face: "hl-line", Bg: "line_highlight", Attrs: []string{":extend t"}},
+	{Face: "fringe", Fg: "comment", Bg: "background"},
+	{Face: "vertical-border", Fg: "border"},
+	{Face: "window-divider", Fg: "border"},
+	{Face: "shadow", Fg: "comment"},
+	{Face: "minibuffer-prompt", Fg: "c2", Attrs: []string{":weight bold"}},
+	{Face: "link", Fg: "c2", Attrs: []string{":underline t"}},
+	{Face: "link-visited", Fg: "c6", Attrs: []string{":underline t"}},
+	{Face: "error", Fg: "error", Attrs: []string{":weight bold"}},
+	{Face: "warning", Fg: "warning", Attrs: []string{":weight bold"}},
+	{Face: "success", Fg: "success", Attrs: []string{":weight bold"}},
+	{Face: "isearch", Fg: "background", Bg: "warning", Attrs: []string{":weight bold"}},
+	{Face: "isearch-fail", Fg: "error", Bg: "diff_delete"},
+	{Face: "lazy-highlight", Fg: "foreground", Bg: "selection"},
+	{Face: "match", Bg: "selection"},
+	{Face: "show-paren-match", Bg: "selection", Attrs: []string{":weight bold"}},
+	{Face: "show-paren-mismatch", Fg: "background", Bg: "error"},
+	{Face: "trailing-whitespace", Bg: "error"},
+	{Face: "line-number", Fg: "comment", Bg: "background"},
+	{Face: "line-number-current-line", Fg: "foreground", Bg: "line_highlight", Attrs: []string{":weight bold"}},
+	{Face: "header-line", Fg: "foreground", Bg: "surface_dark"},
+	{Face: "tooltip", Fg: "foreground", Bg: "surface"},
+	{Face: "completions-common-part", Fg: "c2"},
+	{Face: "completions-first-difference", Fg: "c8", Attrs: []string{":weight bold"}},
+
+	{Face: "mode-line", Fg: "foreground", Bg: "surface_dark", Box: "border"},
+	{Face: "mode-line-inactive", Fg: "comment", Bg: "surface", Box: "border"},
+	{Face: "mode-line-buffer-id", Attrs: []string{":weight bold"}},
+	{Face: "mode-line-emphasis", Fg: "c2", Attrs: []string{":weight bold"}},
+	{Face: "mode-line-highlight", Box: "c2"},
+}
+
+// emacsFontLockFaces covers the classic font-lock faces and the ones Emacs 29
+// added for the tree-sitter major modes.
+var emacsFontLockFaces = []emacsFace{
+	{Face: "font-lock-builtin-face", Fg: "c9"},
+	{Face: "font-lock-comment-face", Fg: "comment", Attrs: []string{":slant italic"}},
+	{Face: "font-lock-comment-delimiter-face", Inherit: "font-lock-comment-face"},
+	{Face: "font-lock-constant-face", Fg: "constants"},
+	{Face: "font-lock-doc-face", Fg: "comment", Attrs: []string{":slant italic"}},
+	{Face: "font-lock-doc-markup-face", Fg: "c4"},
+	{Face: "font-lock-function-name-face", Fg: "c2"},
+	{Face: "font-lock-keyword-face", Fg: "c6"},
+	{Face: "font-lock-negation-char-face", Fg: "c8"},
+	{Face: "font-lock-preprocessor-face", Fg: "c9"},
+	{Face: "font-lock-regexp-grouping-backslash", Fg: "c4"},
+	{Face: "font-lock-regexp-grouping-construct", Fg: "c4"},
+	{Face: "font-lock-string-face", Fg: "c3"},
+	{Face: "font-lock-type-face", Fg: "c5"},
+	{Face: "font-lock-variable-name-face", Fg: "c1"},
+	{Face: "font-lock-warning-face", Fg: "warning", Attrs: []string{":weight bold"}},
+
+	{Face: "font-lock-bracket-face", Fg: "muted"},
+	{Face: "font-lock-delimiter-face", Fg: "muted"},
+	{Face: "font-lock-escape-face", Fg: "c4"},
+	{Face: "font-lock-function-call-face", Fg: "c2"},
+	{Face: "font-lock-misc-punctuation-face", Fg: "muted"},
+	{Face: "font-lock-number-face", Fg: "constants"},
+	{Face: "font-lock-operator-face", Fg: "c8"},
+	{Face: "font-lock-property-name-face", Fg: "c1"},
+	{Face: "font-lock-property-use-face", Fg: "c1"},
+	{Face: "font-lock-punctuation-face", Fg: "muted"},
+	{Face: "font-lock-variable-use-face", Fg: "foreground"},
+}
+
+// emacsTreeSitterFaces are the tree-sitter-hl-face:* faces of the
+// elisp-tree-sitter package, used before Emacs 29's built-in treesit.
+var emacsTreeSitterFaces = []emacsFace{
+	{Face: "tree-sitter-hl-face:attribute", Fg: "constants"},
+	{Face: "tree-sitter-hl-face:comment", Inherit: "font-lock-comment-face"},
+	{Face: "tree-sitter-hl-face:doc", Inherit: "font-lock-doc-face"},
+	{Face: "tree-sitter-hl-face:constant", Fg: "constants"},
+	{Face: "tree-sitter-hl-face:constant.builtin", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:constructor", Fg: "c8"},
+	{Face: "tree-sitter-hl-face:embedded", Fg: "foreground"},
+	{Face: "tree-sitter-hl-face:escape", Fg: "c4"},
+	{Face: "tree-sitter-hl-face:function", Fg: "c2"},
+	{Face: "tree-sitter-hl-face:function.builtin", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:function.call", Fg: "c2"},
+	{Face: "tree-sitter-hl-face:function.macro", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:method", Fg: "c2"},
+	{Face: "tree-sitter-hl-face:method.call", Fg: "c2"},
+	{Face: "tree-sitter-hl-face:keyword", Fg: "c6"},
+	{Face: "tree-sitter-hl-face:label", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:number", Fg: "constants"},
+	{Face: "tree-sitter-hl-face:operator", Fg: "c8"},
+	{Face: "tree-sitter-hl-face:property", Fg: "c1"},
+	{Face: "tree-sitter-hl-face:punctuation", Fg: "muted"},
+	{Face: "tree-sitter-hl-face:string", Fg: "c3"},
+	{Face: "tree-sitter-hl-face:string.special", Fg: "c4"},
+	{Face: "tree-sitter-hl-face:tag", Fg: "c2"},
+	{Face: "tree-sitter-hl-face:type", Fg: "c5"},
+	{Face: "tree-sitter-hl-face:type.builtin", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:variable", Fg: "foreground"},
+	{Face: "tree-sitter-hl-face:variable.builtin", Fg: "c9"},
+	{Face: "tree-sitter-hl-face:variable.parameter", Fg: "c7"},
+	{Face: "tree-sitter-hl-face:variable.special", Fg: "c9"},
+}
+
+var emacsPackageFaces = []emacsFace{
+	{Face: "diff-added", Fg: "success", Bg: "diff_add", Attrs: []string{":extend t"}},
+	{Face: "diff-removed", Fg: "error", Bg: "diff_delete", Attrs: []string{":extend t"}},
+	{Face: "diff-changed", Fg: "warning", Bg: "diff_change", Attrs: []string{":extend t"}},
+	{Face: "diff-refine-added", Bg: "diff_add", Attrs: []string{":weight bold"}},
+	{Face: "diff-refine-removed", Bg: "diff_delete", Attrs: []string{":weight bold"}},
+	{Face: "diff-refine-changed", Bg: "diff_text", Attrs: []string{":weight bold"}},
+	{Face: "diff-header", Fg: "foreground", Bg: "surface"},
+	{Face: "diff-file-header", Fg: "c2", Bg: "surface", Attrs: []string{":weight bold"}},
+	{Face: "diff-hunk-header", Fg: "muted", Bg: "surface"},
+
+	{Face: "flymake-error", Wave: "error"},
+	{Face: "flymake-warning", Wave: "warning"},
+	{Face: "flymake-note", Wave: "info"},
+	{Face: "flycheck-error", Wave: "error"},
+	{Face: "flycheck-warning", Wave: "warning"},
+	{Face: "flycheck-info", Wave: "info"},
+	{Face: "flyspell-incorrect", Wave: "error"},
+	{Face: "flyspell-duplicate", Wave: "warning"},
+
+	{Face: "magit-section-heading", Fg: "c2", Attrs: []string{":weight bold"}},
+	{Face: "magit-section-highlight", Bg: "line_highlight", Attrs: []string{":extend t"}},
+	{Face: "magit-branch-local", Fg: "c5"},
+	{Face: "magit-branch-remote", Fg: "c3"},
+	{Face: "magit-branch-current", Fg: "c5", Box: "c5"},
+	{Face: "magit-tag", Fg: "c4"},
+	{Face: "magit-hash", Fg: "comment"},
+	{Face: "magit-log-author", Fg: "c1"},
+	{Face: "magit-log-date", Fg: "comment"},
+	{Face: "magit-diff-file-heading", Attrs: []string{":weight bold", ":extend t"}},
+	{Face: "magit-diff-hunk-heading", Fg: "muted", Bg: "surface", Attrs: []string{":extend t"}},
+	{Face: "magit-diff-hunk-heading-highlight", Fg: "foreground", Bg: "surface_dark", Attrs: []string{":weight bold", ":extend t"}},
+	{Face: "magit-diff-context", Fg: "comment", Attrs: []string{":extend t"}},
+	{Face: "magit-diff-context-highlight", Fg: "foreground", Bg: "line_highlight", Attrs: []string{":extend t"}},
+	{Face: "magit-diff-added", Fg: "success", Bg: "diff_add", Attrs: []string{":extend t"}},
+	{Face: "magit-diff-added-highlight", Fg: "success", Bg: "diff_add", Attrs: []string{":weight bold", ":extend t"}},
+	{Face: "magit-diff-removed", Fg: "error", Bg: "diff_delete", Attrs: []string{":extend t"}},
+	{Face: "magit-diff-removed-highlight", Fg: "error", Bg: "diff_delete", Attrs: []string{":weight bold", ":extend t"}},
+	{Face: "magit-diffstat-added", Fg: "success"},
+	{Face: "magit-diffstat-removed", Fg: "error"},
+	{Face: "magit-process-ok", Fg: "success", Attrs: []string{":weight bold"}},
+	{Face: "magit-process-ng", Fg: "error", Attrs: []string{":weight bold"}},
+
+	{Face: "company-tooltip", Fg: "foreground", Bg: "surface"},
+	{Face: "company-tooltip-selection", Bg: "selection", Attrs: []string{":weight bold"}},
+	{Face: "company-tooltip-common", Fg: "c2", Attrs: []string{":weight bold"}},
+	{Face: "company-tooltip-common-selection", Fg: "c2", Attrs: []string{":weight bold"}},
+	{Face: "company-tooltip-annotation", Fg: "comment"},
+	{Face: "company-tooltip-annotation-selection", Fg: "muted"},
+	{Face: "company-tooltip-scrollbar-track", Bg: "surface_dark"},
+	{Face: "company-tooltip-scrollbar-thumb", Bg: "border"},
+	{Face: "company-preview", Fg: "comment"},
+	{Face: "company-preview-common", Fg: "c2"},
+	{Face: "company-echo-common", Fg: "c2"},
+
+	{Face: "corfu-default", Fg: "foreground", Bg: "surface"},
+	{Face: "corfu-current", Bg: "selection", Attrs: []string{":weight bold"}},
+	{Face: "corfu-bar", Bg: "border"},
+	{Face: "corfu-border", Bg: "border"},
+	{Face: "corfu-annotations", Fg: "comment"},
+	{Face: "corfu-deprecated", Fg: "comment", Attrs: []string{":strike-through t"}},
+}
+
+// emacsThemeName is the deftheme symbol, which is also the file name stem.
+// Symbols made only of digits would read as numbers, so those get a prefix.
+func emacsThemeName(name string) string {
+	symbol := vimColorschemeName(name)
+	if symbol[0] >= '0' && symbol[0] <= '9' {
+		symbol = "themesmith-" + symbol
+	}
+	return symbol
+}
+
+// emacsFaceSpec renders the attribute plist of a face.
+func emacsFaceSpec(face emacsFace) string {
+	var attrs []string
+	if face.Inherit != "" {
+		attrs = append(attrs, ":inherit "+face.Inherit)
+	}
+	if face.Fg != "" {
+		attrs = append(attrs, ":foreground ,"+face.Fg)
+	}
+	if face.Bg != "" {
+		attrs = append(attrs, ":background ,"+face.Bg)
+	}
+	if face.Box != "" {
+		attrs = append(attrs, ":box (:line-width 1 :color ,"+face.Box+")")
+	}
+	if face.Wave != "" {
+		attrs = append(attrs, ":underline (:style wave :color ,"+face.Wave+")")
+	}
+	attrs = append(attrs, face.Attrs...)
+	return strings.Join(attrs, " ")
+}
+
+// buildEmacsTheme renders <name>-theme.el. Every role, the diff tints and
+// the 16 terminal colors are let-bound, and faces refer to them by name.
+func buildEmacsTheme(name string, roles themeRoles) []byte {
+	symbol := emacsThemeName(name)
+	title := strings.ReplaceAll(name, "\n", " ")
+	palette := vimPalette(roles)
+	scheme := buildTerminalScheme(roles)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ";;; %s-theme.el --- %s, generated by ThemeSmith  -*- lexical-binding: t; -*-\n\n", symbol, title)
+	b.WriteString(";;; Commentary:\n\n;; Generated by ThemeSmith. Put this file in a directory on\n;; `custom-theme-load-path' and run M-x load-theme.\n\n;;; Code:\n\n")
+	fmt.Fprintf(&b, "(deftheme %s %s)\n\n", symbol, strconv.Quote(title+", generated by ThemeSmith."))
+
+	bindings := []string{"(class '((class color) (min-colors 89)))"}
+	for _, role := range vimPaletteRoles {
+		bindings = append(bindings, fmt.Sprintf("(%s %s)", role, strconv.Quote(palette[role])))
+	}
+	for i, hex := range scheme.ANSI {
+		bindings = append(bindings, fmt.Sprintf("(%s %s)", emacsANSIName(i), strconv.Quote(hex)))
+	}
+	fmt.Fprintf(&b, "(let (%s)\n", strings.Join(bindings, "\n      "))
+
+	fmt.Fprintf(&b, "  (custom-theme-set-faces\n   '%s\n", symbol)
+	for _, face := range slices.Concat(emacsBaseFaces, emacsFontLockFaces, emacsTreeSitterFaces, emacsPackageFaces, emacsANSIFaces()) {
+		fmt.Fprintf(&b, "   `(%s ((,class (%s))))\n", face.Face, emacsFaceSpec(face))
+	}
+	b.WriteString("   )\n\n")
+
+	fmt.Fprintf(&b, "  (custom-theme-set-variables\n   '%s\n", symbol)
+	b.WriteString("   `(ansi-color-names-vector\n     [")
+	for i := range 8 {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("," + emacsANSIName(i))
+	}
+	b.WriteString("])))\n\n")
+
+	b.WriteString(";;;###autoload\n(when load-file-name\n  (add-to-list 'custom-theme-load-path\n               (file-name-as-directory (file-name-directory load-file-name))))\n\n")
+	fmt.Fprintf(&b, "(provide-theme '%s)\n\n;;; %s-theme.el ends here\n", symbol, symbol)
+	return []byte(b.String())
+}
+
+// emacsANSIName is the let binding holding terminal color i, e.g. ansi-red
+// or ansi-bright-red.
+func emacsANSIName(i int) string {
+	if i >= 8 {
+		return "ansi-bright-" + terminalANSINames[i-8]
+	}
+	return "ansi-" + terminalANSINames[i]
+}
+
+// emacsANSIFaces styles the ansi-color-* faces Emacs 28 uses for shell and
+// compilation output.
+func emacsANSIFaces() []emacsFace {
+	faces := make([]emacsFace, 0, 16)
+	for i := range 16 {
+		binding := emacsANSIName(i)
+		faces = append(faces, emacsFace{Face: strings.Replace(binding, "ansi-", "ansi-color-", 1), Fg: binding, Bg: binding})
+	}
+	return faces
+}
+
+// ThemeEmacsHandler renders a saved theme of any editor type as an Emacs
+// deftheme for ~/.emacs.d/themes.
+func ThemeEmacsHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	sendAttachment(c, emacsThemeName(theme.Row.Name)+"-theme.el", "text/x-emacs-lisp; charset=utf-8", buildEmacsTheme(theme.Row.Name, theme.Roles))
+}
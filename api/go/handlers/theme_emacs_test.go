@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"themesmith/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildEmacsTheme(t *testing.T) {
+	el := string(buildEmacsTheme("Dusk Theme", vimTestRoles()))
+
+	assert.True(t, strings.HasPrefix(el, ";;; dusk-theme-theme.el --- Dusk Theme, generated by ThemeSmith"))
+	assert.Contains(t, el, `(deftheme dusk-theme "Dusk Theme, generated by ThemeSmith.")`)
+	assert.Contains(t, el, "(let ((class '((class color) (min-colors 89)))\n      (background \"#101010\")\n")
+	assert.Contains(t, el, "   `(default ((,class (:foreground ,foreground :background ,background))))\n")
+	assert.Contains(t, el, "   `(font-lock-keyword-face ((,class (:foreground ,c6))))\n")
+	assert.Contains(t, el, "   `(mode-line ((,class (:foreground ,foreground :background ,surface_dark :box (:line-width 1 :color ,border)))))\n")
+	assert.Contains(t, el, "   `(region ((,class (:background ,selection :extend t))))\n")
+	assert.Contains(t, el, "`(tree-sitter-hl-face:function ((,class (:foreground ,c2))))")
+	assert.Contains(t, el, "`(flycheck-error ((,class (:underline (:style wave :color ,error)))))")
+	assert.Contains(t, el, "`(magit-diff-added ((,class (")
+	assert.Contains(t, el, "`(company-tooltip ((,class (")
+	assert.Contains(t, el, "`(corfu-current ((,class (")
+	assert.Contains(t, el, "`(ansi-color-bright-red ((,class (:foreground ,ansi-bright-red :background ,ansi-bright-red))))")
+	assert.Contains(t, el, "(provide-theme 'dusk-theme)\n")
+	assert.Equal(t, strings.Count(el, "("), strings.Count(el, ")"))
+	assert.NotContains(t, el, "(())")
+}
+
+func TestEmacsThemeName(t *testing.T) {
+	assert.Equal(t, "dusk", emacsThemeName("Dusk"))
+	assert.Equal(t, "themesmith-1984", emacsThemeName("1984"))
+	assert.Equal(t, "generated-theme", emacsThemeName("!!!"))
+}
+
+func TestResolveThemeRolesEmacs(t *testing.T) {
+	roles := resolveThemeRoles(model.Theme{EditorType: "emacs"}, map[string]any{
+		"themeResult": map[string]any{"theme": map[string]any{"palette": map[string]any{"background": "#fafafa", "c3": "#00aa00"}}},
+	})
+	assert.False(t, roles.Dark)
+	assert.Equal(t, "#00aa00", roles.C(3))
+	assert.NoError(t, validateThemePayload(map[string]any{"themeResult": map[string]any{"theme": map[string]any{"background": "light"}}}, "emacs", themeValidationOptions{}))
+	assert.Error(t, validateThemePayload(map[string]any{"themeResult": map[string]any{"theme": map[string]any{"palette": map[string]any{"c1": "blue"}}}}, "emacs", themeValidationOptions{}))
+}
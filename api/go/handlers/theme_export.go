@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxExportThemes = 50
+
+// exportedTheme is a saved theme together with the generated editor theme
+// stored in its payload under themeResult.theme.
+type exportedTheme struct {
+	Row   model.Theme
+	Theme map[string]any
+}
+
+type zipEntry struct {
+	Name string
+	Data []byte
+}
+
+// findReadableTheme loads a theme the caller may read: a shared theme, or one
+// owned by the authenticated user. Anything else is reported as missing.
+func findReadableTheme(c *gin.Context, themeID string) (model.Theme, error) {
+	var theme model.Theme
+	if err := db.DB.First(&theme, "id = ?", themeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Theme{}, &statusError{Status: http.StatusNotFound, Message: "theme not found"}
+		}
+		return model.Theme{}, err
+	}
+	if theme.IsShared {
+		return theme, nil
+	}
+
+	if c.GetHeader("Authorization") != "" {
+		if userID, err := auth.GetUserFromRequest(c); err == nil && theme.UserID != nil && *theme.UserID == userID {
+			return theme, nil
+		}
+	}
+	return model.Theme{}, &statusError{Status: http.StatusNotFound, Message: "theme not found"}
+}
+
+func loadExportedTheme(c *gin.Context, themeID string, editorType string) (exportedTheme, error) {
+	row, err := findReadableTheme(c, themeID)
+	if err != nil {
+		return exportedTheme{}, err
+	}
+	if editorType != "" && row.EditorType != editorType {
+		return exportedTheme{}, badRequestError(fmt.Sprintf("theme %d is a %s theme, not %s", row.ID, row.EditorType, editorType))
+	}
+
+	payload, err := decodeThemePayload(row.JsonData)
+	if err != nil {
+		return exportedTheme{}, fmt.Errorf("failed to decode theme %d: %w", row.ID, err)
+	}
+
+	result, _ := payload["themeResult"].(map[string]any)
+	theme, _ := result["theme"].(map[string]any)
+	if len(theme) == 0 {
+		return exportedTheme{}, &statusError{Status: http.StatusUnprocessableEntity, Message: fmt.Sprintf("theme %d has no generated theme to export", row.ID)}
+	}
+
+	return exportedTheme{Row: row, Theme: theme}, nil
+}
+
+// exportThemeIDs reads the ids query parameter of the multi-theme export
+// routes, accepting both ?ids=1,2 and ?ids=1&ids=2.
+func exportThemeIDs(c *gin.Context) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, raw := range c.QueryArray("ids") {
+		for id := range strings.SplitSeq(raw, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, badRequestError("ids is required")
+	}
+	if len(ids) > maxExportThemes {
+		return nil, badRequestError(fmt.Sprintf("at most %d themes can be exported at once", maxExportThemes))
+	}
+	return ids, nil
+}
+
+func loadExportedThemes(c *gin.Context, ids []string, editorType string) ([]exportedTheme, error) {
+	themes := make([]exportedTheme, 0, len(ids))
+	for _, id := range ids {
+		theme, err := loadExportedTheme(c, id, editorType)
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, theme)
+	}
+	return themes, nil
+}
+
+// themeFileNames gives every theme a distinct file-system friendly base name.
+func themeFileNames(themes []exportedTheme) []string {
+	names := make([]string, len(themes))
+	used := map[string]int{}
+	for i, theme := range themes {
+		base := sanitizeThemeName(theme.Row.Name)
+		if base == "" {
+			base = "generated-theme"
+		}
+		used[base]++
+		if used[base] > 1 {
+			base = fmt.Sprintf("%s-%d", base, used[base])
+		}
+		names[i] = base
+	}
+	return names
+}
+
+// sanitizeThemeName mirrors the desktop app's file naming so exported files
+// match what it installs locally.
+func sanitizeThemeName(name string) string {
+	trimmed := strings.TrimSpace(name)
+	if trimmed == "" {
+		return ""
+	}
+
+	b := strings.Builder{}
+	b.Grow(len(trimmed))
+	for _, r := range trimmed {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+
+		switch r {
+		case ' ', '-', '_', '.':
+			b.WriteRune('-')
+		}
+	}
+
+	sanitized := strings.Trim(b.String(), "-.")
+	for strings.Contains(sanitized, "--") {
+		sanitized = strings.ReplaceAll(sanitized, "--", "-")
+	}
+	return sanitized
+}
+
+func indentedJSON(value any, indent string) ([]byte, error) {
+	encoded, err := json.MarshalIndent(value, "", indent)
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, '\n'), nil
+}
+
+func buildZip(entries []zipEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := writer.Create(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(entry.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sendAttachment(c *gin.Context, fileName string, contentType string, data []byte) {
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// exportVersion derives a package version from the newest theme change, so
+// an edited theme installs as an upgrade rather than being skipped.
+func exportVersion(themes []exportedTheme) string {
+	var latest int64
+	for _, theme := range themes {
+		latest = max(latest, theme.Row.UpdatedAt.Unix())
+	}
+	return fmt.Sprintf("1.0.%d", latest)
+}
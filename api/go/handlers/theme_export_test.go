@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"themesmith/model"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readZipEntries(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	entries := map[string][]byte{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		entries[file.Name] = content
+	}
+	return entries
+}
+
+func TestSanitizeThemeName(t *testing.T) {
+	assert.Equal(t, "my-theme-2", sanitizeThemeName("  My Theme -- 2! "))
+	assert.Equal(t, "", sanitizeThemeName("!!!"))
+}
+
+func TestBuildVSIX(t *testing.T) {
+	updated := time.Unix(1700000000, 0)
+	themes := []exportedTheme{
+		{Row: model.Theme{ID: 1, Name: "Dusk", UpdatedAt: updated}, Theme: map[string]any{"name": "Dusk", "type": "dark"}},
+		{Row: model.Theme{ID: 2, Name: "Dusk", UpdatedAt: updated.Add(time.Hour)}, Theme: map[string]any{"name": "Dusk", "type": "light"}},
+	}
+
+	archive, fileName, err := buildVSIX(themes)
+	require.NoError(t, err)
+	assert.Equal(t, "themesmith-collection-dusk-1.0.1700003600.vsix", fileName)
+
+	entries := readZipEntries(t, archive)
+	assert.Contains(t, entries, "[Content_Types].xml")
+	assert.Contains(t, string(entries["extension.vsixmanifest"]), `<Identity Language="en-US" Id="themesmith-collection-dusk" Version="1.0.1700003600" Publisher="themesmith">`)
+	assert.Contains(t, string(entries["extension.vsixmanifest"]), `Path="extension/package.json"`)
+
+	var pkg vscodePackageJSON
+	require.NoError(t, json.Unmarshal(entries["extension/package.json"], &pkg))
+	assert.Equal(t, []vscodeThemeEntry{
+		{Label: "Dusk", UITheme: "vs-dark", Path: "./themes/dusk.json"},
+		{Label: "Dusk", UITheme: "vs", Path: "./themes/dusk-2.json"},
+	}, pkg.Contributes.Themes)
+	assert.Equal(t, "^1.70.0", pkg.Engines["vscode"])
+
+	assert.JSONEq(t, `{"name":"Dusk","type":"light"}`, string(entries["extension/themes/dusk-2.json"]))
+}
+
+func TestBuildZedExtension(t *testing.T) {
+	themes := []exportedTheme{{
+		Row: model.Theme{ID: 3, Name: `Night "Owl"`, UpdatedAt: time.Unix(1700000000, 0)},
+		Theme: map[string]any{"name": "Night", "themes": []any{
+			map[string]any{"name": "Night Dark", "appearance": "dark", "style": map[string]any{"background": "#000000"}},
+		}},
+	}}
+
+	archive, fileName, err := buildZedExtension(themes, []string{"Ada"})
+	require.NoError(t, err)
+	assert.Equal(t, "themesmith-night-owl-1.0.1700000000.zip", fileName)
+
+	entries := readZipEntries(t, archive)
+	assert.Equal(t, `id = "themesmith-night-owl"
+name = "Night \"Owl\""
+version = "1.0.1700000000"
+schema_version = 1
+authors = ["Ada"]
+description = "Color theme generated by ThemeSmith"
+`, string(entries["themesmith-night-owl/extension.toml"]))
+	assert.JSONEq(t, `{"$schema":"https://zed.dev/schema/themes/v0.2.0.json","name":"Night \"Owl\"","author":"Ada","themes":[{"name":"Night Dark","appearance":"dark","style":{"background":"#000000"}}]}`,
+		string(entries["themesmith-night-owl/themes/night-owl.json"]))
+
+	_, _, err = buildZedExtension([]exportedTheme{{Row: model.Theme{Name: "Empty"}, Theme: map[string]any{"name": "Empty"}}}, []string{"Ada"})
+	assert.Error(t, err)
+}
@@ -57,13 +57,19 @@ func SaveThemeHandler(c *gin.Context) {
 		return
 	}
 
-	payload, info, err := parseThemePayload(body)
+	payload, info, err := parseThemePayload(body, themeValidationOptionsFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondThemePayloadError(c, err)
 		return
 	}
 
-	theme, created, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, string(body))
+	jsonData, err := storedThemeJSON(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode theme"})
+		return
+	}
+
+	theme, created, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, jsonData)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save theme"})
 		return
@@ -106,15 +112,31 @@ func SaveThemesBatchHandler(c *gin.Context) {
 		return
 	}
 
+	// Validate the whole batch first so a bad entry doesn't leave it half saved.
+	opts := themeValidationOptionsFromRequest(c)
+	payloads := make([]map[string]any, len(req.Themes))
+	infos := make([]themePayload, len(req.Themes))
+	for i, rawTheme := range req.Themes {
+		payload, info, err := parseThemePayload(rawTheme, opts)
+		if err != nil {
+			respondThemePayloadError(c, prefixThemeValidationError(err, pointerJoin("/themes", i)))
+			return
+		}
+		payloads[i] = payload
+		infos[i] = info
+	}
+
 	responseThemes := make([]map[string]any, 0, len(req.Themes))
-	for _, rawTheme := range req.Themes {
-		payload, info, err := parseThemePayload(rawTheme)
+	for i := range req.Themes {
+		payload, info := payloads[i], infos[i]
+
+		jsonData, err := storedThemeJSON(payload)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode theme"})
 			return
 		}
 
-		theme, _, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, string(rawTheme))
+		theme, _, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, jsonData)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save theme"})
 			return
@@ -150,19 +172,40 @@ func UpdateThemeHandler(c *gin.Context) {
 		return
 	}
 
+	ifMatch, err := requireIfMatch(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
 	body, err := c.GetRawData()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid theme payload"})
 		return
 	}
 
-	payload, info, err := parseThemePayload(body)
+	payload, info, err := parseThemePayload(body, themeValidationOptionsFromRequest(c))
+	if err != nil {
+		respondThemePayloadError(c, err)
+		return
+	}
+
+	jsonData, err := storedThemeJSON(payload)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode theme"})
 		return
 	}
 
-	theme, err := updateUserTheme(userID, themeID, info.Name, info.EditorType, info.Signature, string(body))
+	theme, err := updateUserTheme(userID, themeID, ifMatch, info.Name, info.EditorType, info.Signature, jsonData)
+	if errors.Is(err, errStaleVersion) {
+		current, err := buildThemeResponse(theme, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+			return
+		}
+		respondStaleVersion(c, theme.Version, "theme", current)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -174,6 +217,7 @@ func UpdateThemeHandler(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", versionETag(theme.Version))
 	c.JSON(http.StatusOK, gin.H{"message": "Theme updated successfully", "theme": responseTheme})
 }
 
@@ -330,10 +374,23 @@ func saveUserTheme(userID uint, name string, editorType string, signature string
 	var theme model.Theme
 	err := db.DB.Where("user_id = ? AND editor_type = ? AND signature = ?", userID, editorType, signature).First(&theme).Error
 	if err == nil {
-		theme.Name = name
-		theme.JsonData = jsonData
-		theme.UpdatedAt = time.Now().UTC()
-		if err := db.DB.Save(&theme).Error; err != nil {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := lockThemeRow(tx, &theme, "id = ?", theme.ID); err != nil {
+				return err
+			}
+			next := theme
+			next.Name = name
+			next.JsonData = jsonData
+			changed, err := snapshotThemeRevision(tx, theme, next)
+			if err != nil || !changed {
+				return err
+			}
+			theme = next
+			theme.Version++
+			theme.UpdatedAt = time.Now().UTC()
+			return tx.Save(&theme).Error
+		})
+		if err != nil {
 			return model.Theme{}, false, err
 		}
 		return theme, false, nil
@@ -357,23 +414,40 @@ func saveUserTheme(userID uint, name string, editorType string, signature string
 	return newTheme, true, nil
 }
 
-func updateUserTheme(userID uint, themeID string, name string, editorType string, signature string, jsonData string) (model.Theme, error) {
+// updateUserTheme overwrites a theme if ifMatch names its current version.
+// On errStaleVersion the returned theme is the current server copy.
+func updateUserTheme(userID uint, themeID string, ifMatch string, name string, editorType string, signature string, jsonData string) (model.Theme, error) {
 	if db.DB == nil {
 		return model.Theme{}, fmt.Errorf("database not available")
 	}
 
 	var theme model.Theme
-	if err := db.DB.Where("id = ? AND user_id = ?", themeID, userID).First(&theme).Error; err != nil {
-		return model.Theme{}, fmt.Errorf("theme not found or unauthorized")
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so a concurrent update cannot pass the same If-Match.
+		if err := lockThemeRow(tx, &theme, "id = ? AND user_id = ?", themeID, userID); err != nil {
+			return fmt.Errorf("theme not found or unauthorized")
+		}
+		if !ifMatchVersion(ifMatch, theme.Version) {
+			return errStaleVersion
+		}
+		next := theme
+		next.Name = name
+		next.EditorType = editorType
+		next.Signature = signature
+		next.JsonData = jsonData
+		changed, err := snapshotThemeRevision(tx, theme, next)
+		if err != nil || !changed {
+			return err
+		}
+		theme = next
+		theme.Version++
+		theme.UpdatedAt = time.Now().UTC()
+		return tx.Save(&theme).Error
+	})
+	if errors.Is(err, errStaleVersion) {
+		return theme, err
 	}
-
-	theme.Name = name
-	theme.EditorType = editorType
-	theme.Signature = signature
-	theme.JsonData = jsonData
-	theme.UpdatedAt = time.Now().UTC()
-
-	if err := db.DB.Save(&theme).Error; err != nil {
+	if err != nil {
 		return model.Theme{}, err
 	}
 
@@ -392,16 +466,10 @@ func getUserThemes(userID uint) ([]json.RawMessage, error) {
 
 	themes := make([]json.RawMessage, 0, len(dbThemes))
 	for _, dbTheme := range dbThemes {
-		payload, err := decodeThemePayload(dbTheme.JsonData)
+		payload, err := buildThemeResponse(dbTheme, nil)
 		if err != nil {
 			continue
 		}
-		payload["id"] = fmt.Sprintf("%d", dbTheme.ID)
-		payload["name"] = dbTheme.Name
-		payload["editorType"] = dbTheme.EditorType
-		payload["signature"] = dbTheme.Signature
-		payload["isShared"] = dbTheme.IsShared
-		payload["sharedAt"] = dbTheme.SharedAt
 		encoded, err := json.Marshal(payload)
 		if err != nil {
 			continue
@@ -464,7 +532,7 @@ func setThemeShared(userID uint, themeID string, shared bool) (model.Theme, erro
 	return theme, nil
 }
 
-func parseThemePayload(body []byte) (map[string]any, themePayload, error) {
+func parseThemePayload(body []byte, opts themeValidationOptions) (map[string]any, themePayload, error) {
 	var payload map[string]any
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return nil, themePayload{}, fmt.Errorf("invalid theme payload")
@@ -484,6 +552,10 @@ func parseThemePayload(body []byte) (map[string]any, themePayload, error) {
 		return nil, themePayload{}, fmt.Errorf("theme signature is required")
 	}
 
+	if err := validateThemePayload(payload, editorType, opts); err != nil {
+		return nil, themePayload{}, err
+	}
+
 	signature = normalizeThemeSignature(signature)
 
 	info := themePayload{
@@ -504,6 +576,29 @@ func normalizeThemeSignature(signature string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// themeRowKeys are the top-level payload keys that buildThemeResponse fills in
+// from the stored row. Clients echo them back when they save a theme they
+// loaded, so they are dropped before a payload is stored and left out of
+// revision diffs.
+var themeRowKeys = []string{"id", "createdAt", "updatedAt", "isShared", "sharedAt", "version", "forkCount", "forkedFromId", "forkedFromUserId"}
+
+func stripThemeRowKeys(payload map[string]any) {
+	for _, key := range themeRowKeys {
+		delete(payload, key)
+	}
+}
+
+// storedThemeJSON encodes payload for Theme.JsonData without the row keys.
+// The keys are removed from payload itself; buildThemeResponse adds them back.
+func storedThemeJSON(payload map[string]any) (string, error) {
+	stripThemeRowKeys(payload)
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
 func decodeThemePayload(raw string) (map[string]any, error) {
 	var payload map[string]any
 	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
@@ -527,6 +622,14 @@ func buildThemeResponse(theme model.Theme, payload map[string]any) (map[string]a
 	payload["signature"] = theme.Signature
 	payload["isShared"] = theme.IsShared
 	payload["sharedAt"] = theme.SharedAt
+	payload["createdAt"] = theme.CreatedAt
+	payload["updatedAt"] = theme.UpdatedAt
+	payload["version"] = theme.Version
+	payload["forkCount"] = theme.ForkCount
+	if theme.ForkedFromID != nil {
+		payload["forkedFromId"] = formatSharedItemID(SharedItemKindTheme, theme.ForkedFromID)
+		payload["forkedFromUserId"] = theme.ForkedFromUserID
+	}
 
 	return payload, nil
 }
@@ -3,8 +3,12 @@ package handlers
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"themesmith/model"
 )
 
 func TestNormalizeThemeSignature(t *testing.T) {
@@ -36,7 +40,7 @@ func TestParseThemePayload(t *testing.T) {
 	t.Run("normalizes long signature", func(t *testing.T) {
 		body := []byte(`{"name":"Theme","editorType":"vscode","signature":"` + strings.Repeat("sig-very-long-", 20) + `"}`)
 
-		_, info, err := parseThemePayload(body)
+		_, info, err := parseThemePayload(body, themeValidationOptions{})
 		if err != nil {
 			t.Fatalf("expected parse to succeed: %v", err)
 		}
@@ -47,7 +51,7 @@ func TestParseThemePayload(t *testing.T) {
 	})
 
 	t.Run("rejects invalid json", func(t *testing.T) {
-		_, _, err := parseThemePayload([]byte("not-json"))
+		_, _, err := parseThemePayload([]byte("not-json"), themeValidationOptions{})
 		if err == nil || err.Error() != "invalid theme payload" {
 			t.Fatalf("expected invalid payload error, got %v", err)
 		}
@@ -78,7 +82,7 @@ func TestParseThemePayload(t *testing.T) {
 
 		for _, tc := range tests {
 			t.Run(tc.name, func(t *testing.T) {
-				_, _, err := parseThemePayload([]byte(tc.body))
+				_, _, err := parseThemePayload([]byte(tc.body), themeValidationOptions{})
 				if err == nil || err.Error() != tc.expectedErr {
 					t.Fatalf("expected %q, got %v", tc.expectedErr, err)
 				}
@@ -86,3 +90,152 @@ func TestParseThemePayload(t *testing.T) {
 		}
 	})
 }
+
+func TestParseThemePayloadValidatesSchema(t *testing.T) {
+	issuePointers := func(t *testing.T, err error) []string {
+		t.Helper()
+		var validationErr *ThemeValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+		pointers := make([]string, 0, len(validationErr.Issues))
+		for _, issue := range validationErr.Issues {
+			pointers = append(pointers, issue.Pointer)
+		}
+		return pointers
+	}
+
+	t.Run("rejects unknown editor types", func(t *testing.T) {
+		_, _, err := parseThemePayload([]byte(`{"name":"Theme","editorType":"notepad","signature":"sig"}`), themeValidationOptions{})
+		pointers := issuePointers(t, err)
+		if !slices.Equal(pointers, []string{"/editorType"}) {
+			t.Fatalf("unexpected pointers %v", pointers)
+		}
+	})
+
+	t.Run("accepts generated vscode theme", func(t *testing.T) {
+		body := []byte(`{"name":"Theme","editorType":"vscode","signature":"sig","themeResult":{
+			"theme":{"name":"Theme","type":"dark","colors":{"editor.background":"#101010","focusBorder":"#ffffff80"},
+				"tokenColors":[{"scope":["comment","string.quoted"],"settings":{"foreground":"#abc","fontStyle":"italic bold"}},{"settings":{"background":"#000000"}}]},
+			"themeOverrides":{"background":"#101010","c1":""},"rawThemeOverrides":{},"colors":[{"hex":"#FF0000"}],"boostCoefficient":1}}`)
+		if _, _, err := parseThemePayload(body, themeValidationOptions{Strict: true}); err != nil {
+			t.Fatalf("expected valid theme, got %v", err)
+		}
+	})
+
+	t.Run("reports vscode issues with json pointers", func(t *testing.T) {
+		body := []byte(`{"name":"Theme","editorType":"vscode","signature":"sig","themeResult":{"theme":{
+			"type":"dim","colors":{"editor.background":"red","a/b":"#000000"},
+			"tokenColors":[{"scope":7,"settings":{"fontStyle":"wavy"}},{"scope":"x"}]}}}`)
+		_, _, err := parseThemePayload(body, themeValidationOptions{})
+		expected := []string{
+			"/themeResult/theme/type",
+			"/themeResult/theme/colors/a~1b",
+			"/themeResult/theme/colors/editor.background",
+			"/themeResult/theme/tokenColors/0/scope",
+			"/themeResult/theme/tokenColors/0/settings/fontStyle",
+			"/themeResult/theme/tokenColors/1/settings",
+		}
+		if pointers := issuePointers(t, err); !slices.Equal(pointers, expected) {
+			t.Fatalf("expected %v, got %v", expected, pointers)
+		}
+		if !strings.HasPrefix(err.Error(), "invalid theme payload at /themeResult/theme/type:") {
+			t.Fatalf("unexpected message %q", err.Error())
+		}
+	})
+
+	t.Run("validates zed theme families", func(t *testing.T) {
+		body := []byte(`{"name":"Theme","editorType":"zed","signature":"sig","themeResult":{"theme":{
+			"$schema":"https://zed.dev/schema/themes/v0.2.0.json","name":"Theme","author":"me","themes":[{
+				"name":"Theme Dark","appearance":"dim","style":{
+					"background":"#101010","border.variant":null,"background.appearance":"frosted",
+					"accents":["#ff0000","nope"],"players":[{"cursor":"#fff","selection":1}],
+					"syntax":{"comment":{"color":"#888888","font_style":"italic","font_weight":700},"keyword":{"font_style":"bold","font_weight":1000}}}}]}}}`)
+		_, _, err := parseThemePayload(body, themeValidationOptions{})
+		expected := []string{
+			"/themeResult/theme/themes/0/appearance",
+			"/themeResult/theme/themes/0/style/accents/1",
+			"/themeResult/theme/themes/0/style/background.appearance",
+			"/themeResult/theme/themes/0/style/players/0/selection",
+			"/themeResult/theme/themes/0/style/syntax/keyword/font_style",
+			"/themeResult/theme/themes/0/style/syntax/keyword/font_weight",
+		}
+		if pointers := issuePointers(t, err); !slices.Equal(pointers, expected) {
+			t.Fatalf("expected %v, got %v", expected, pointers)
+		}
+	})
+
+	t.Run("strict mode rejects unknown keys", func(t *testing.T) {
+		body := []byte(`{"name":"Theme","editorType":"zed","signature":"sig","extra":true,"themeResult":{"theme":{
+			"name":"Theme","themes":[{"name":"Dark","appearance":"dark","style":{"syntax":{"comment":{"color":"#888888","underline":true}}},"icons":{}}]}}}`)
+		if _, _, err := parseThemePayload(body, themeValidationOptions{}); err != nil {
+			t.Fatalf("expected lenient mode to accept unknown keys, got %v", err)
+		}
+
+		_, _, err := parseThemePayload(body, themeValidationOptions{Strict: true})
+		expected := []string{
+			"/extra",
+			"/themeResult/theme/themes/0/icons",
+			"/themeResult/theme/themes/0/style/syntax/comment/underline",
+		}
+		if pointers := issuePointers(t, err); !slices.Equal(pointers, expected) {
+			t.Fatalf("expected %v, got %v", expected, pointers)
+		}
+	})
+
+	t.Run("prefixes batch pointers", func(t *testing.T) {
+		err := prefixThemeValidationError(&ThemeValidationError{Issues: []ThemeValidationIssue{{Pointer: "/editorType", Message: "bad"}}}, pointerJoin("/themes", 2))
+		if pointers := issuePointers(t, err); !slices.Equal(pointers, []string{"/themes/2/editorType"}) {
+			t.Fatalf("unexpected pointers %v", pointers)
+		}
+	})
+}
+
+func TestDiffThemeJSON(t *testing.T) {
+	oldRaw := `{"id":"1","name":"Theme","createdAt":"2024-01-01","themeResult":{"theme":{"colors":{"editor.background":"#000000","a/b":"#111111"},"tokenColors":[{"scope":"comment"}]},"colors":[{"hex":"#ff0000"}]}}`
+	newRaw := `{"id":"2","name":"Theme","themeResult":{"theme":{"colors":{"editor.background":"#222222"},"tokenColors":[]},"colors":[{"hex":"#ff0000"},{"hex":"#00ff00"}]}}`
+
+	changes, err := diffThemeJSON(oldRaw, newRaw)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+
+	expected := []ThemeDiffChange{
+		{Key: "/themeResult/colors/1/hex", Change: "added", New: "#00ff00"},
+		{Key: "/themeResult/theme/colors/a~1b", Change: "removed", Old: "#111111"},
+		{Key: "/themeResult/theme/colors/editor.background", Change: "changed", Old: "#000000", New: "#222222"},
+		{Key: "/themeResult/theme/tokenColors", Change: "added", New: []any{}},
+		{Key: "/themeResult/theme/tokenColors/0/scope", Change: "removed", Old: "comment"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, changes)
+	}
+}
+
+func TestSameThemeState(t *testing.T) {
+	stored := model.Theme{Name: "Theme", EditorType: "vscode", Signature: "sig", JsonData: `{"name": "Theme", "themeResult": {"colors": []}}`}
+
+	same := stored
+	same.JsonData = `{"themeResult":{"colors":[]},"name":"Theme"}`
+	if !sameThemeState(stored, same) {
+		t.Fatalf("expected reformatted payload to be the same state")
+	}
+
+	echoed := stored
+	echoed.JsonData = `{"id":"7","version":3,"isShared":true,"sharedAt":"2026-01-01T00:00:00Z","updatedAt":"2026-01-02T00:00:00Z","name":"Theme","themeResult":{"colors":[]}}`
+	if !sameThemeState(stored, echoed) {
+		t.Fatalf("expected echoed row keys to be ignored")
+	}
+
+	renamed := same
+	renamed.Name = "Renamed"
+	if sameThemeState(stored, renamed) {
+		t.Fatalf("expected a rename to change the state")
+	}
+
+	edited := stored
+	edited.JsonData = `{"name":"Theme","themeResult":{"colors":[{"hex":"#000000"}]}}`
+	if sameThemeState(stored, edited) {
+		t.Fatalf("expected a payload edit to change the state")
+	}
+}
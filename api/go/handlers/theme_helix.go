@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"themesmith/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// helixScope styles one Helix theme scope from palette roles. Underline
+// draws a curly underline in that role's color, as diagnostics use.
+type helixScope struct {
+	Scope     string
+	Fg        string
+	Bg        string
+	Modifiers []string
+	Underline string
+}
+
+var helixScopes = []helixScope{
+	{Scope: "attribute", Fg: "constants"},
+	{Scope: "type", Fg: "c5"},
+	{Scope: "type.builtin", Fg: "c9"},
+	{Scope: "type.enum.variant", Fg: "c9"},
+	{Scope: "constructor", Fg: "c8"},
+	{Scope: "constant", Fg: "constants"},
+	{Scope: "constant.builtin", Fg: "c9"},
+	{Scope: "constant.character.escape", Fg: "c4"},
+	{Scope: "constant.numeric", Fg: "constants"},
+	{Scope: "string", Fg: "c3"},
+	{Scope: "string.regexp", Fg: "constants"},
+	{Scope: "string.special", Fg: "c4"},
+	{Scope: "comment", Fg: "comment", Modifiers: []string{"italic"}},
+	{Scope: "variable", Fg: "foreground"},
+	{Scope: "variable.builtin", Fg: "c9"},
+	{Scope: "variable.parameter", Fg: "c7"},
+	{Scope: "variable.other.member", Fg: "c1"},
+	{Scope: "label", Fg: "c9"},
+	{Scope: "punctuation", Fg: "muted"},
+	{Scope: "punctuation.special", Fg: "c4"},
+	{Scope: "keyword", Fg: "c6"},
+	{Scope: "keyword.operator", Fg: "c8"},
+	{Scope: "operator", Fg: "c8"},
+	{Scope: "function", Fg: "c2"},
+	{Scope: "function.builtin", Fg: "c9"},
+	{Scope: "function.macro", Fg: "c9"},
+	{Scope: "tag", Fg: "c2"},
+	{Scope: "namespace", Fg: "c5"},
+	{Scope: "special", Fg: "c4"},
+
+	{Scope: "markup.heading", Fg: "c2", Modifiers: []string{"bold"}},
+	{Scope: "markup.list", Fg: "c6"},
+	{Scope: "markup.bold", Modifiers: []string{"bold"}},
+	{Scope: "markup.italic", Modifiers: []string{"italic"}},
+	{Scope: "markup.strikethrough", Modifiers: []string{"crossed_out"}},
+	{Scope: "markup.link.url", Fg: "c2", Modifiers: []string{"underlined"}},
+	{Scope: "markup.link.text", Fg: "c1"},
+	{Scope: "markup.quote", Fg: "comment", Modifiers: []string{"italic"}},
+	{Scope: "markup.raw", Fg: "c3"},
+	{Scope: "diff.plus", Fg: "success"},
+	{Scope: "diff.minus", Fg: "error"},
+	{Scope: "diff.delta", Fg: "warning"},
+
+	{Scope: "ui.background", Bg: "background"},
+	{Scope: "ui.text", Fg: "foreground"},
+	{Scope: "ui.text.focus", Fg: "foreground", Modifiers: []string{"bold"}},
+	{Scope: "ui.text.inactive", Fg: "comment"},
+	{Scope: "ui.cursor", Fg: "background", Bg: "muted"},
+	{Scope: "ui.cursor.primary", Fg: "background", Bg: "cursor"},
+	{Scope: "ui.cursor.match", Bg: "selection", Modifiers: []string{"bold"}},
+	{Scope: "ui.cursorline.primary", Bg: "line_highlight"},
+	{Scope: "ui.linenr", Fg: "comment"},
+	{Scope: "ui.linenr.selected", Fg: "foreground", Modifiers: []string{"bold"}},
+	{Scope: "ui.gutter", Bg: "background"},
+	{Scope: "ui.statusline", Fg: "foreground", Bg: "surface_dark"},
+	{Scope: "ui.statusline.inactive", Fg: "comment", Bg: "surface_dark"},
+	{Scope: "ui.statusline.normal", Fg: "background", Bg: "c2", Modifiers: []string{"bold"}},
+	{Scope: "ui.statusline.insert", Fg: "background", Bg: "c3", Modifiers: []string{"bold"}},
+	{Scope: "ui.statusline.select", Fg: "background", Bg: "c6", Modifiers: []string{"bold"}},
+	{Scope: "ui.bufferline", Fg: "comment", Bg: "surface_dark"},
+	{Scope: "ui.bufferline.active", Fg: "foreground", Bg: "background", Modifiers: []string{"bold"}},
+	{Scope: "ui.popup", Fg: "foreground", Bg: "surface"},
+	{Scope: "ui.window", Fg: "border"},
+	{Scope: "ui.help", Fg: "foreground", Bg: "surface"},
+	{Scope: "ui.menu", Fg: "foreground", Bg: "surface"},
+	{Scope: "ui.menu.selected", Bg: "selection", Modifiers: []string{"bold"}},
+	{Scope: "ui.selection", Bg: "selection"},
+	{Scope: "ui.selection.primary", Bg: "selection"},
+	{Scope: "ui.highlight", Bg: "line_highlight"},
+	{Scope: "ui.virtual.whitespace", Fg: "border"},
+	{Scope: "ui.virtual.ruler", Bg: "line_highlight"},
+	{Scope: "ui.virtual.indent-guide", Fg: "border"},
+	{Scope: "ui.virtual.inlay-hint", Fg: "comment"},
+	{Scope: "ui.virtual.jump-label", Fg: "c8", Modifiers: []string{"bold"}},
+
+	{Scope: "error", Fg: "error"},
+	{Scope: "warning", Fg: "warning"},
+	{Scope: "info", Fg: "info"},
+	{Scope: "hint", Fg: "c5"},
+	{Scope: "diagnostic.error", Underline: "error"},
+	{Scope: "diagnostic.warning", Underline: "warning"},
+	{Scope: "diagnostic.info", Underline: "info"},
+	{Scope: "diagnostic.hint", Underline: "c5"},
+}
+
+// buildHelixTheme renders a Helix theme whose scopes refer by name to a
+// [palette] table holding the theme's roles.
+func buildHelixTheme(name string, roles themeRoles) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s, generated by ThemeSmith\n\n", strings.ReplaceAll(name, "\n", " "))
+
+	for _, scope := range helixScopes {
+		var fields []string
+		if scope.Fg != "" {
+			fields = append(fields, "fg = "+tomlString(scope.Fg))
+		}
+		if scope.Bg != "" {
+			fields = append(fields, "bg = "+tomlString(scope.Bg))
+		}
+		if len(scope.Modifiers) > 0 {
+			quoted := make([]string, len(scope.Modifiers))
+			for i, modifier := range scope.Modifiers {
+				quoted[i] = tomlString(modifier)
+			}
+			fields = append(fields, "modifiers = ["+strings.Join(quoted, ", ")+"]")
+		}
+		if scope.Underline != "" {
+			fields = append(fields, fmt.Sprintf("underline = { color = %s, style = \"curl\" }", tomlString(scope.Underline)))
+		}
+		fmt.Fprintf(&b, "%s = { %s }\n", tomlString(scope.Scope), strings.Join(fields, ", "))
+	}
+
+	b.WriteString("\n[palette]\n")
+	for _, role := range themeRoleNames {
+		fmt.Fprintf(&b, "%s = %s\n", role, tomlString(roles.named(role)))
+	}
+	return []byte(b.String())
+}
+
+// ThemeHelixHandler renders a saved theme of any editor type as a Helix theme
+// for ~/.config/helix/themes.
+func ThemeHelixHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	sendAttachment(c, vimColorschemeName(theme.Row.Name)+".toml", "application/toml", buildHelixTheme(theme.Row.Name, theme.Roles))
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildHelixTheme(t *testing.T) {
+	helix := string(buildHelixTheme("Dusk\nTheme", vimTestRoles()))
+
+	assert.Contains(t, helix, "# Dusk Theme, generated by ThemeSmith\n")
+	assert.Contains(t, helix, `"keyword" = { fg = "c6" }`+"\n")
+	assert.Contains(t, helix, `"ui.background" = { bg = "background" }`+"\n")
+	assert.Contains(t, helix, `"comment" = { fg = "comment", modifiers = ["italic"] }`+"\n")
+	assert.Contains(t, helix, `"diagnostic.error" = { underline = { color = "error", style = "curl" } }`+"\n")
+	assert.Contains(t, helix, "\n[palette]\nbackground = \"#101010\"\nforeground = \"#eeeeee\"\n")
+	assert.Contains(t, helix, "c6 = \"#ff00ff\"\n")
+	assert.NotContains(t, helix, `= ""`)
+}
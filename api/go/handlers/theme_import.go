@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultThemeImportMaxBytes = 20 << 20
+	maxImportEntryBytes        = 5 << 20
+	maxImportThemes            = maxExportThemes
+)
+
+var paletteHexPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// importedTheme is one theme found in an uploaded file, ready to be saved.
+type importedTheme struct {
+	Source     string
+	Name       string
+	EditorType string
+	Theme      map[string]any
+}
+
+// ThemeImportIssue reports a file or theme that could not be imported.
+type ThemeImportIssue struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// themePaletteBuilder collects palette colors in first-seen order, keeping
+// only #RRGGBB and #RRGGBBAA values like the generator does.
+type themePaletteBuilder struct {
+	colors []model.Color
+	seen   map[string]bool
+}
+
+func (b *themePaletteBuilder) add(value string) {
+	if !paletteHexPattern.MatchString(value) || b.seen[value] {
+		return
+	}
+	if b.seen == nil {
+		b.seen = map[string]bool{}
+	}
+	b.seen[value] = true
+	b.colors = append(b.colors, model.Color{Hex: value})
+}
+
+// stripJSONC turns JSON with comments into plain JSON by removing // and /* */
+// comments and trailing commas outside of strings.
+func stripJSONC(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	out := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		ch := data[i]
+		if inString {
+			out = append(out, ch)
+			if ch == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case ch == '"':
+			inString = true
+			out = append(out, ch)
+		case ch == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case ch == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out = append(out, ' ')
+		case ch == '}' || ch == ']':
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, ch)
+		default:
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+func decodeJSONC(data []byte) (map[string]any, error) {
+	var obj map[string]any
+	if err := json.Unmarshal(stripJSONC(data), &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// vscodeTokenPaletteSlot mirrors the generator's applyTokenScope: it reports
+// which override slot a token scope feeds, or "" when it feeds none.
+func vscodeTokenPaletteSlot(scope string) string {
+	scope = strings.TrimSpace(scope)
+	switch {
+	case scope == "":
+		return ""
+	case strings.Contains(scope, "variable.other.property"),
+		strings.Contains(scope, "support.type.property-name"),
+		strings.Contains(scope, "variable.member"):
+		return "c1"
+	case strings.Contains(scope, "entity.name.function"),
+		scope == "storage.type",
+		strings.Contains(scope, "support.function"):
+		return "c2"
+	case scope == "string", scope == "string.quoted", scope == "string.template":
+		return "c3"
+	case strings.Contains(scope, "constant.numeric"),
+		strings.Contains(scope, "constant.character"),
+		strings.Contains(scope, "constant.language.boolean"),
+		strings.Contains(scope, "constant.language.null"),
+		strings.Contains(scope, "keyword.constant"),
+		scope == "number",
+		strings.Contains(scope, "support.constant"):
+		return "constants"
+	case strings.Contains(scope, "entity.name.class"),
+		scope == "support.type",
+		strings.Contains(scope, "entity.name.type"):
+		return "c5"
+	case scope == "keyword", scope == "keyword.control", scope == "storage":
+		return "c6"
+	case scope == "variable.parameter", scope == "entity.name.type.enum":
+		return "c7"
+	case scope == "keyword.operator", scope == "punctuation.operator":
+		return "c8"
+	case scope == "variable.builtin",
+		scope == "variable.special",
+		scope == "variable.other.enummember",
+		strings.Contains(scope, "support.variable"):
+		return "c9"
+	}
+	return ""
+}
+
+func setOverride(overrides map[string]any, slot string, value string) {
+	if _, ok := overrides[slot]; !ok && value != "" {
+		overrides[slot] = value
+	}
+}
+
+// deriveVSCodePalette extracts overrides and palette colors from a VS Code
+// theme the same way the generator does when regenerating it.
+func deriveVSCodePalette(theme map[string]any) (map[string]any, []model.Color) {
+	colors, _ := theme["colors"].(map[string]any)
+	overrides := map[string]any{}
+	var palette themePaletteBuilder
+
+	for _, pair := range [][2]string{
+		{"background", "editor.background"},
+		{"foreground", "editor.foreground"},
+		{"c4", "statusBar.debuggingBackground"},
+	} {
+		if value, ok := stringValue(colors, pair[1]); ok {
+			setOverride(overrides, pair[0], value)
+			palette.add(value)
+		}
+	}
+	for _, key := range []string{"editorWarning.foreground", "editorInfo.foreground", "editorGutter.addedBackground", "textLink.foreground", "editorCursor.foreground"} {
+		if value, ok := stringValue(colors, key); ok {
+			palette.add(value)
+		}
+	}
+
+	tokenColors, _ := theme["tokenColors"].([]any)
+	for _, raw := range tokenColors {
+		token, _ := raw.(map[string]any)
+		settings, _ := token["settings"].(map[string]any)
+		foreground, ok := stringValue(settings, "foreground")
+		if !ok {
+			continue
+		}
+		for _, scope := range vscodeTokenScopes(token) {
+			if slot := vscodeTokenPaletteSlot(scope); slot != "" {
+				setOverride(overrides, slot, foreground)
+				break
+			}
+		}
+		palette.add(foreground)
+	}
+
+	return overrides, palette.colors
+}
+
+// deriveZedPalette extracts overrides and palette colors from the first
+// variant of a Zed theme family, following the generator's Zed import.
+func deriveZedPalette(family map[string]any) (map[string]any, []model.Color) {
+	overrides := map[string]any{}
+	var palette themePaletteBuilder
+
+	themes, _ := family["themes"].([]any)
+	if len(themes) == 0 {
+		return overrides, nil
+	}
+	variant, _ := themes[0].(map[string]any)
+	style, _ := variant["style"].(map[string]any)
+
+	if value, ok := stringValue(style, "background"); ok {
+		setOverride(overrides, "background", value)
+		palette.add(value)
+	}
+	if value, ok := stringValue(style, "text"); ok {
+		setOverride(overrides, "foreground", value)
+		palette.add(value)
+	}
+
+	accents, _ := style["accents"].([]any)
+	for i, raw := range accents[:min(len(accents), 8)] {
+		if accent, ok := raw.(string); ok {
+			setOverride(overrides, fmt.Sprintf("c%d", i+1), accent)
+			palette.add(accent)
+		}
+	}
+
+	for _, keys := range [][]string{
+		{"error", "deleted", "conflict"},
+		{"warning", "modified", "conflict"},
+		{"success", "created"},
+		{"info", "renamed"},
+	} {
+		for _, key := range keys {
+			if value, ok := stringValue(style, key); ok {
+				palette.add(value)
+				break
+			}
+		}
+	}
+
+	syntax, _ := style["syntax"].(map[string]any)
+	syntaxColor := func(key string) (string, bool) {
+		highlight, _ := syntax[key].(map[string]any)
+		return stringValue(highlight, "color")
+	}
+	if value, ok := syntaxColor("constant"); ok {
+		setOverride(overrides, "constants", value)
+		palette.add(value)
+	}
+	if value, ok := syntaxColor("number"); ok {
+		palette.add(value)
+	}
+	for _, key := range []string{"variable.builtin", "variable.special", "predoc", "variant"} {
+		if value, ok := syntaxColor(key); ok {
+			setOverride(overrides, "c9", value)
+			palette.add(value)
+			break
+		}
+	}
+
+	return overrides, palette.colors
+}
+
+// splitZedFamily stores every variant of a family as its own theme so each
+// can be edited and exported on its own.
+func splitZedFamily(source string, family map[string]any) ([]importedTheme, error) {
+	variants, _ := family["themes"].([]any)
+	if len(variants) == 0 {
+		return nil, errors.New("zed theme family has no themes")
+	}
+
+	author, _ := family["author"].(string)
+	familyName, _ := family["name"].(string)
+	themes := make([]importedTheme, 0, len(variants))
+	for _, raw := range variants {
+		variant, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := variant["name"].(string)
+		if strings.TrimSpace(name) == "" {
+			name = familyName
+		}
+		themes = append(themes, importedTheme{
+			Source:     source,
+			Name:       name,
+			EditorType: "zed",
+			Theme: map[string]any{
+				"$schema": zedThemeSchema,
+				"name":    name,
+				"author":  author,
+				"themes":  []any{variant},
+			},
+		})
+	}
+	return themes, nil
+}
+
+// parseThemeJSONFile reads a VS Code theme or a Zed theme family.
+func parseThemeJSONFile(source string, data []byte) ([]importedTheme, error) {
+	obj, err := decodeJSONC(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if _, ok := obj["themes"]; ok {
+		return splitZedFamily(source, obj)
+	}
+	if _, hasColors := obj["colors"]; !hasColors {
+		if _, hasTokens := obj["tokenColors"]; !hasTokens {
+			return nil, errors.New("file is neither a VS Code theme nor a Zed theme family")
+		}
+	}
+
+	name, _ := obj["name"].(string)
+	return []importedTheme{{Source: source, Name: name, EditorType: "vscode", Theme: obj}}, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > maxImportEntryBytes {
+		return nil, fmt.Errorf("%s exceeds %d bytes", file.Name, maxImportEntryBytes)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxImportEntryBytes))
+}
+
+// loadVSIXTheme reads a contributed theme, merging the themes it includes
+// the way VS Code does: included colors are overridden and included token
+// rules come first.
+func loadVSIXTheme(files map[string]*zip.File, name string, depth int) (map[string]any, error) {
+	file, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the package", name)
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil, err
+	}
+	theme, err := decodeJSONC(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid JSON: %w", name, err)
+	}
+
+	include, _ := theme["include"].(string)
+	if include == "" || depth >= 5 {
+		return theme, nil
+	}
+	base, err := loadVSIXTheme(files, path.Join(path.Dir(name), include), depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	colors := map[string]any{}
+	baseColors, _ := base["colors"].(map[string]any)
+	ownColors, _ := theme["colors"].(map[string]any)
+	for key, value := range baseColors {
+		colors[key] = value
+	}
+	for key, value := range ownColors {
+		colors[key] = value
+	}
+	baseTokens, _ := base["tokenColors"].([]any)
+	ownTokens, _ := theme["tokenColors"].([]any)
+
+	theme["colors"] = colors
+	theme["tokenColors"] = append(append([]any{}, baseTokens...), ownTokens...)
+	if _, ok := theme["type"]; !ok && base["type"] != nil {
+		theme["type"] = base["type"]
+	}
+	delete(theme, "include")
+	return theme, nil
+}
+
+// parseVSIX extracts every theme a VS Code extension contributes.
+func parseVSIX(source string, data []byte) ([]importedTheme, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VSIX archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+
+	packageFile, ok := files["extension/package.json"]
+	if !ok {
+		return nil, errors.New("VSIX archive has no extension/package.json")
+	}
+	packageData, err := readZipFile(packageFile)
+	if err != nil {
+		return nil, err
+	}
+	var pkg vscodePackageJSON
+	if err := json.Unmarshal(stripJSONC(packageData), &pkg); err != nil {
+		return nil, fmt.Errorf("invalid package.json: %w", err)
+	}
+	if len(pkg.Contributes.Themes) == 0 {
+		return nil, errors.New("extension contributes no color themes")
+	}
+
+	themes := make([]importedTheme, 0, len(pkg.Contributes.Themes))
+	for _, entry := range pkg.Contributes.Themes {
+		name := path.Join("extension", path.Clean("/"+entry.Path))
+		theme, err := loadVSIXTheme(files, name, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		label := strings.TrimSpace(entry.Label)
+		if label == "" {
+			label, _ = theme["name"].(string)
+		}
+		if _, ok := theme["type"]; !ok {
+			switch entry.UITheme {
+			case "vs":
+				theme["type"] = "light"
+			case "hc-black":
+				theme["type"] = "hc"
+			case "hc-light":
+				theme["type"] = "hc-light"
+			default:
+				theme["type"] = "dark"
+			}
+		}
+		themes = append(themes, importedTheme{
+			Source:     source + ":" + entry.Path,
+			Name:       label,
+			EditorType: "vscode",
+			Theme:      theme,
+		})
+	}
+	return themes, nil
+}
+
+// parseThemeImportFile detects whether data is a VSIX archive or a theme JSON
+// file and returns the themes it contains.
+func parseThemeImportFile(source string, data []byte) ([]importedTheme, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseVSIX(source, data)
+	}
+	return parseThemeJSONFile(source, data)
+}
+
+// buildImportedThemePayload wraps an imported theme in the payload the
+// frontend saves, deriving the palette and signature from it.
+func buildImportedThemePayload(theme importedTheme) (map[string]any, themePayload, error) {
+	name := strings.TrimSpace(theme.Name)
+	if name == "" {
+		name = "Imported Theme"
+	}
+
+	var overrides map[string]any
+	var palette []model.Color
+	if theme.EditorType == "zed" {
+		overrides, palette = deriveZedPalette(theme.Theme)
+	} else {
+		overrides, palette = deriveVSCodePalette(theme.Theme)
+	}
+	if len(palette) == 0 {
+		return nil, themePayload{}, errors.New("theme has no colors to build a palette from")
+	}
+
+	colors := make([]any, len(palette))
+	for i, color := range palette {
+		colors[i] = map[string]any{"hex": color.Hex}
+	}
+	rawOverrides := make(map[string]any, len(overrides))
+	for key, value := range overrides {
+		rawOverrides[key] = value
+	}
+
+	result := map[string]any{
+		"theme":             theme.Theme,
+		"themeOverrides":    overrides,
+		"rawThemeOverrides": rawOverrides,
+		"colors":            colors,
+		"boostCoefficient":  1,
+	}
+	signature, err := themeResultSignature(result)
+	if err != nil {
+		return nil, themePayload{}, err
+	}
+
+	payload := map[string]any{
+		"name":        name,
+		"editorType":  theme.EditorType,
+		"signature":   signature,
+		"themeResult": result,
+	}
+	if err := validateThemePayload(payload, theme.EditorType, themeValidationOptions{}); err != nil {
+		return nil, themePayload{}, err
+	}
+	return payload, themePayload{Name: name, EditorType: theme.EditorType, Signature: signature}, nil
+}
+
+// readThemeImportFiles returns the uploaded files, taken from the "file" or
+// "files" multipart fields or, for other content types, the raw body.
+func readThemeImportFiles(c *gin.Context, maxBytes int64) (map[string][]byte, []string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	tooLarge := func(err error) error {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return &statusError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("request body exceeds %d bytes", maxBytes)}
+		}
+		return badRequestError("failed to read upload")
+	}
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, nil, tooLarge(err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, nil, badRequestError("no theme file provided")
+		}
+		return map[string][]byte{"body": data}, []string{"body"}, nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, nil, tooLarge(err)
+	}
+
+	files := map[string][]byte{}
+	var order []string
+	for _, field := range []string{"file", "files"} {
+		for _, header := range form.File[field] {
+			f, err := header.Open()
+			if err != nil {
+				return nil, nil, badRequestError("failed to read upload")
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, tooLarge(err)
+			}
+
+			source := header.Filename
+			for i := 2; files[source] != nil; i++ {
+				source = fmt.Sprintf("%s (%d)", header.Filename, i)
+			}
+			files[source] = data
+			order = append(order, source)
+		}
+	}
+	if len(order) == 0 {
+		return nil, nil, badRequestError("no theme file provided")
+	}
+	return files, order, nil
+}
+
+// ImportThemesHandler saves every theme found in the uploaded VS Code theme
+// JSON (comments and trailing commas allowed), Zed theme family or VSIX
+// archive. Themes that cannot be imported are reported without failing the
+// rest.
+func ImportThemesHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to import themes"})
+		return
+	}
+
+	files, order, err := readThemeImportFiles(c, envInt64("THEME_IMPORT_MAX_BYTES", defaultThemeImportMaxBytes))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	var found []importedTheme
+	issues := []ThemeImportIssue{}
+	for _, source := range order {
+		themes, err := parseThemeImportFile(source, files[source])
+		if err != nil {
+			issues = append(issues, ThemeImportIssue{Source: source, Error: err.Error()})
+			continue
+		}
+		found = append(found, themes...)
+	}
+	if len(found) > maxImportThemes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d themes can be imported at once", maxImportThemes)})
+		return
+	}
+
+	saved := make([]map[string]any, 0, len(found))
+	for _, theme := range found {
+		payload, info, err := buildImportedThemePayload(theme)
+		if err != nil {
+			issues = append(issues, ThemeImportIssue{Source: theme.Source, Error: err.Error()})
+			continue
+		}
+
+		jsonData, err := storedThemeJSON(payload)
+		if err != nil {
+			issues = append(issues, ThemeImportIssue{Source: theme.Source, Error: "failed to encode theme"})
+			continue
+		}
+
+		row, _, err := saveUserTheme(userID, info.Name, info.EditorType, info.Signature, jsonData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save theme"})
+			return
+		}
+
+		response, err := buildThemeResponse(row, payload)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+			return
+		}
+		saved = append(saved, response)
+	}
+
+	if len(saved) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No themes could be imported", "errors": issues})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Themes imported successfully",
+		"themes":  saved,
+		"errors":  issues,
+	})
+}
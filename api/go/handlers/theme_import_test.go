@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"themesmith/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripJSONC(t *testing.T) {
+	input := "\xef\xbb\xbf" + `{
+		// line comment
+		"url": "https://example.com/*not a comment*/", /* block */
+		"list": [1, 2, ],
+		"quote": "a \"// b\"",
+	}`
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(stripJSONC([]byte(input)), &decoded))
+	assert.Equal(t, "https://example.com/*not a comment*/", decoded["url"])
+	assert.Equal(t, []any{float64(1), float64(2)}, decoded["list"])
+	assert.Equal(t, `a "// b"`, decoded["quote"])
+}
+
+func TestParseThemeImportFileVSCodeJSONC(t *testing.T) {
+	data := []byte(`{
+		// exported from VS Code
+		"name": "Dusk",
+		"type": "dark",
+		"colors": {
+			"editor.background": "#101010",
+			"editor.foreground": "#eeeeee",
+			"editorCursor.foreground": "#ffcc00",
+		},
+		"tokenColors": [
+			{"scope": "keyword", "settings": {"foreground": "#ff0000"}},
+			{"scope": "string, comment", "settings": {"foreground": "#00ff00"}},
+			{"scope": ["variable.other.property"], "settings": {"foreground": "#0000ff"}},
+			{"scope": "keyword.control", "settings": {"foreground": "#ff00ff"}},
+		],
+	}`)
+
+	themes, err := parseThemeImportFile("dusk.json", data)
+	require.NoError(t, err)
+	require.Len(t, themes, 1)
+	assert.Equal(t, "vscode", themes[0].EditorType)
+	assert.Equal(t, "Dusk", themes[0].Name)
+
+	overrides, palette := deriveVSCodePalette(themes[0].Theme)
+	assert.Equal(t, map[string]any{
+		"background": "#101010",
+		"foreground": "#eeeeee",
+		"c6":         "#ff0000",
+		"c3":         "#00ff00",
+		"c1":         "#0000ff",
+	}, overrides)
+	assert.Equal(t, []model.Color{
+		{Hex: "#101010"}, {Hex: "#eeeeee"}, {Hex: "#ffcc00"},
+		{Hex: "#ff0000"}, {Hex: "#00ff00"}, {Hex: "#0000ff"}, {Hex: "#ff00ff"},
+	}, palette)
+
+	_, err = parseThemeImportFile("other.json", []byte(`{"foo": 1}`))
+	assert.Error(t, err)
+	_, err = parseThemeImportFile("broken.json", []byte(`{"colors": `))
+	assert.Error(t, err)
+}
+
+func TestParseThemeImportFileSplitsZedFamily(t *testing.T) {
+	data := []byte(`{
+		"name": "Seasons",
+		"author": "Someone",
+		"themes": [
+			{"name": "Winter", "appearance": "dark", "style": {
+				"background": "#000000",
+				"text": "#ffffff",
+				"accents": ["#111111", "#222222"],
+				"error": "#ff0000",
+				"syntax": {"constant": {"color": "#333333"}, "variant": {"color": "#444444"}}
+			}},
+			{"name": "Summer", "appearance": "light", "style": {"background": "#ffffff"}}
+		]
+	}`)
+
+	themes, err := parseThemeImportFile("seasons.json", data)
+	require.NoError(t, err)
+	require.Len(t, themes, 2)
+	assert.Equal(t, "Winter", themes[0].Name)
+	assert.Equal(t, "Summer", themes[1].Name)
+	assert.Len(t, themes[1].Theme["themes"], 1)
+
+	overrides, palette := deriveZedPalette(themes[0].Theme)
+	assert.Equal(t, map[string]any{
+		"background": "#000000",
+		"foreground": "#ffffff",
+		"c1":         "#111111",
+		"c2":         "#222222",
+		"constants":  "#333333",
+		"c9":         "#444444",
+	}, overrides)
+	assert.Len(t, palette, 7)
+}
+
+func TestParseThemeImportFileVSIX(t *testing.T) {
+	archive, _, err := buildVSIX([]exportedTheme{
+		{Row: model.Theme{Name: "Dusk"}, Theme: map[string]any{"name": "Dusk", "type": "dark", "colors": map[string]any{"editor.background": "#101010"}}},
+		{Row: model.Theme{Name: "Dawn"}, Theme: map[string]any{"name": "Dawn", "type": "light", "colors": map[string]any{"editor.background": "#fafafa"}}},
+	})
+	require.NoError(t, err)
+
+	themes, err := parseThemeImportFile("pack.vsix", archive)
+	require.NoError(t, err)
+	require.Len(t, themes, 2)
+	assert.Equal(t, "Dusk", themes[0].Name)
+	assert.Equal(t, "Dawn", themes[1].Name)
+	assert.Equal(t, "light", themes[1].Theme["type"])
+	assert.Equal(t, "pack.vsix:./themes/dawn.json", themes[1].Source)
+}
+
+func TestLoadVSIXThemeMergesIncludes(t *testing.T) {
+	archive, err := buildZip([]zipEntry{
+		{Name: "extension/package.json", Data: []byte(`{"contributes": {"themes": [{"label": "Child", "uiTheme": "vs", "path": "./themes/child.json"}]}}`)},
+		{Name: "extension/themes/base.json", Data: []byte(`{"colors": {"editor.background": "#000000", "editor.foreground": "#cccccc"}, "tokenColors": [{"scope": "string", "settings": {"foreground": "#00ff00"}}]}`)},
+		{Name: "extension/themes/child.json", Data: []byte(`{"include": "./base.json", "colors": {"editor.background": "#111111"}, "tokenColors": [{"scope": "keyword", "settings": {"foreground": "#ff0000"}}]}`)},
+	})
+	require.NoError(t, err)
+
+	themes, err := parseThemeImportFile("child.vsix", archive)
+	require.NoError(t, err)
+	require.Len(t, themes, 1)
+
+	theme := themes[0].Theme
+	assert.Equal(t, "light", theme["type"])
+	assert.NotContains(t, theme, "include")
+	assert.Equal(t, map[string]any{"editor.background": "#111111", "editor.foreground": "#cccccc"}, theme["colors"])
+	assert.Len(t, theme["tokenColors"], 2)
+}
+
+func TestBuildImportedThemePayload(t *testing.T) {
+	payload, info, err := buildImportedThemePayload(importedTheme{
+		EditorType: "vscode",
+		Theme:      map[string]any{"type": "dark", "colors": map[string]any{"editor.background": "#101010"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Imported Theme", info.Name)
+	assert.Len(t, info.Signature, 64)
+
+	result := payload["themeResult"].(map[string]any)
+	assert.Equal(t, []model.Color{{Hex: "#101010"}}, extractPaletteFromThemePayload(payload))
+	assert.Equal(t, map[string]any{"background": "#101010"}, result["themeOverrides"])
+
+	_, _, err = buildImportedThemePayload(importedTheme{EditorType: "vscode", Theme: map[string]any{"colors": map[string]any{}}})
+	assert.Error(t, err)
+}
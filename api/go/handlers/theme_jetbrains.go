@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"themesmith/db"
+	"themesmith/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jetbrainsSinceBuild    = "223"
+	jetbrainsSchemeVersion = "142"
+)
+
+var jetbrainsThemeKeys = []string{"name", "dark", "author", "editorScheme", "parentTheme", "colors", "ui", "icons", "background", "emptyFrameBackground"}
+
+// jetbrainsAttribute styles one editor color scheme attribute from palette
+// roles. FontType is 1 for bold, 2 for italic and 3 for both.
+type jetbrainsAttribute struct {
+	Name       string
+	Foreground string
+	Background string
+	FontType   int
+	Effect     string
+	EffectType int
+}
+
+// jetbrainsSchemeColors are the editor chrome colors of the .icls scheme.
+var jetbrainsSchemeColors = []struct{ Name, Role string }{
+	{"CARET_COLOR", "cursor"},
+	{"CARET_ROW_COLOR", "line_highlight"},
+	{"CONSOLE_BACKGROUND_KEY", "background"},
+	{"GUTTER_BACKGROUND", "background"},
+	{"INDENT_GUIDE", "border"},
+	{"SELECTED_INDENT_GUIDE", "muted"},
+	{"LINE_NUMBERS_COLOR", "comment"},
+	{"LINE_NUMBER_ON_CARET_ROW_COLOR", "foreground"},
+	{"METHOD_SEPARATORS_COLOR", "border"},
+	{"RIGHT_MARGIN_COLOR", "border"},
+	{"SELECTION_BACKGROUND", "selection"},
+	{"TEARLINE_COLOR", "border"},
+	{"WHITESPACES", "border"},
+	{"ADDED_LINES_COLOR", "success"},
+	{"MODIFIED_LINES_COLOR", "warning"},
+	{"DELETED_LINES_COLOR", "error"},
+}
+
+// jetbrainsSchemeAttributes maps the platform's DEFAULT_* attributes, which
+// every language inherits, onto the same roles the editor generators use.
+var jetbrainsSchemeAttributes = []jetbrainsAttribute{
+	{Name: "TEXT", Foreground: "foreground", Background: "background"},
+	{Name: "DEFAULT_KEYWORD", Foreground: "c6"},
+	{Name: "DEFAULT_STRING", Foreground: "c3"},
+	{Name: "DEFAULT_VALID_STRING_ESCAPE", Foreground: "c4"},
+	{Name: "DEFAULT_INVALID_STRING_ESCAPE", Foreground: "error", Effect: "error", EffectType: 2},
+	{Name: "DEFAULT_NUMBER", Foreground: "constants"},
+	{Name: "DEFAULT_CONSTANT", Foreground: "constants"},
+	{Name: "DEFAULT_METADATA", Foreground: "constants"},
+	{Name: "DEFAULT_LINE_COMMENT", Foreground: "comment", FontType: 2},
+	{Name: "DEFAULT_BLOCK_COMMENT", Foreground: "comment", FontType: 2},
+	{Name: "DEFAULT_DOC_COMMENT", Foreground: "comment", FontType: 2},
+	{Name: "DEFAULT_DOC_COMMENT_TAG", Foreground: "c6", FontType: 2},
+	{Name: "DEFAULT_FUNCTION_DECLARATION", Foreground: "c2"},
+	{Name: "DEFAULT_FUNCTION_CALL", Foreground: "c2"},
+	{Name: "DEFAULT_STATIC_METHOD", Foreground: "c2", FontType: 2},
+	{Name: "DEFAULT_INSTANCE_METHOD", Foreground: "c2"},
+	{Name: "DEFAULT_INSTANCE_FIELD", Foreground: "c1"},
+	{Name: "DEFAULT_STATIC_FIELD", Foreground: "c1", FontType: 2},
+	{Name: "DEFAULT_CLASS_NAME", Foreground: "c5"},
+	{Name: "DEFAULT_INTERFACE_NAME", Foreground: "c5"},
+	{Name: "DEFAULT_CLASS_REFERENCE", Foreground: "c5"},
+	{Name: "DEFAULT_PARAMETER", Foreground: "c7"},
+	{Name: "DEFAULT_OPERATION_SIGN", Foreground: "c8"},
+	{Name: "DEFAULT_PREDEFINED_SYMBOL", Foreground: "c9"},
+	{Name: "DEFAULT_LABEL", Foreground: "c9"},
+	{Name: "DEFAULT_IDENTIFIER", Foreground: "foreground"},
+	{Name: "DEFAULT_LOCAL_VARIABLE", Foreground: "foreground"},
+	{Name: "DEFAULT_GLOBAL_VARIABLE", Foreground: "c9"},
+	{Name: "DEFAULT_BRACES", Foreground: "muted"},
+	{Name: "DEFAULT_BRACKETS", Foreground: "muted"},
+	{Name: "DEFAULT_PARENTHS", Foreground: "muted"},
+	{Name: "DEFAULT_COMMA", Foreground: "muted"},
+	{Name: "DEFAULT_SEMICOLON", Foreground: "muted"},
+	{Name: "DEFAULT_DOT", Foreground: "muted"},
+	{Name: "DEFAULT_TAG", Foreground: "c2"},
+	{Name: "DEFAULT_ATTRIBUTE", Foreground: "c1"},
+	{Name: "DEFAULT_ENTITY", Foreground: "c4"},
+	{Name: "DEFAULT_TEMPLATE_LANGUAGE_COLOR", Foreground: "foreground"},
+	{Name: "ERRORS_ATTRIBUTES", Effect: "error", EffectType: 2},
+	{Name: "WARNING_ATTRIBUTES", Effect: "warning", EffectType: 2},
+	{Name: "INFO_ATTRIBUTES", Effect: "info", EffectType: 2},
+	{Name: "TODO_DEFAULT_ATTRIBUTES", Foreground: "c8", FontType: 3},
+	{Name: "HYPERLINK_ATTRIBUTES", Foreground: "c2", Effect: "c2", EffectType: 1},
+	{Name: "SEARCH_RESULT_ATTRIBUTES", Background: "selection"},
+	{Name: "IDENTIFIER_UNDER_CARET_ATTRIBUTES", Background: "line_highlight"},
+	{Name: "MATCHED_BRACE_ATTRIBUTES", Background: "selection", FontType: 1},
+}
+
+// jetbrainsUIColors is the named color table of the generated .theme.json;
+// the ui section below refers to these names.
+var jetbrainsUIColors = []string{"background", "foreground", "surface", "surface_dark", "line_highlight", "selection", "border", "muted", "comment", "c2", "c5", "error", "warning", "success"}
+
+var jetbrainsUI = map[string]any{
+	"*": map[string]any{
+		"background":                  "surface",
+		"foreground":                  "foreground",
+		"infoForeground":              "comment",
+		"selectionBackground":         "selection",
+		"selectionForeground":         "foreground",
+		"selectionInactiveBackground": "line_highlight",
+		"borderColor":                 "border",
+		"separatorColor":              "border",
+		"disabledForeground":          "comment",
+		"hoverBackground":             "line_highlight",
+		"focusColor":                  "c2",
+		"focusedBorderColor":          "c2",
+	},
+	"Editor.background":                                          "background",
+	"EditorTabs.background":                                      "surface_dark",
+	"EditorTabs.underlinedTabBackground":                         "background",
+	"EditorTabs.underlineColor":                                  "c2",
+	"MainToolbar.background":                                     "surface_dark",
+	"MainWindow.background":                                      "surface_dark",
+	"StatusBar.background":                                       "surface_dark",
+	"ToolWindow.background":                                      "surface",
+	"ToolWindow.Header.background":                               "surface",
+	"ToolWindow.Header.inactiveBackground":                       "surface",
+	"Panel.background":                                           "surface",
+	"Tree.background":                                            "surface",
+	"List.background":                                            "surface",
+	"Popup.background":                                           "surface",
+	"Button.default.startBackground":                             "c2",
+	"Button.default.endBackground":                               "c2",
+	"Button.default.foreground":                                  "background",
+	"Link.activeForeground":                                      "c2",
+	"Link.hoverForeground":                                       "c5",
+	"ProgressBar.progressColor":                                  "c2",
+	"Component.errorFocusColor":                                  "error",
+	"Component.warningFocusColor":                                "warning",
+	"ValidationTooltip.errorBorderColor":                         "error",
+	"ValidationTooltip.warningBorderColor":                       "warning",
+	"Notification.ToolWindow.informativeBackground":              "surface",
+	"VersionControl.FileHistory.Commit.selectedBranchBackground": "selection",
+}
+
+// deriveJetBrainsPalette reads the roles back out of a generated
+// .theme.json, whose named colors use the role names.
+func deriveJetBrainsPalette(theme map[string]any) (map[string]any, []model.Color) {
+	colors, _ := theme["colors"].(map[string]any)
+	return deriveRolePalette(colors)
+}
+
+func jetbrainsColor(hex string) string {
+	return strings.TrimPrefix(hex, "#")
+}
+
+func writeXMLAttr(b *bytes.Buffer, value string) {
+	xml.EscapeText(b, []byte(value))
+}
+
+// buildJetBrainsScheme renders an .icls editor color scheme.
+func buildJetBrainsScheme(name string, roles themeRoles) []byte {
+	var b bytes.Buffer
+	parent := "Darcula"
+	if !roles.Dark {
+		parent = "Default"
+	}
+
+	b.WriteString(`<scheme name="`)
+	writeXMLAttr(&b, name)
+	fmt.Fprintf(&b, `" version="%s" parent_scheme="%s">`+"\n", jetbrainsSchemeVersion, parent)
+	b.WriteString("  <metaInfo>\n")
+	b.WriteString(`    <property name="ide">idea</property>` + "\n")
+	b.WriteString(`    <property name="originalScheme">`)
+	writeXMLAttr(&b, name)
+	b.WriteString("</property>\n")
+	b.WriteString("  </metaInfo>\n")
+
+	b.WriteString("  <colors>\n")
+	for _, entry := range jetbrainsSchemeColors {
+		fmt.Fprintf(&b, `    <option name="%s" value="%s" />`+"\n", entry.Name, jetbrainsColor(roles.named(entry.Role)))
+	}
+	b.WriteString("  </colors>\n")
+
+	b.WriteString("  <attributes>\n")
+	for _, attr := range jetbrainsSchemeAttributes {
+		fmt.Fprintf(&b, `    <option name="%s">`+"\n      <value>\n", attr.Name)
+		if attr.Foreground != "" {
+			fmt.Fprintf(&b, `        <option name="FOREGROUND" value="%s" />`+"\n", jetbrainsColor(roles.named(attr.Foreground)))
+		}
+		if attr.Background != "" {
+			fmt.Fprintf(&b, `        <option name="BACKGROUND" value="%s" />`+"\n", jetbrainsColor(roles.named(attr.Background)))
+		}
+		if attr.FontType != 0 {
+			fmt.Fprintf(&b, `        <option name="FONT_TYPE" value="%d" />`+"\n", attr.FontType)
+		}
+		if attr.Effect != "" {
+			fmt.Fprintf(&b, `        <option name="EFFECT_COLOR" value="%s" />`+"\n", jetbrainsColor(roles.named(attr.Effect)))
+			fmt.Fprintf(&b, `        <option name="EFFECT_TYPE" value="%d" />`+"\n", attr.EffectType)
+		}
+		b.WriteString("      </value>\n    </option>\n")
+	}
+	b.WriteString("  </attributes>\n")
+	b.WriteString("</scheme>\n")
+	return b.Bytes()
+}
+
+// buildJetBrainsUITheme returns the .theme.json for a theme. A saved
+// jetbrains theme is used as is; other themes get one generated from their
+// roles. The role colors are always included so the theme can be read back.
+func buildJetBrainsUITheme(theme roleTheme, schemePath string) map[string]any {
+	out := map[string]any{}
+	colors := map[string]any{}
+	if theme.Row.EditorType == "jetbrains" {
+		for key, value := range theme.Theme {
+			out[key] = value
+		}
+		if saved, ok := theme.Theme["colors"].(map[string]any); ok {
+			for key, value := range saved {
+				colors[key] = value
+			}
+		}
+	} else {
+		out["ui"] = jetbrainsUI
+	}
+
+	for _, role := range jetbrainsUIColors {
+		if _, ok := colors[role]; !ok {
+			colors[role] = theme.Roles.named(role)
+		}
+	}
+	for _, key := range themeOverrideKeys {
+		if _, ok := colors[key]; !ok {
+			colors[key] = theme.Roles.named(key)
+		}
+	}
+
+	out["name"] = theme.Row.Name
+	out["dark"] = theme.Roles.Dark
+	if _, ok := out["author"]; !ok {
+		out["author"] = "ThemeSmith"
+	}
+	out["editorScheme"] = schemePath
+	out["colors"] = colors
+	return out
+}
+
+// buildJetBrainsPlugin packages the themes as a plugin jar that installs
+// with "Install Plugin from Disk". It returns the jar and its file name.
+func buildJetBrainsPlugin(themes []roleTheme) ([]byte, string, error) {
+	exported := exportedThemesOf(themes)
+	fileNames := themeFileNames(exported)
+	version := exportVersion(exported)
+
+	id := "themesmith-" + fileNames[0]
+	name := themes[0].Row.Name
+	description := "Color theme generated by ThemeSmith"
+	if len(themes) > 1 {
+		id = "themesmith-collection-" + fileNames[0]
+		name = fmt.Sprintf("%s and %d more", themes[0].Row.Name, len(themes)-1)
+		description = "Color themes generated by ThemeSmith"
+	}
+
+	entries := []zipEntry{{Name: "META-INF/MANIFEST.MF", Data: []byte("Manifest-Version: 1.0\r\nCreated-By: ThemeSmith\r\n\r\n")}}
+
+	var providers bytes.Buffer
+	for i, theme := range themes {
+		schemePath := "/themes/" + fileNames[i] + ".icls"
+		themePath := "/themes/" + fileNames[i] + ".theme.json"
+
+		uiTheme, err := indentedJSON(buildJetBrainsUITheme(theme, schemePath), "  ")
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries,
+			zipEntry{Name: strings.TrimPrefix(themePath, "/"), Data: uiTheme},
+			zipEntry{Name: strings.TrimPrefix(schemePath, "/"), Data: buildJetBrainsScheme(theme.Row.Name, theme.Roles)},
+		)
+		fmt.Fprintf(&providers, `    <themeProvider id="%s-%s" path="%s" />`+"\n", id, fileNames[i], themePath)
+	}
+
+	var plugin bytes.Buffer
+	plugin.WriteString("<idea-plugin>\n")
+	fmt.Fprintf(&plugin, "  <id>com.themesmith.%s</id>\n", id)
+	plugin.WriteString("  <name>")
+	writeXMLAttr(&plugin, name)
+	plugin.WriteString("</name>\n")
+	fmt.Fprintf(&plugin, "  <version>%s</version>\n", version)
+	plugin.WriteString("  <vendor>ThemeSmith</vendor>\n")
+	fmt.Fprintf(&plugin, "  <description>%s</description>\n", description)
+	fmt.Fprintf(&plugin, "  <idea-version since-build=\"%s\" />\n", jetbrainsSinceBuild)
+	plugin.WriteString("  <depends>com.intellij.modules.platform</depends>\n")
+	plugin.WriteString("  <extensions defaultExtensionNs=\"com.intellij\">\n")
+	plugin.Write(providers.Bytes())
+	plugin.WriteString("  </extensions>\n")
+	plugin.WriteString("</idea-plugin>\n")
+	entries = append(entries, zipEntry{Name: "META-INF/plugin.xml", Data: plugin.Bytes()})
+
+	archive, err := buildZip(entries)
+	if err != nil {
+		return nil, "", err
+	}
+	return archive, fmt.Sprintf("%s-%s.jar", id, version), nil
+}
+
+func validateJetBrainsTheme(v *themeValidator, theme map[string]any, pointer string) {
+	v.checkKeys(theme, pointer, jetbrainsThemeKeys)
+	v.optionalString(theme, "name", pointer)
+	v.optionalString(theme, "author", pointer)
+	v.optionalString(theme, "editorScheme", pointer)
+	v.optionalString(theme, "parentTheme", pointer)
+
+	if value, ok := theme["dark"]; ok {
+		if _, ok := value.(bool); !ok {
+			v.add(pointerJoin(pointer, "dark"), "must be a boolean")
+		}
+	}
+
+	if raw, ok := theme["colors"]; ok {
+		colorsPointer := pointerJoin(pointer, "colors")
+		if colors, ok := v.object(raw, colorsPointer); ok {
+			for _, key := range sortedKeys(colors) {
+				v.color(colors[key], pointerJoin(colorsPointer, key), false)
+			}
+		}
+	}
+	if raw, ok := theme["ui"]; ok {
+		v.object(raw, pointerJoin(pointer, "ui"))
+	}
+}
+
+// ThemeJetBrainsHandler exports one saved theme of any editor type for
+// JetBrains IDEs. ?format=plugin (default) returns an installable plugin jar,
+// icls the editor color scheme and theme the .theme.json UI theme.
+func ThemeJetBrainsHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "plugin")))
+	if format != "plugin" && format != "icls" && format != "theme" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be plugin, icls or theme"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	fileName := themeFileNames([]exportedTheme{theme.exportedTheme})[0]
+	switch format {
+	case "icls":
+		sendAttachment(c, fileName+".icls", "application/xml", buildJetBrainsScheme(theme.Row.Name, theme.Roles))
+	case "theme":
+		data, err := indentedJSON(buildJetBrainsUITheme(theme, "/themes/"+fileName+".icls"), "  ")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build JetBrains theme"})
+			return
+		}
+		sendAttachment(c, fileName+".theme.json", "application/json", data)
+	default:
+		respondJetBrainsPlugin(c, []roleTheme{theme})
+	}
+}
+
+// ThemesJetBrainsHandler bundles several themes, given as ?ids=, into one
+// JetBrains plugin.
+func ThemesJetBrainsHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	ids, err := exportThemeIDs(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	themes, err := loadRoleThemes(c, ids)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	respondJetBrainsPlugin(c, themes)
+}
+
+func respondJetBrainsPlugin(c *gin.Context, themes []roleTheme) {
+	archive, fileName, err := buildJetBrainsPlugin(themes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build JetBrains plugin"})
+		return
+	}
+	sendAttachment(c, fileName, "application/java-archive", archive)
+}
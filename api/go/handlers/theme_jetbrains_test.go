@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"themesmith/model"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveThemeRoles(t *testing.T) {
+	row := model.Theme{Name: "Dusk", EditorType: "vscode"}
+	payload := map[string]any{
+		"themeResult": map[string]any{
+			"theme": map[string]any{
+				"type":        "dark",
+				"colors":      map[string]any{"editor.background": "#101010", "editorError.foreground": "#FF0000"},
+				"tokenColors": []any{map[string]any{"scope": "keyword", "settings": map[string]any{"foreground": "#00ff00"}}},
+			},
+			"themeOverrides": map[string]any{"foreground": "#EEE", "c2": "#0000ff80"},
+			"colors":         []any{map[string]any{"hex": "#abcdef"}},
+		},
+	}
+
+	roles := resolveThemeRoles(row, payload)
+	assert.True(t, roles.Dark)
+	assert.Equal(t, "#101010", roles.Background)
+	assert.Equal(t, "#eeeeee", roles.Foreground)
+	assert.Equal(t, "#0000ff", roles.C(2))
+	assert.Equal(t, "#00ff00", roles.C(6))
+	assert.Equal(t, "#abcdef", roles.C(1))
+	assert.Equal(t, "#ff0000", roles.Error)
+	assert.Equal(t, roles.C(2), roles.named("cursor"))
+	assert.Equal(t, "", roles.named("unknown"))
+	assert.Equal(t, "#808080", mixHex("#000000", "#ffffff", 0.5))
+
+	light := resolveThemeRoles(model.Theme{EditorType: "zed"}, map[string]any{
+		"themeResult": map[string]any{"theme": map[string]any{"themes": []any{map[string]any{"appearance": "light", "style": map[string]any{}}}}},
+	})
+	assert.False(t, light.Dark)
+	assert.Equal(t, "#fafafa", light.Background)
+}
+
+func jetbrainsTestTheme(name string, editorType string, theme map[string]any) roleTheme {
+	row := model.Theme{Name: name, EditorType: editorType, UpdatedAt: time.Unix(1700000000, 0)}
+	payload := map[string]any{"themeResult": map[string]any{
+		"theme":          theme,
+		"themeOverrides": map[string]any{"background": "#101010", "foreground": "#eeeeee", "c6": "#ff00ff"},
+	}}
+	return roleTheme{exportedTheme: exportedTheme{Row: row, Theme: theme}, Roles: resolveThemeRoles(row, payload)}
+}
+
+func TestBuildJetBrainsScheme(t *testing.T) {
+	theme := jetbrainsTestTheme(`Dusk & "Dawn"`, "vscode", map[string]any{"type": "dark"})
+	scheme := buildJetBrainsScheme(theme.Row.Name, theme.Roles)
+
+	var parsed struct {
+		Name   string `xml:"name,attr"`
+		Parent string `xml:"parent_scheme,attr"`
+	}
+	require.NoError(t, xml.Unmarshal(scheme, &parsed))
+	assert.Equal(t, `Dusk & "Dawn"`, parsed.Name)
+	assert.Equal(t, "Darcula", parsed.Parent)
+	assert.Contains(t, string(scheme), `<option name="DEFAULT_KEYWORD">`+"\n      <value>\n"+`        <option name="FOREGROUND" value="ff00ff" />`)
+	assert.NotContains(t, string(scheme), `value=""`)
+}
+
+func TestBuildJetBrainsPlugin(t *testing.T) {
+	archive, fileName, err := buildJetBrainsPlugin([]roleTheme{
+		jetbrainsTestTheme("Dusk", "vscode", map[string]any{"type": "dark"}),
+		jetbrainsTestTheme("Dusk", "jetbrains", map[string]any{"name": "Dusk", "author": "Someone", "ui": map[string]any{"Tree.background": "background"}}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "themesmith-collection-dusk-1.0.1700000000.jar", fileName)
+
+	entries := readZipEntries(t, archive)
+	plugin := string(entries["META-INF/plugin.xml"])
+	assert.Contains(t, plugin, "<id>com.themesmith.themesmith-collection-dusk</id>")
+	assert.Contains(t, plugin, `path="/themes/dusk.theme.json"`)
+	assert.Contains(t, plugin, `path="/themes/dusk-2.theme.json"`)
+	assert.Contains(t, entries, "themes/dusk.icls")
+	assert.Contains(t, entries, "themes/dusk-2.icls")
+
+	var generated map[string]any
+	require.NoError(t, json.Unmarshal(entries["themes/dusk.theme.json"], &generated))
+	assert.Equal(t, "/themes/dusk.icls", generated["editorScheme"])
+	assert.Equal(t, true, generated["dark"])
+	assert.Equal(t, "#ff00ff", generated["colors"].(map[string]any)["c6"])
+
+	var saved map[string]any
+	require.NoError(t, json.Unmarshal(entries["themes/dusk-2.theme.json"], &saved))
+	assert.Equal(t, "Someone", saved["author"])
+	assert.Equal(t, map[string]any{"Tree.background": "background"}, saved["ui"])
+
+	overrides, _ := deriveJetBrainsPalette(saved)
+	assert.Equal(t, "#101010", overrides["background"])
+}
+
+func TestValidateJetBrainsTheme(t *testing.T) {
+	payload := func(theme map[string]any) map[string]any {
+		return map[string]any{"themeResult": map[string]any{"theme": theme}}
+	}
+
+	assert.NoError(t, validateThemePayload(payload(map[string]any{"name": "Dusk", "dark": true, "colors": map[string]any{"bg": "#101010"}}), "jetbrains", themeValidationOptions{}))
+
+	err := validateThemePayload(payload(map[string]any{"dark": "yes", "colors": map[string]any{"bg": "red"}}), "jetbrains", themeValidationOptions{})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "/dark") || strings.Contains(err.Error(), "/colors/bg"))
+}
@@ -0,0 +1,553 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultThemeRevisionLimit = 50
+	maxThemeRevisionLimit     = 500
+)
+
+type ThemeRevisionSummary struct {
+	ID         uint      `json:"id"`
+	ThemeID    uint      `json:"themeId"`
+	Revision   int       `json:"revision"`
+	Name       string    `json:"name"`
+	EditorType string    `json:"editorType"`
+	Signature  string    `json:"signature"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ThemeRevisionResponse struct {
+	ThemeRevisionSummary
+	Theme json.RawMessage `json:"theme"`
+}
+
+type ThemeDiffChange struct {
+	Key    string   `json:"key"`
+	Change string   `json:"change"`
+	Old    any      `json:"old,omitempty"`
+	New    any      `json:"new,omitempty"`
+	DeltaE *float64 `json:"deltaE,omitempty"`
+}
+
+type ThemeRevisionDiffResponse struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Changes []ThemeDiffChange `json:"changes"`
+}
+
+type ThemeRevisionLimitRequest struct {
+	Limit *int `json:"limit"`
+}
+
+func summarizeThemeRevision(revision model.ThemeRevision) ThemeRevisionSummary {
+	return ThemeRevisionSummary{
+		ID:         revision.ID,
+		ThemeID:    revision.ThemeID,
+		Revision:   revision.Revision,
+		Name:       revision.Name,
+		EditorType: revision.EditorType,
+		Signature:  revision.Signature,
+		CreatedAt:  revision.CreatedAt,
+	}
+}
+
+// themeRevisionLimit returns how many revisions to keep per theme for a user,
+// falling back to THEME_REVISION_LIMIT and then to 50.
+func themeRevisionLimit(tx *gorm.DB, userID uint) (int, error) {
+	var user model.User
+	if err := tx.Select("id", "theme_revision_limit").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.ThemeRevisionLimit != nil {
+		return *user.ThemeRevisionLimit, nil
+	}
+	return int(min(max(envInt64("THEME_REVISION_LIMIT", defaultThemeRevisionLimit), 0), maxThemeRevisionLimit)), nil
+}
+
+// snapshotThemeRevision records the stored state of theme before it is
+// overwritten by next and prunes revisions beyond the owner's limit. It must
+// run inside the transaction that saves next, after theme was loaded there
+// with lockThemeRow, so concurrent saves number their revisions in turn. It
+// reports false, and records nothing, when next leaves the theme unchanged.
+func snapshotThemeRevision(tx *gorm.DB, theme model.Theme, next model.Theme) (bool, error) {
+	if sameThemeState(theme, next) {
+		return false, nil
+	}
+	if theme.UserID == nil {
+		return true, nil
+	}
+
+	limit, err := themeRevisionLimit(tx, *theme.UserID)
+	if err != nil {
+		return false, err
+	}
+	if limit <= 0 {
+		return true, tx.Where("theme_id = ?", theme.ID).Delete(&model.ThemeRevision{}).Error
+	}
+
+	var latest int
+	if err := tx.Model(&model.ThemeRevision{}).
+		Where("theme_id = ?", theme.ID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error; err != nil {
+		return false, err
+	}
+
+	revision := model.ThemeRevision{
+		ThemeID:    theme.ID,
+		UserID:     *theme.UserID,
+		Revision:   latest + 1,
+		Name:       theme.Name,
+		EditorType: theme.EditorType,
+		Signature:  theme.Signature,
+		JsonData:   theme.JsonData,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return false, err
+	}
+
+	return true, tx.Where("theme_id = ? AND revision <= ?", theme.ID, revision.Revision-limit).
+		Delete(&model.ThemeRevision{}).Error
+}
+
+// lockThemeRow loads a theme with SELECT ... FOR UPDATE, holding the row until
+// tx ends.
+func lockThemeRow(tx *gorm.DB, theme *model.Theme, query string, args ...any) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, args...).First(theme).Error
+}
+
+// sameThemeState reports whether next stores the same theme as theme. Payloads
+// are compared decoded, since jsonb does not keep the submitted formatting, and
+// without the row keys, which rows saved before they were stripped may hold.
+func sameThemeState(theme model.Theme, next model.Theme) bool {
+	if theme.Name != next.Name || theme.EditorType != next.EditorType || theme.Signature != next.Signature {
+		return false
+	}
+	if theme.JsonData == next.JsonData {
+		return true
+	}
+	stored, err := decodeThemeState(theme.JsonData)
+	if err != nil {
+		return false
+	}
+	incoming, err := decodeThemeState(next.JsonData)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(stored, incoming)
+}
+
+// decodeThemeState decodes a stored payload without its row keys, leaving only
+// what revisions compare and diff.
+func decodeThemeState(raw string) (map[string]any, error) {
+	payload, err := decodeThemePayload(raw)
+	if err != nil {
+		return nil, err
+	}
+	stripThemeRowKeys(payload)
+	return payload, nil
+}
+
+func findOwnedTheme(userID uint, themeID string) (model.Theme, error) {
+	var theme model.Theme
+	if err := db.DB.Where("id = ? AND user_id = ?", themeID, userID).First(&theme).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Theme{}, &statusError{Status: http.StatusNotFound, Message: "theme not found"}
+		}
+		return model.Theme{}, err
+	}
+	return theme, nil
+}
+
+func findThemeRevision(themeID uint, rawRevision string) (model.ThemeRevision, error) {
+	number, err := strconv.Atoi(rawRevision)
+	if err != nil || number < 1 {
+		return model.ThemeRevision{}, badRequestError("revision must be a positive integer")
+	}
+
+	var revision model.ThemeRevision
+	if err := db.DB.Where("theme_id = ? AND revision = ?", themeID, number).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ThemeRevision{}, &statusError{Status: http.StatusNotFound, Message: "revision not found"}
+		}
+		return model.ThemeRevision{}, err
+	}
+	return revision, nil
+}
+
+// themeRevisionSnapshot resolves a diff side: a revision number or "current"
+// for the theme as stored now.
+func themeRevisionSnapshot(theme model.Theme, ref string) (string, error) {
+	if ref == "" || ref == "current" {
+		return theme.JsonData, nil
+	}
+
+	revision, err := findThemeRevision(theme.ID, ref)
+	if err != nil {
+		return "", err
+	}
+	return revision.JsonData, nil
+}
+
+// revertUserTheme restores revision if ifMatch names the theme's current
+// version. On errStaleVersion the returned theme is the current server copy.
+func revertUserTheme(theme model.Theme, revision model.ThemeRevision, ifMatch string) (model.Theme, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockThemeRow(tx, &theme, "id = ?", theme.ID); err != nil {
+			return err
+		}
+		if !ifMatchVersion(ifMatch, theme.Version) {
+			return errStaleVersion
+		}
+		// Check for a clashing signature against the theme as locked, so a
+		// save that lands between loading and locking is taken into account.
+		if revision.EditorType != theme.EditorType || revision.Signature != theme.Signature {
+			var conflicts int64
+			if err := tx.Model(&model.Theme{}).
+				Where("user_id = ? AND editor_type = ? AND signature = ? AND id <> ?", theme.UserID, revision.EditorType, revision.Signature, theme.ID).
+				Count(&conflicts).Error; err != nil {
+				return err
+			}
+			if conflicts > 0 {
+				return &statusError{Status: http.StatusConflict, Message: "another theme already uses this revision's signature"}
+			}
+		}
+
+		next := theme
+		next.Name = revision.Name
+		next.EditorType = revision.EditorType
+		next.Signature = revision.Signature
+		next.JsonData = revision.JsonData
+		changed, err := snapshotThemeRevision(tx, theme, next)
+		if err != nil || !changed {
+			return err
+		}
+		theme = next
+		theme.Version++
+		theme.UpdatedAt = time.Now().UTC()
+		return tx.Save(&theme).Error
+	})
+	if errors.Is(err, errStaleVersion) {
+		return theme, err
+	}
+	if err != nil {
+		return model.Theme{}, err
+	}
+	return theme, nil
+}
+
+// flattenThemeJSON maps every leaf of a theme payload to its JSON pointer.
+// Empty objects and arrays count as leaves so that clearing them shows up.
+func flattenThemeJSON(pointer string, value any, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 && pointer != "" {
+			out[pointer] = v
+			return
+		}
+		for key, child := range v {
+			flattenThemeJSON(pointerJoin(pointer, key), child, out)
+		}
+	case []any:
+		if len(v) == 0 {
+			out[pointer] = v
+			return
+		}
+		for i, child := range v {
+			flattenThemeJSON(pointerJoin(pointer, i), child, out)
+		}
+	default:
+		out[pointer] = v
+	}
+}
+
+func diffThemeJSON(oldRaw string, newRaw string) ([]ThemeDiffChange, error) {
+	oldPayload, err := decodeThemeState(oldRaw)
+	if err != nil {
+		return nil, err
+	}
+	newPayload, err := decodeThemeState(newRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	oldFlat := map[string]any{}
+	newFlat := map[string]any{}
+	flattenThemeJSON("", oldPayload, oldFlat)
+	flattenThemeJSON("", newPayload, newFlat)
+	return diffFlattenedThemes(oldFlat, newFlat), nil
+}
+
+// diffFlattenedThemes compares two flattened themes key by key, in key order.
+func diffFlattenedThemes(oldFlat map[string]any, newFlat map[string]any) []ThemeDiffChange {
+	keys := make([]string, 0, len(oldFlat)+len(newFlat))
+	for key := range oldFlat {
+		keys = append(keys, key)
+	}
+	for key := range newFlat {
+		if _, ok := oldFlat[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	changes := make([]ThemeDiffChange, 0)
+	for _, key := range keys {
+		oldValue, hadOld := oldFlat[key]
+		newValue, hasNew := newFlat[key]
+		switch {
+		case !hadOld:
+			changes = append(changes, ThemeDiffChange{Key: key, Change: "added", New: newValue})
+		case !hasNew:
+			changes = append(changes, ThemeDiffChange{Key: key, Change: "removed", Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, ThemeDiffChange{Key: key, Change: "changed", Old: oldValue, New: newValue})
+		}
+	}
+	return changes
+}
+
+func ListThemeRevisionsHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to view theme revisions"})
+		return
+	}
+
+	theme, err := findOwnedTheme(userID, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	var revisions []model.ThemeRevision
+	if err := db.DB.Where("theme_id = ?", theme.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch theme revisions"})
+		return
+	}
+
+	summaries := make([]ThemeRevisionSummary, 0, len(revisions))
+	for _, revision := range revisions {
+		summaries = append(summaries, summarizeThemeRevision(revision))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": summaries})
+}
+
+func GetThemeRevisionHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to view theme revisions"})
+		return
+	}
+
+	theme, err := findOwnedTheme(userID, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	revision, err := findThemeRevision(theme.ID, c.Param("revision"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": ThemeRevisionResponse{
+		ThemeRevisionSummary: summarizeThemeRevision(revision),
+		Theme:                json.RawMessage(revision.JsonData),
+	}})
+}
+
+// DiffThemeRevisionsHandler compares two snapshots of a theme, given as
+// ?from= and ?to= revision numbers. Either side may be "current", which is
+// also the default for to.
+func DiffThemeRevisionsHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to view theme revisions"})
+		return
+	}
+
+	from := c.Query("from")
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	to := c.DefaultQuery("to", "current")
+
+	theme, err := findOwnedTheme(userID, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	oldData, err := themeRevisionSnapshot(theme, from)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	newData, err := themeRevisionSnapshot(theme, to)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	changes, err := diffThemeJSON(oldData, newData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to diff theme revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ThemeRevisionDiffResponse{From: from, To: to, Changes: changes})
+}
+
+// RevertThemeRevisionHandler restores a revision. The state it replaces is
+// snapshotted first, so a revert can itself be undone. Like an update, it
+// requires If-Match naming the theme's current version.
+func RevertThemeRevisionHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to revert themes"})
+		return
+	}
+
+	ifMatch, err := requireIfMatch(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	theme, err := findOwnedTheme(userID, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	revision, err := findThemeRevision(theme.ID, c.Param("revision"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	reverted, err := revertUserTheme(theme, revision, ifMatch)
+	if errors.Is(err, errStaleVersion) {
+		current, err := buildThemeResponse(reverted, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+			return
+		}
+		respondStaleVersion(c, reverted.Version, "theme", current)
+		return
+	}
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	responseTheme, err := buildThemeResponse(reverted, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build theme response"})
+		return
+	}
+
+	c.Header("ETag", versionETag(reverted.Version))
+	c.JSON(http.StatusOK, gin.H{"message": "Theme reverted successfully", "theme": responseTheme})
+}
+
+func GetThemeRevisionLimitHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, err := themeRevisionLimit(db.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch theme revision limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limit": limit})
+}
+
+// SetThemeRevisionLimitHandler stores how many revisions to keep per theme. A
+// null limit restores the server default; 0 turns history off. Existing
+// revisions are trimmed on the next save of each theme.
+func SetThemeRevisionLimitHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req ThemeRevisionLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	if req.Limit != nil && (*req.Limit < 0 || *req.Limit > maxThemeRevisionLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 0 and %d", maxThemeRevisionLimit)})
+		return
+	}
+
+	if err := db.DB.Model(&model.User{}).Where("id = ?", userID).Update("theme_revision_limit", req.Limit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save theme revision limit"})
+		return
+	}
+
+	limit, err := themeRevisionLimit(db.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch theme revision limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limit": limit})
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"themesmith/model"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// themeRoles are the palette roles a saved theme was generated from, with the
+// derived UI colors exporters for other editors and tools need. All colors
+// are #rrggbb.
+type themeRoles struct {
+	Name       string
+	Dark       bool
+	Background string
+	Foreground string
+	// Accents holds c1..c9: property, function, string, escape, type,
+	// keyword, parameter, operator and builtin colors.
+	Accents   [9]string
+	Constants string
+
+	Comment       string
+	Muted         string
+	Surface       string
+	SurfaceDark   string
+	LineHighlight string
+	Selection     string
+	Border        string
+	Cursor        string
+
+	Error   string
+	Warning string
+	Info    string
+	Success string
+}
+
+// C returns the accent for slot n (1..9).
+func (r themeRoles) C(n int) string {
+	return r.Accents[n-1]
+}
+
+// normalizeHexColor expands #rgb, drops any alpha channel and lowercases the
+// result. It returns "" for anything that is not a hex color.
+func normalizeHexColor(value string) string {
+	value = strings.TrimSpace(value)
+	if !hexColorPattern.MatchString(value) {
+		return ""
+	}
+	hex := strings.ToLower(value[1:])
+	switch len(hex) {
+	case 3, 4:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	case 8:
+		hex = hex[:6]
+	}
+	return "#" + hex
+}
+
+func rgbaToHex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// mixHex blends a toward b by weight (0 keeps a, 1 gives b).
+func mixHex(a string, b string, weight float64) string {
+	ca, errA := utils.HexToRGBA(a)
+	cb, errB := utils.HexToRGBA(b)
+	if errA != nil || errB != nil {
+		return a
+	}
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*weight + 0.5)
+	}
+	return rgbaToHex(color.RGBA{R: mix(ca.R, cb.R), G: mix(ca.G, cb.G), B: mix(ca.B, cb.B), A: 255})
+}
+
+// hexLightness returns the CIELAB lightness of a #rrggbb color.
+func hexLightness(hex string) float64 {
+	c, err := utils.HexToRGBA(hex)
+	if err != nil {
+		return 0
+	}
+	return utils.RGBToLab(c).L
+}
+
+// resolveThemeRoles reads the roles out of a saved theme payload. Overrides
+// saved with the theme win; missing roles are derived from the generated
+// theme like an import would, then taken from the palette in order.
+func resolveThemeRoles(row model.Theme, payload map[string]any) themeRoles {
+	result, _ := payload["themeResult"].(map[string]any)
+	theme, _ := result["theme"].(map[string]any)
+	saved, _ := result["themeOverrides"].(map[string]any)
+
+	var derived map[string]any
+	var palette []model.Color
+	switch row.EditorType {
+	case "zed":
+		derived, palette = deriveZedPalette(theme)
+	case "vscode":
+		derived, palette = deriveVSCodePalette(theme)
+	case "jetbrains":
+		derived, palette = deriveJetBrainsPalette(theme)
+	case "neovim", "vim", "emacs":
+		derived, palette = derivePaletteTheme(theme)
+	}
+	palette = append(extractPaletteFromThemePayload(payload), palette...)
+
+	role := func(key string) string {
+		for _, source := range []map[string]any{saved, derived} {
+			if value, ok := stringValue(source, key); ok {
+				if hex := normalizeHexColor(value); hex != "" {
+					return hex
+				}
+			}
+		}
+		return ""
+	}
+
+	roles := themeRoles{Name: row.Name}
+	roles.Background = role("background")
+	roles.Foreground = role("foreground")
+	if roles.Background == "" {
+		roles.Background = "#1e1e1e"
+		if vscodeUITheme(theme) == "vs" || themeAppearance(theme) == "light" {
+			roles.Background = "#fafafa"
+		}
+	}
+	roles.Dark = hexLightness(roles.Background) < 50
+	if roles.Foreground == "" {
+		roles.Foreground = "#d4d4d4"
+		if !roles.Dark {
+			roles.Foreground = "#333333"
+		}
+	}
+
+	var spare []string
+	for _, entry := range palette {
+		hex := normalizeHexColor(entry.Hex)
+		if hex != "" && hex != roles.Background && hex != roles.Foreground {
+			spare = append(spare, hex)
+		}
+	}
+	next := func() string {
+		if len(spare) == 0 {
+			return roles.Foreground
+		}
+		hex := spare[0]
+		spare = spare[1:]
+		return hex
+	}
+	for i := range roles.Accents {
+		roles.Accents[i] = role(fmt.Sprintf("c%d", i+1))
+	}
+	for i, accent := range roles.Accents {
+		if accent == "" {
+			roles.Accents[i] = next()
+		}
+	}
+	roles.Constants = role("constants")
+	if roles.Constants == "" {
+		roles.Constants = roles.C(4)
+	}
+
+	bg, fg := roles.Background, roles.Foreground
+	shade := "#000000"
+	if !roles.Dark {
+		shade = "#ffffff"
+	}
+	roles.Comment = mixHex(fg, bg, 0.45)
+	roles.Muted = mixHex(fg, bg, 0.25)
+	roles.Surface = mixHex(bg, shade, 0.2)
+	roles.SurfaceDark = mixHex(bg, shade, 0.35)
+	roles.LineHighlight = mixHex(bg, fg, 0.06)
+	roles.Selection = mixHex(bg, roles.C(2), 0.3)
+	roles.Border = mixHex(bg, fg, 0.15)
+	roles.Cursor = roles.C(2)
+
+	semantic := themeSemanticColors(row.EditorType, theme)
+	roles.Error = firstNonEmpty(semantic["error"], roles.C(6))
+	roles.Warning = firstNonEmpty(semantic["warning"], roles.Constants)
+	roles.Info = firstNonEmpty(semantic["info"], roles.C(5))
+	roles.Success = firstNonEmpty(semantic["success"], roles.C(3))
+	return roles
+}
+
+// themeSemanticColors picks the error, warning, info and success colors out
+// of a generated theme when it defines them.
+func themeSemanticColors(editorType string, theme map[string]any) map[string]string {
+	keys := map[string][]string{}
+	var source map[string]any
+	switch editorType {
+	case "vscode":
+		source, _ = theme["colors"].(map[string]any)
+		keys = map[string][]string{
+			"error":   {"editorError.foreground", "errorForeground"},
+			"warning": {"editorWarning.foreground"},
+			"info":    {"editorInfo.foreground"},
+			"success": {"gitDecoration.addedResourceForeground", "editorGutter.addedBackground"},
+		}
+	case "zed":
+		if themes, _ := theme["themes"].([]any); len(themes) > 0 {
+			variant, _ := themes[0].(map[string]any)
+			source, _ = variant["style"].(map[string]any)
+		}
+		keys = map[string][]string{
+			"error":   {"error", "deleted"},
+			"warning": {"warning", "modified"},
+			"info":    {"info", "renamed"},
+			"success": {"success", "created"},
+		}
+	}
+
+	colors := map[string]string{}
+	for role, candidates := range keys {
+		for _, key := range candidates {
+			if value, ok := stringValue(source, key); ok {
+				if hex := normalizeHexColor(value); hex != "" {
+					colors[role] = hex
+					break
+				}
+			}
+		}
+	}
+	return colors
+}
+
+func themeAppearance(theme map[string]any) string {
+	if themes, _ := theme["themes"].([]any); len(themes) > 0 {
+		if variant, ok := themes[0].(map[string]any); ok {
+			appearance, _ := variant["appearance"].(string)
+			return appearance
+		}
+	}
+	if dark, ok := theme["dark"].(bool); ok && !dark {
+		return "light"
+	}
+	if background, _ := theme["background"].(string); background == "light" {
+		return "light"
+	}
+	return ""
+}
+
+// deriveRolePalette reads roles from a map keyed by role name, the form
+// exported themes that keep their palette use.
+func deriveRolePalette(colors map[string]any) (map[string]any, []model.Color) {
+	overrides := map[string]any{}
+	var palette themePaletteBuilder
+	for _, key := range themeOverrideKeys {
+		if value, ok := stringValue(colors, key); ok {
+			overrides[key] = value
+			palette.add(value)
+		}
+	}
+	return overrides, palette.colors
+}
+
+// Neovim, Vim and Emacs themes are saved as {name, background, palette}, with
+// the palette keyed by role name; their exports are rendered from the roles.
+var (
+	paletteThemeKeys        = []string{"name", "background", "palette"}
+	paletteThemeBackgrounds = []string{"dark", "light"}
+)
+
+// derivePaletteTheme reads the roles back out of a saved Neovim, Vim or Emacs
+// theme.
+func derivePaletteTheme(theme map[string]any) (map[string]any, []model.Color) {
+	palette, _ := theme["palette"].(map[string]any)
+	return deriveRolePalette(palette)
+}
+
+func validatePaletteTheme(v *themeValidator, theme map[string]any, pointer string) {
+	v.checkKeys(theme, pointer, paletteThemeKeys)
+	v.optionalString(theme, "name", pointer)
+	if value, ok := theme["background"]; ok {
+		v.enum(value, pointerJoin(pointer, "background"), paletteThemeBackgrounds)
+	}
+
+	if raw, ok := theme["palette"]; ok {
+		palettePointer := pointerJoin(pointer, "palette")
+		if palette, ok := v.object(raw, palettePointer); ok {
+			v.checkKeys(palette, palettePointer, themeOverrideKeys)
+			for _, key := range sortedKeys(palette) {
+				v.color(palette[key], pointerJoin(palettePointer, key), false)
+			}
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// themeRoleNames lists every role name named accepts, in the order exporters
+// write palette tables.
+var themeRoleNames = []string{
+	"background", "foreground", "c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9", "constants",
+	"comment", "muted", "surface", "surface_dark", "line_highlight", "selection", "border", "cursor",
+	"error", "warning", "info", "success",
+}
+
+// named looks a role up by the name exporter tables use: background,
+// foreground, c1..c9, constants, comment, muted, surface, surface_dark,
+// line_highlight, selection, border, cursor, error, warning, info or
+// success. Unknown names return "".
+func (r themeRoles) named(name string) string {
+	if len(name) == 2 && name[0] == 'c' && name[1] >= '1' && name[1] <= '9' {
+		return r.C(int(name[1] - '0'))
+	}
+	switch name {
+	case "background":
+		return r.Background
+	case "foreground":
+		return r.Foreground
+	case "constants":
+		return r.Constants
+	case "comment":
+		return r.Comment
+	case "muted":
+		return r.Muted
+	case "surface":
+		return r.Surface
+	case "surface_dark":
+		return r.SurfaceDark
+	case "line_highlight":
+		return r.LineHighlight
+	case "selection":
+		return r.Selection
+	case "border":
+		return r.Border
+	case "cursor":
+		return r.Cursor
+	case "error":
+		return r.Error
+	case "warning":
+		return r.Warning
+	case "info":
+		return r.Info
+	case "success":
+		return r.Success
+	}
+	return ""
+}
+
+// roleTheme is a readable saved theme with its resolved roles, the input of
+// the exporters that generate files for other tools from a palette.
+type roleTheme struct {
+	exportedTheme
+	Roles themeRoles
+}
+
+func exportedThemesOf(themes []roleTheme) []exportedTheme {
+	exported := make([]exportedTheme, len(themes))
+	for i, theme := range themes {
+		exported[i] = theme.exportedTheme
+	}
+	return exported
+}
+
+func loadRoleTheme(c *gin.Context, themeID string) (roleTheme, error) {
+	row, err := findReadableTheme(c, themeID)
+	if err != nil {
+		return roleTheme{}, err
+	}
+	payload, err := decodeThemePayload(row.JsonData)
+	if err != nil {
+		return roleTheme{}, fmt.Errorf("failed to decode theme %d: %w", row.ID, err)
+	}
+	result, _ := payload["themeResult"].(map[string]any)
+	theme, _ := result["theme"].(map[string]any)
+	return roleTheme{exportedTheme: exportedTheme{Row: row, Theme: theme}, Roles: resolveThemeRoles(row, payload)}, nil
+}
+
+func loadRoleThemes(c *gin.Context, ids []string) ([]roleTheme, error) {
+	themes := make([]roleTheme, 0, len(ids))
+	for _, id := range ids {
+		theme, err := loadRoleTheme(c, id)
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, theme)
+	}
+	return themes, nil
+}
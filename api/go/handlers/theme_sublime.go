@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"themesmith/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sublimeColorScheme is the .sublime-color-scheme document. Globals and
+// rules refer to variables with var(name), so users can retune a role in
+// one place.
+type sublimeColorScheme struct {
+	Name      string            `json:"name"`
+	Author    string            `json:"author"`
+	Variables map[string]string `json:"variables"`
+	Globals   map[string]string `json:"globals"`
+	Rules     []sublimeRule     `json:"rules"`
+}
+
+type sublimeRule struct {
+	Name       string `json:"name"`
+	Scope      string `json:"scope"`
+	Foreground string `json:"foreground,omitempty"`
+	Background string `json:"background,omitempty"`
+	FontStyle  string `json:"font_style,omitempty"`
+}
+
+// sublimeGlobals maps global settings to the role variable they use.
+var sublimeGlobals = map[string]string{
+	"background":                  "background",
+	"foreground":                  "foreground",
+	"caret":                       "cursor",
+	"line_highlight":              "line_highlight",
+	"selection":                   "selection",
+	"selection_border":            "selection",
+	"inactive_selection":          "surface",
+	"misspelling":                 "error",
+	"gutter":                      "background",
+	"gutter_foreground":           "comment",
+	"guide":                       "border",
+	"active_guide":                "muted",
+	"stack_guide":                 "border",
+	"invisibles":                  "border",
+	"highlight":                   "warning",
+	"find_highlight":              "warning",
+	"find_highlight_foreground":   "background",
+	"brackets_foreground":         "c4",
+	"bracket_contents_foreground": "c4",
+	"tags_foreground":             "c2",
+	"accent":                      "c2",
+	"line_diff_added":             "success",
+	"line_diff_modified":          "warning",
+	"line_diff_deleted":           "error",
+}
+
+var sublimeRules = []sublimeRule{
+	{Name: "Comment", Scope: "comment, punctuation.definition.comment", Foreground: "comment", FontStyle: "italic"},
+	{Name: "String", Scope: "string", Foreground: "c3"},
+	{Name: "Escape", Scope: "constant.character.escape, string.regexp", Foreground: "c4"},
+	{Name: "Number", Scope: "constant.numeric", Foreground: "constants"},
+	{Name: "Constant", Scope: "constant, support.constant", Foreground: "constants"},
+	{Name: "Built-in constant", Scope: "constant.language", Foreground: "c9"},
+	{Name: "Keyword", Scope: "keyword, storage", Foreground: "c6"},
+	{Name: "Operator", Scope: "keyword.operator, punctuation.accessor", Foreground: "c8"},
+	{Name: "Function", Scope: "entity.name.function, support.function, variable.function", Foreground: "c2"},
+	{Name: "Type", Scope: "entity.name.type, entity.name.class, support.type, support.class, storage.type", Foreground: "c5"},
+	{Name: "Inherited class", Scope: "entity.other.inherited-class", Foreground: "c5", FontStyle: "italic"},
+	{Name: "Variable", Scope: "variable", Foreground: "foreground"},
+	{Name: "Language variable", Scope: "variable.language", Foreground: "c9"},
+	{Name: "Parameter", Scope: "variable.parameter", Foreground: "c7"},
+	{Name: "Property", Scope: "variable.other.member, support.variable.property, meta.object-literal.key", Foreground: "c1"},
+	{Name: "Namespace", Scope: "entity.name.namespace, entity.name.module", Foreground: "c5"},
+	{Name: "Tag", Scope: "entity.name.tag", Foreground: "c2"},
+	{Name: "Attribute", Scope: "entity.other.attribute-name", Foreground: "constants"},
+	{Name: "Macro", Scope: "support.function.macro, entity.name.macro", Foreground: "c9"},
+	{Name: "Punctuation", Scope: "punctuation", Foreground: "muted"},
+	{Name: "Heading", Scope: "markup.heading, entity.name.section", Foreground: "c2", FontStyle: "bold"},
+	{Name: "Bold", Scope: "markup.bold", FontStyle: "bold"},
+	{Name: "Italic", Scope: "markup.italic", FontStyle: "italic"},
+	{Name: "Link", Scope: "markup.underline.link", Foreground: "c2", FontStyle: "underline"},
+	{Name: "Quote", Scope: "markup.quote", Foreground: "comment", FontStyle: "italic"},
+	{Name: "Raw", Scope: "markup.raw", Foreground: "c3"},
+	{Name: "Inserted", Scope: "markup.inserted", Foreground: "success"},
+	{Name: "Deleted", Scope: "markup.deleted", Foreground: "error"},
+	{Name: "Changed", Scope: "markup.changed", Foreground: "warning"},
+	{Name: "Invalid", Scope: "invalid", Foreground: "error", FontStyle: "underline"},
+	{Name: "Deprecated", Scope: "invalid.deprecated", Foreground: "warning"},
+}
+
+// buildSublimeColorScheme renders a .sublime-color-scheme whose variables
+// hold the theme's roles.
+func buildSublimeColorScheme(name string, roles themeRoles) ([]byte, error) {
+	scheme := sublimeColorScheme{
+		Name:      name,
+		Author:    "ThemeSmith",
+		Variables: make(map[string]string, len(themeRoleNames)),
+		Globals:   make(map[string]string, len(sublimeGlobals)),
+		Rules:     make([]sublimeRule, len(sublimeRules)),
+	}
+	for _, role := range themeRoleNames {
+		scheme.Variables[role] = roles.named(role)
+	}
+	for key, role := range sublimeGlobals {
+		scheme.Globals[key] = sublimeVar(role)
+	}
+	for i, rule := range sublimeRules {
+		rule.Foreground = sublimeVar(rule.Foreground)
+		rule.Background = sublimeVar(rule.Background)
+		scheme.Rules[i] = rule
+	}
+	return indentedJSON(scheme, "  ")
+}
+
+func sublimeVar(role string) string {
+	if role == "" {
+		return ""
+	}
+	return "var(" + role + ")"
+}
+
+// ThemeSublimeHandler renders a saved theme of any editor type as a Sublime
+// Text color scheme for Packages/User.
+func ThemeSublimeHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	scheme, err := buildSublimeColorScheme(theme.Row.Name, theme.Roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build color scheme"})
+		return
+	}
+	sendAttachment(c, vimColorschemeName(theme.Row.Name)+".sublime-color-scheme", "application/json", scheme)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSublimeColorScheme(t *testing.T) {
+	data, err := buildSublimeColorScheme("Dusk", vimTestRoles())
+	require.NoError(t, err)
+
+	var scheme sublimeColorScheme
+	require.NoError(t, json.Unmarshal(data, &scheme))
+	assert.Equal(t, "Dusk", scheme.Name)
+	assert.Equal(t, "#101010", scheme.Variables["background"])
+	assert.Equal(t, "#ff00ff", scheme.Variables["c6"])
+	assert.Equal(t, "var(cursor)", scheme.Globals["caret"])
+
+	for _, value := range scheme.Globals {
+		assert.True(t, strings.HasPrefix(value, "var("), value)
+	}
+	for _, rule := range scheme.Rules {
+		if rule.Name == "Keyword" {
+			assert.Equal(t, "var(c6)", rule.Foreground)
+		}
+		if rule.Foreground != "" {
+			assert.Contains(t, scheme.Variables, strings.TrimSuffix(strings.TrimPrefix(rule.Foreground, "var("), ")"))
+		}
+		assert.Empty(t, rule.Background)
+	}
+	assert.NotContains(t, string(data), `""`)
+}
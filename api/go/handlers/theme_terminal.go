@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// terminalScheme is the color set every terminal format shares: the 16 ANSI
+// colors plus the default cell, cursor and selection colors.
+type terminalScheme struct {
+	Name          string
+	Background    string
+	Foreground    string
+	Cursor        string
+	CursorText    string
+	Selection     string
+	SelectionText string
+	ANSI          [16]string
+}
+
+// terminalANSINames are the conventional names of ANSI colors 0-7; 8-15 are
+// their bright variants.
+var terminalANSINames = [8]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// terminalANSIHues are the HSV hues of ANSI colors 1-6, in slot order.
+var terminalANSIHues = [6]float64{0, 120, 60, 240, 300, 180}
+
+const (
+	// terminalMaxHueDistance is how far, in degrees, a theme color's hue may
+	// sit from an ANSI slot before the slot gets a synthesized color instead.
+	terminalMaxHueDistance = 45
+	// terminalMinSaturation keeps greys out of the chromatic slots.
+	terminalMinSaturation = 0.15
+)
+
+// buildTerminalScheme fills the ANSI slots from the theme roles. The chromatic
+// slots are matched by hue, so ANSI red is whichever theme color is closest
+// to red; slots nothing matches are synthesized at the slot's hue with the
+// theme's average saturation and value. Bright colors are pulled toward the
+// foreground, which lightens them on dark themes and darkens them on light
+// ones.
+func buildTerminalScheme(roles themeRoles) terminalScheme {
+	scheme := terminalScheme{
+		Name:          roles.Name,
+		Background:    roles.Background,
+		Foreground:    roles.Foreground,
+		Cursor:        roles.Cursor,
+		CursorText:    roles.Background,
+		Selection:     roles.Selection,
+		SelectionText: roles.Foreground,
+	}
+
+	if roles.Dark {
+		scheme.ANSI[0] = roles.Border
+		scheme.ANSI[7] = roles.Muted
+		scheme.ANSI[8] = roles.Comment
+		scheme.ANSI[15] = roles.Foreground
+	} else {
+		scheme.ANSI[0] = roles.Foreground
+		scheme.ANSI[7] = roles.Border
+		scheme.ANSI[8] = roles.Comment
+		scheme.ANSI[15] = roles.LineHighlight
+	}
+
+	chromatic := assignTerminalHues(roles)
+	for i, hex := range chromatic {
+		scheme.ANSI[i+1] = hex
+		scheme.ANSI[i+9] = mixHex(hex, roles.Foreground, 0.2)
+	}
+	return scheme
+}
+
+func assignTerminalHues(roles themeRoles) [6]string {
+	type candidate struct {
+		hex string
+		hue float64
+		sat float64
+		val float64
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, hex := range slices.Concat(roles.Accents[:], []string{roles.Constants, roles.Error, roles.Warning, roles.Info, roles.Success}) {
+		if hex == "" || seen[hex] {
+			continue
+		}
+		seen[hex] = true
+		h, s, v, ok := hexToHSV(hex)
+		if ok && s >= terminalMinSaturation {
+			candidates = append(candidates, candidate{hex: hex, hue: h, sat: s, val: v})
+		}
+	}
+
+	type pairing struct {
+		slot      int
+		candidate int
+		cost      float64
+	}
+	var pairings []pairing
+	for slot, target := range terminalANSIHues {
+		for i, c := range candidates {
+			distance := hueDistance(c.hue, target)
+			if distance <= terminalMaxHueDistance {
+				pairings = append(pairings, pairing{slot: slot, candidate: i, cost: distance + (1-c.sat)*30})
+			}
+		}
+	}
+	sort.SliceStable(pairings, func(i, j int) bool { return pairings[i].cost < pairings[j].cost })
+
+	var slots [6]string
+	used := make([]bool, len(candidates))
+	for _, p := range pairings {
+		if slots[p.slot] != "" || used[p.candidate] {
+			continue
+		}
+		slots[p.slot] = candidates[p.candidate].hex
+		used[p.candidate] = true
+	}
+
+	sat, val := 0.6, 0.85
+	if !roles.Dark {
+		val = 0.6
+	}
+	if len(candidates) > 0 {
+		sat, val = 0, 0
+		for _, c := range candidates {
+			sat += c.sat
+			val += c.val
+		}
+		sat /= float64(len(candidates))
+		val /= float64(len(candidates))
+	}
+	for slot, hex := range slots {
+		if hex == "" {
+			slots[slot] = hsvToHex(terminalANSIHues[slot], sat, val)
+		}
+	}
+	return slots
+}
+
+func hueDistance(a, b float64) float64 {
+	d := math.Abs(a - b)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// hexToHSV returns hue in degrees and saturation and value in [0, 1].
+func hexToHSV(hex string) (float64, float64, float64, bool) {
+	c, err := utils.HexToRGBA(hex)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	maxC := math.Max(r, math.Max(g, b))
+	minC := math.Min(r, math.Min(g, b))
+	delta := maxC - minC
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case maxC == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case maxC == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	s := 0.0
+	if maxC > 0 {
+		s = delta / maxC
+	}
+	return h, s, maxC, true
+}
+
+func hsvToHex(h, s, v float64) string {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	channel := func(f float64) int { return int(math.Round((f + m) * 255)) }
+	return fmt.Sprintf("#%02x%02x%02x", channel(r), channel(g), channel(b))
+}
+
+// terminalFormat renders a terminalScheme into one emulator's config file.
+type terminalFormat struct {
+	Extension   string
+	ContentType string
+	Render      func(terminalScheme) ([]byte, error)
+}
+
+var terminalFormats = map[string]terminalFormat{
+	"alacritty":        {Extension: ".toml", ContentType: "application/toml", Render: renderAlacrittyScheme},
+	"kitty":            {Extension: ".conf", ContentType: "text/plain; charset=utf-8", Render: renderKittyScheme},
+	"wezterm":          {Extension: ".toml", ContentType: "application/toml", Render: renderWezTermScheme},
+	"wezterm-lua":      {Extension: ".lua", ContentType: "text/x-lua; charset=utf-8", Render: renderWezTermLuaScheme},
+	"ghostty":          {Extension: "", ContentType: "text/plain; charset=utf-8", Render: renderGhosttyScheme},
+	"foot":             {Extension: ".ini", ContentType: "text/plain; charset=utf-8", Render: renderFootScheme},
+	"windows-terminal": {Extension: ".json", ContentType: "application/json", Render: renderWindowsTerminalScheme},
+	"iterm2":           {Extension: ".itermcolors", ContentType: "application/x-plist", Render: renderITermScheme},
+}
+
+func terminalFormatNames() []string {
+	names := make([]string, 0, len(terminalFormats))
+	for name := range terminalFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func terminalHeader(comment string, name string) string {
+	return fmt.Sprintf("%s %s, generated by ThemeSmith\n", comment, strings.ReplaceAll(name, "\n", " "))
+}
+
+func renderAlacrittyScheme(scheme terminalScheme) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(terminalHeader("#", scheme.Name))
+	fmt.Fprintf(&b, "\n[colors.primary]\nbackground = %s\nforeground = %s\n", tomlString(scheme.Background), tomlString(scheme.Foreground))
+	fmt.Fprintf(&b, "\n[colors.cursor]\ntext = %s\ncursor = %s\n", tomlString(scheme.CursorText), tomlString(scheme.Cursor))
+	fmt.Fprintf(&b, "\n[colors.selection]\ntext = %s\nbackground = %s\n", tomlString(scheme.SelectionText), tomlString(scheme.Selection))
+	for i, table := range []string{"normal", "bright"} {
+		fmt.Fprintf(&b, "\n[colors.%s]\n", table)
+		for slot, name := range terminalANSINames {
+			fmt.Fprintf(&b, "%s = %s\n", name, tomlString(scheme.ANSI[i*8+slot]))
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+func renderKittyScheme(scheme terminalScheme) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(terminalHeader("#", scheme.Name))
+	fmt.Fprintf(&b, "\nforeground %s\nbackground %s\n", scheme.Foreground, scheme.Background)
+	fmt.Fprintf(&b, "cursor %s\ncursor_text_color %s\n", scheme.Cursor, scheme.CursorText)
+	fmt.Fprintf(&b, "selection_foreground %s\nselection_background %s\n\n", scheme.SelectionText, scheme.Selection)
+	for i, hex := range scheme.ANSI {
+		fmt.Fprintf(&b, "color%d %s\n", i, hex)
+	}
+	return []byte(b.String()), nil
+}
+
+func renderWezTermScheme(scheme terminalScheme) ([]byte, error) {
+	quoted := func(colors []string) string {
+		values := make([]string, len(colors))
+		for i, hex := range colors {
+			values[i] = tomlString(hex)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+
+	var b strings.Builder
+	b.WriteString(terminalHeader("#", scheme.Name))
+	b.WriteString("\n[colors]\n")
+	fmt.Fprintf(&b, "foreground = %s\nbackground = %s\n", tomlString(scheme.Foreground), tomlString(scheme.Background))
+	fmt.Fprintf(&b, "cursor_bg = %s\ncursor_fg = %s\ncursor_border = %s\n", tomlString(scheme.Cursor), tomlString(scheme.CursorText), tomlString(scheme.Cursor))
+	fmt.Fprintf(&b, "selection_fg = %s\nselection_bg = %s\n", tomlString(scheme.SelectionText), tomlString(scheme.Selection))
+	fmt.Fprintf(&b, "ansi = %s\nbrights = %s\n", quoted(scheme.ANSI[:8]), quoted(scheme.ANSI[8:]))
+	fmt.Fprintf(&b, "\n[metadata]\nname = %s\nauthor = \"ThemeSmith\"\n", tomlString(scheme.Name))
+	return []byte(b.String()), nil
+}
+
+// renderWezTermLuaScheme renders a module returning a colors table, for
+// config.color_schemes["Name"] = require("name") in wezterm.lua.
+func renderWezTermLuaScheme(scheme terminalScheme) ([]byte, error) {
+	quoted := func(colors []string) string {
+		values := make([]string, len(colors))
+		for i, hex := range colors {
+			values[i] = luaString(hex)
+		}
+		return "{ " + strings.Join(values, ", ") + " }"
+	}
+
+	var b strings.Builder
+	b.WriteString(terminalHeader("--", scheme.Name))
+	b.WriteString("return {\n")
+	fmt.Fprintf(&b, "  foreground = %s,\n  background = %s,\n", luaString(scheme.Foreground), luaString(scheme.Background))
+	fmt.Fprintf(&b, "  cursor_bg = %s,\n  cursor_fg = %s,\n  cursor_border = %s,\n", luaString(scheme.Cursor), luaString(scheme.CursorText), luaString(scheme.Cursor))
+	fmt.Fprintf(&b, "  selection_fg = %s,\n  selection_bg = %s,\n", luaString(scheme.SelectionText), luaString(scheme.Selection))
+	fmt.Fprintf(&b, "  ansi = %s,\n  brights = %s,\n}\n", quoted(scheme.ANSI[:8]), quoted(scheme.ANSI[8:]))
+	return []byte(b.String()), nil
+}
+
+func renderGhosttyScheme(scheme terminalScheme) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(terminalHeader("#", scheme.Name))
+	b.WriteString("\n")
+	for i, hex := range scheme.ANSI {
+		fmt.Fprintf(&b, "palette = %d=%s\n", i, hex)
+	}
+	fmt.Fprintf(&b, "background = %s\nforeground = %s\n", scheme.Background, scheme.Foreground)
+	fmt.Fprintf(&b, "cursor-color = %s\ncursor-text = %s\n", scheme.Cursor, scheme.CursorText)
+	fmt.Fprintf(&b, "selection-background = %s\nselection-foreground = %s\n", scheme.Selection, scheme.SelectionText)
+	return []byte(b.String()), nil
+}
+
+// renderFootScheme renders foot.ini sections; foot takes colors without "#".
+func renderFootScheme(scheme terminalScheme) ([]byte, error) {
+	bare := func(hex string) string { return strings.TrimPrefix(hex, "#") }
+
+	var b strings.Builder
+	b.WriteString(terminalHeader("#", scheme.Name))
+	fmt.Fprintf(&b, "\n[cursor]\ncolor=%s %s\n", bare(scheme.CursorText), bare(scheme.Cursor))
+	fmt.Fprintf(&b, "\n[colors]\nforeground=%s\nbackground=%s\n", bare(scheme.Foreground), bare(scheme.Background))
+	fmt.Fprintf(&b, "selection-foreground=%s\nselection-background=%s\n", bare(scheme.SelectionText), bare(scheme.Selection))
+	for i, hex := range scheme.ANSI[:8] {
+		fmt.Fprintf(&b, "regular%d=%s\n", i, bare(hex))
+	}
+	for i, hex := range scheme.ANSI[8:] {
+		fmt.Fprintf(&b, "bright%d=%s\n", i, bare(hex))
+	}
+	return []byte(b.String()), nil
+}
+
+// renderWindowsTerminalScheme renders one entry for the "schemes" array of
+// Windows Terminal's settings.json. Windows Terminal calls magenta purple.
+func renderWindowsTerminalScheme(scheme terminalScheme) ([]byte, error) {
+	entry := map[string]string{
+		"name":                scheme.Name,
+		"background":          scheme.Background,
+		"foreground":          scheme.Foreground,
+		"cursorColor":         scheme.Cursor,
+		"selectionBackground": scheme.Selection,
+	}
+	for i, name := range terminalANSINames {
+		if name == "magenta" {
+			name = "purple"
+		}
+		entry[name] = scheme.ANSI[i]
+		entry["bright"+strings.ToUpper(name[:1])+name[1:]] = scheme.ANSI[i+8]
+	}
+	return indentedJSON(entry, "    ")
+}
+
+// renderITermScheme renders an .itermcolors property list. Keys are sorted,
+// as iTerm2 itself writes them.
+func renderITermScheme(scheme terminalScheme) ([]byte, error) {
+	colors := map[string]string{
+		"Background Color":    scheme.Background,
+		"Foreground Color":    scheme.Foreground,
+		"Bold Color":          scheme.Foreground,
+		"Cursor Color":        scheme.Cursor,
+		"Cursor Text Color":   scheme.CursorText,
+		"Selection Color":     scheme.Selection,
+		"Selected Text Color": scheme.SelectionText,
+	}
+	for i, hex := range scheme.ANSI {
+		colors[fmt.Sprintf("Ansi %d Color", i)] = hex
+	}
+	keys := make([]string, 0, len(colors))
+	for key := range colors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	for _, key := range keys {
+		c, err := utils.HexToRGBA(colors[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, colors[key], err)
+		}
+		fmt.Fprintf(&b, "\t<key>%s</key>\n\t<dict>\n", key)
+		fmt.Fprintf(&b, "\t\t<key>Alpha Component</key>\n\t\t<real>1</real>\n")
+		fmt.Fprintf(&b, "\t\t<key>Blue Component</key>\n\t\t<real>%s</real>\n", plistReal(c.B))
+		fmt.Fprintf(&b, "\t\t<key>Color Space</key>\n\t\t<string>sRGB</string>\n")
+		fmt.Fprintf(&b, "\t\t<key>Green Component</key>\n\t\t<real>%s</real>\n", plistReal(c.G))
+		fmt.Fprintf(&b, "\t\t<key>Red Component</key>\n\t\t<real>%s</real>\n", plistReal(c.R))
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return []byte(b.String()), nil
+}
+
+func plistReal(channel uint8) string {
+	return fmt.Sprintf("%.6g", float64(channel)/255)
+}
+
+// paletteRoles resolves roles for a bare palette: the darkest color
+// becomes the background and the lightest the foreground, and the rest fill
+// the accents in palette order.
+func paletteRoles(name string, colors []model.Color) themeRoles {
+	var darkest, lightest string
+	for _, entry := range colors {
+		hex := normalizeHexColor(entry.Hex)
+		if hex == "" {
+			continue
+		}
+		if darkest == "" || hexLightness(hex) < hexLightness(darkest) {
+			darkest = hex
+		}
+		if lightest == "" || hexLightness(hex) > hexLightness(lightest) {
+			lightest = hex
+		}
+	}
+
+	entries := make([]any, len(colors))
+	for i, entry := range colors {
+		entries[i] = map[string]any{"hex": entry.Hex}
+	}
+	overrides := map[string]any{}
+	if darkest != "" && darkest != lightest {
+		overrides["background"] = darkest
+		overrides["foreground"] = lightest
+	}
+	return resolveThemeRoles(model.Theme{Name: name}, map[string]any{
+		"themeResult": map[string]any{"colors": entries, "themeOverrides": overrides},
+	})
+}
+
+// findReadablePalette loads a palette the caller may read: system and shared
+// palettes for anyone, private palettes only for their owner.
+func findReadablePalette(c *gin.Context, paletteID string) (model.Palette, error) {
+	var palette model.Palette
+	if err := db.DB.First(&palette, "id = ?", paletteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Palette{}, &statusError{Status: http.StatusNotFound, Message: "palette not found"}
+		}
+		return model.Palette{}, err
+	}
+	if palette.IsShared || palette.IsSystem {
+		return palette, nil
+	}
+
+	if c.GetHeader("Authorization") != "" {
+		if userID, err := auth.GetUserFromRequest(c); err == nil && palette.UserID != nil && *palette.UserID == userID {
+			return palette, nil
+		}
+	}
+	return model.Palette{}, &statusError{Status: http.StatusNotFound, Message: "palette not found"}
+}
+
+// loadPaletteRoles loads a readable palette and resolves its roles with
+// paletteRoles.
+func loadPaletteRoles(c *gin.Context, paletteID string) (string, themeRoles, error) {
+	palette, err := findReadablePalette(c, paletteID)
+	if err != nil {
+		return "", themeRoles{}, err
+	}
+	var colors []model.Color
+	if err := json.Unmarshal([]byte(palette.JsonData), &colors); err != nil {
+		return "", themeRoles{}, fmt.Errorf("failed to decode palette %d: %w", palette.ID, err)
+	}
+	return palette.Name, paletteRoles(palette.Name, colors), nil
+}
+
+func respondTerminalScheme(c *gin.Context, name string, roles themeRoles) {
+	formatName := strings.ToLower(strings.TrimSpace(c.Query("format")))
+	format, ok := terminalFormats[formatName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of " + strings.Join(terminalFormatNames(), ", ")})
+		return
+	}
+
+	data, err := format.Render(buildTerminalScheme(roles))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render terminal scheme"})
+		return
+	}
+	sendAttachment(c, vimColorschemeName(name)+format.Extension, format.ContentType, data)
+}
+
+// ThemeTerminalHandler renders a saved theme of any editor type as a terminal
+// color scheme. ?format= picks the emulator; see terminalFormats.
+func ThemeTerminalHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	respondTerminalScheme(c, theme.Row.Name, theme.Roles)
+}
+
+// PaletteTerminalHandler renders a saved palette as a terminal color scheme,
+// taking the same ?format= values as ThemeTerminalHandler.
+func PaletteTerminalHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	name, roles, err := loadPaletteRoles(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	respondTerminalScheme(c, name, roles)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"themesmith/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func terminalTestRoles() themeRoles {
+	return resolveThemeRoles(model.Theme{Name: "Dusk", EditorType: "neovim"}, map[string]any{
+		"themeResult": map[string]any{"theme": map[string]any{
+			"background": "dark",
+			"palette": map[string]any{
+				"background": "#101010", "foreground": "#eeeeee",
+				"c1": "#4080ff", "c2": "#e04040", "c3": "#40c040", "c4": "#e0c040",
+				"c5": "#40c0c0", "c6": "#c040c0", "c7": "#888888", "c8": "#ff8000", "c9": "#808080",
+			},
+		}},
+	})
+}
+
+func TestBuildTerminalSchemeAssignsByHue(t *testing.T) {
+	scheme := buildTerminalScheme(terminalTestRoles())
+
+	assert.Equal(t, "#e04040", scheme.ANSI[1], "red")
+	assert.Equal(t, "#40c040", scheme.ANSI[2], "green")
+	assert.Equal(t, "#e0c040", scheme.ANSI[3], "yellow")
+	assert.Equal(t, "#4080ff", scheme.ANSI[4], "blue")
+	assert.Equal(t, "#c040c0", scheme.ANSI[5], "magenta")
+	assert.Equal(t, "#40c0c0", scheme.ANSI[6], "cyan")
+	assert.Equal(t, "#eeeeee", scheme.ANSI[15])
+	for i, hex := range scheme.ANSI {
+		assert.NotEmpty(t, hex, "slot %d", i)
+	}
+	assert.NotEqual(t, scheme.ANSI[1], scheme.ANSI[9])
+}
+
+func TestBuildTerminalSchemeSynthesizesMissingHues(t *testing.T) {
+	roles := paletteRoles("Mono Blue", []model.Color{{Hex: "#000000"}, {Hex: "#ffffff"}, {Hex: "#0000ff"}})
+	scheme := buildTerminalScheme(roles)
+
+	assert.Equal(t, "#000000", scheme.Background)
+	assert.Equal(t, "#ffffff", scheme.Foreground)
+	assert.Equal(t, "#0000ff", scheme.ANSI[4])
+
+	hue, sat, _, ok := hexToHSV(scheme.ANSI[1])
+	require.True(t, ok)
+	assert.InDelta(t, 0, hueDistance(hue, 0), 1)
+	assert.Greater(t, sat, 0.5)
+}
+
+func TestHSVRoundTrip(t *testing.T) {
+	for _, hex := range []string{"#ff0000", "#00ff00", "#0000ff", "#336699", "#808080"} {
+		h, s, v, ok := hexToHSV(hex)
+		require.True(t, ok)
+		assert.Equal(t, hex, hsvToHex(h, s, v))
+	}
+}
+
+func TestTerminalFormats(t *testing.T) {
+	scheme := buildTerminalScheme(terminalTestRoles())
+	render := func(format string) string {
+		data, err := terminalFormats[format].Render(scheme)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Contains(t, render("alacritty"), "[colors.normal]\nblack = \"")
+	assert.Contains(t, render("alacritty"), "red = \"#e04040\"\n")
+	assert.Contains(t, render("kitty"), "color1 #e04040\n")
+	assert.Contains(t, render("wezterm"), `ansi = ["`)
+	assert.Contains(t, render("wezterm-lua"), "return {\n  foreground = \"#eeeeee\",")
+	assert.Contains(t, render("ghostty"), "palette = 1=#e04040\n")
+	assert.Contains(t, render("foot"), "regular1=e04040\n")
+	assert.Contains(t, render("foot"), "[cursor]\ncolor=101010 ")
+
+	var wt map[string]string
+	require.NoError(t, json.Unmarshal([]byte(render("windows-terminal")), &wt))
+	assert.Equal(t, "#c040c0", wt["purple"])
+	assert.Equal(t, scheme.ANSI[13], wt["brightPurple"])
+	assert.Equal(t, "Dusk", wt["name"])
+
+	iterm := render("iterm2")
+	require.NoError(t, xml.Unmarshal([]byte(iterm), new(any)))
+	assert.Contains(t, iterm, "<key>Ansi 1 Color</key>\n\t<dict>")
+	assert.Contains(t, iterm, "<key>Red Component</key>\n\t\t<real>0.878431</real>")
+
+	for _, name := range terminalFormatNames() {
+		assert.NotContains(t, strings.ToLower(render(name)), `""`, name)
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"themesmith/db"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kdeColorSection is one [Colors:*] group of a KDE color scheme. Every
+// section shares the link, visited and semantic foregrounds.
+type kdeColorSection struct {
+	Name                string
+	BackgroundNormal    string
+	BackgroundAlternate string
+	ForegroundNormal    string
+	ForegroundInactive  string
+}
+
+var kdeColorSections = []kdeColorSection{
+	{Name: "Window", BackgroundNormal: "surface", BackgroundAlternate: "surface_dark", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+	{Name: "View", BackgroundNormal: "background", BackgroundAlternate: "line_highlight", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+	{Name: "Button", BackgroundNormal: "surface", BackgroundAlternate: "surface_dark", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+	{Name: "Selection", BackgroundNormal: "selection", BackgroundAlternate: "selection", ForegroundNormal: "foreground", ForegroundInactive: "muted"},
+	{Name: "Tooltip", BackgroundNormal: "surface", BackgroundAlternate: "surface_dark", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+	{Name: "Complementary", BackgroundNormal: "surface_dark", BackgroundAlternate: "surface", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+	{Name: "Header", BackgroundNormal: "surface_dark", BackgroundAlternate: "surface", ForegroundNormal: "foreground", ForegroundInactive: "comment"},
+}
+
+// kdeRGB formats a color the way KDE color schemes store it, as "r,g,b".
+func kdeRGB(hex string) string {
+	c, err := utils.HexToRGBA(hex)
+	if err != nil {
+		return "0,0,0"
+	}
+	return fmt.Sprintf("%d,%d,%d", c.R, c.G, c.B)
+}
+
+// buildKDEColorScheme renders a KDE Plasma .colors scheme for
+// ~/.local/share/color-schemes.
+func buildKDEColorScheme(name string, roles themeRoles) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s, generated by ThemeSmith\n\n", strings.ReplaceAll(name, "\n", " "))
+	fmt.Fprintf(&b, "[General]\nColorScheme=%s\nName=%s\nshadeSortColumn=true\n", vimColorschemeName(name), strings.ReplaceAll(name, "\n", " "))
+	b.WriteString("\n[KDE]\ncontrast=4\n")
+
+	for _, section := range kdeColorSections {
+		fmt.Fprintf(&b, "\n[Colors:%s]\n", section.Name)
+		fmt.Fprintf(&b, "BackgroundAlternate=%s\n", kdeRGB(roles.named(section.BackgroundAlternate)))
+		fmt.Fprintf(&b, "BackgroundNormal=%s\n", kdeRGB(roles.named(section.BackgroundNormal)))
+		fmt.Fprintf(&b, "DecorationFocus=%s\n", kdeRGB(roles.C(2)))
+		fmt.Fprintf(&b, "DecorationHover=%s\n", kdeRGB(roles.C(2)))
+		fmt.Fprintf(&b, "ForegroundActive=%s\n", kdeRGB(roles.C(8)))
+		fmt.Fprintf(&b, "ForegroundInactive=%s\n", kdeRGB(roles.named(section.ForegroundInactive)))
+		fmt.Fprintf(&b, "ForegroundLink=%s\n", kdeRGB(roles.C(2)))
+		fmt.Fprintf(&b, "ForegroundNegative=%s\n", kdeRGB(roles.Error))
+		fmt.Fprintf(&b, "ForegroundNeutral=%s\n", kdeRGB(roles.Warning))
+		fmt.Fprintf(&b, "ForegroundNormal=%s\n", kdeRGB(roles.named(section.ForegroundNormal)))
+		fmt.Fprintf(&b, "ForegroundPositive=%s\n", kdeRGB(roles.Success))
+		fmt.Fprintf(&b, "ForegroundVisited=%s\n", kdeRGB(roles.C(6)))
+	}
+
+	b.WriteString("\n[WM]\n")
+	fmt.Fprintf(&b, "activeBackground=%s\n", kdeRGB(roles.SurfaceDark))
+	fmt.Fprintf(&b, "activeBlend=%s\n", kdeRGB(roles.Foreground))
+	fmt.Fprintf(&b, "activeForeground=%s\n", kdeRGB(roles.Foreground))
+	fmt.Fprintf(&b, "inactiveBackground=%s\n", kdeRGB(roles.SurfaceDark))
+	fmt.Fprintf(&b, "inactiveBlend=%s\n", kdeRGB(roles.Comment))
+	fmt.Fprintf(&b, "inactiveForeground=%s\n", kdeRGB(roles.Comment))
+	return []byte(b.String()), nil
+}
+
+// gtkNamedColors maps the named colors GTK themes read to roles. The theme_*
+// names are Adwaita's GTK 3 colors; the *_color names are libadwaita's GTK 4
+// colors. Writing both lets one gtk.css serve both versions.
+var gtkNamedColors = []struct {
+	Name string
+	Role string
+}{
+	{"theme_bg_color", "surface"},
+	{"theme_fg_color", "foreground"},
+	{"theme_base_color", "background"},
+	{"theme_text_color", "foreground"},
+	{"theme_selected_bg_color", "c2"},
+	{"theme_selected_fg_color", "background"},
+	{"insensitive_bg_color", "surface_dark"},
+	{"insensitive_fg_color", "comment"},
+	{"insensitive_base_color", "surface"},
+	{"theme_unfocused_bg_color", "surface"},
+	{"theme_unfocused_fg_color", "muted"},
+	{"theme_unfocused_base_color", "background"},
+	{"theme_unfocused_text_color", "muted"},
+	{"theme_unfocused_selected_bg_color", "selection"},
+	{"theme_unfocused_selected_fg_color", "foreground"},
+	{"borders", "border"},
+	{"unfocused_borders", "border"},
+	{"warning_color", "warning"},
+	{"error_color", "error"},
+	{"success_color", "success"},
+
+	{"accent_color", "c2"},
+	{"accent_bg_color", "c2"},
+	{"accent_fg_color", "background"},
+	{"destructive_color", "error"},
+	{"destructive_bg_color", "error"},
+	{"destructive_fg_color", "background"},
+	{"success_bg_color", "success"},
+	{"success_fg_color", "background"},
+	{"warning_bg_color", "warning"},
+	{"warning_fg_color", "background"},
+	{"error_bg_color", "error"},
+	{"error_fg_color", "background"},
+	{"window_bg_color", "surface"},
+	{"window_fg_color", "foreground"},
+	{"view_bg_color", "background"},
+	{"view_fg_color", "foreground"},
+	{"headerbar_bg_color", "surface_dark"},
+	{"headerbar_fg_color", "foreground"},
+	{"headerbar_border_color", "border"},
+	{"headerbar_backdrop_color", "surface"},
+	{"sidebar_bg_color", "surface_dark"},
+	{"sidebar_fg_color", "foreground"},
+	{"sidebar_backdrop_color", "surface"},
+	{"card_bg_color", "line_highlight"},
+	{"card_fg_color", "foreground"},
+	{"dialog_bg_color", "surface"},
+	{"dialog_fg_color", "foreground"},
+	{"popover_bg_color", "surface"},
+	{"popover_fg_color", "foreground"},
+	{"thumbnail_bg_color", "surface"},
+	{"thumbnail_fg_color", "foreground"},
+}
+
+// buildGTKStylesheet renders @define-color overrides for gtk-3.0/gtk.css and
+// gtk-4.0/gtk.css.
+func buildGTKStylesheet(name string, roles themeRoles) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/* %s, generated by ThemeSmith */\n\n", strings.ReplaceAll(name, "*/", "* /"))
+	for _, color := range gtkNamedColors {
+		fmt.Fprintf(&b, "@define-color %s %s;\n", color.Name, roles.named(color.Role))
+	}
+	return []byte(b.String()), nil
+}
+
+// buildXresources renders terminal colors as X resources for xrdb.
+func buildXresources(name string, roles themeRoles) ([]byte, error) {
+	scheme := buildTerminalScheme(roles)
+
+	var b strings.Builder
+	b.WriteString(terminalHeader("!", name))
+	fmt.Fprintf(&b, "\n*.foreground: %s\n*.background: %s\n*.cursorColor: %s\n", scheme.Foreground, scheme.Background, scheme.Cursor)
+	for i, hex := range scheme.ANSI {
+		fmt.Fprintf(&b, "*.color%d: %s\n", i, hex)
+	}
+	return []byte(b.String()), nil
+}
+
+// base16Palette assigns the base16 slots, and the extra base24 slots when
+// base24 is set. base00-base07 run from the background to the foreground's
+// extreme; base08-base0F are red, orange, yellow, green, cyan, blue, magenta
+// and brown, taken from the hue-matched terminal colors.
+func base16Palette(roles themeRoles, base24 bool) [][2]string {
+	scheme := buildTerminalScheme(roles)
+	extreme := "#ffffff"
+	if !roles.Dark {
+		extreme = "#000000"
+	}
+
+	slots := [][2]string{
+		{"base00", roles.Background},
+		{"base01", mixHex(roles.Background, roles.Foreground, 0.08)},
+		{"base02", roles.Selection},
+		{"base03", roles.Comment},
+		{"base04", mixHex(roles.Foreground, roles.Background, 0.3)},
+		{"base05", roles.Foreground},
+		{"base06", mixHex(roles.Foreground, extreme, 0.3)},
+		{"base07", mixHex(roles.Foreground, extreme, 0.6)},
+		{"base08", scheme.ANSI[1]},
+		{"base09", roles.Constants},
+		{"base0A", scheme.ANSI[3]},
+		{"base0B", scheme.ANSI[2]},
+		{"base0C", scheme.ANSI[6]},
+		{"base0D", scheme.ANSI[4]},
+		{"base0E", scheme.ANSI[5]},
+		{"base0F", mixHex(scheme.ANSI[1], roles.Background, 0.35)},
+	}
+	if base24 {
+		slots = append(slots,
+			[2]string{"base10", roles.Surface},
+			[2]string{"base11", roles.SurfaceDark},
+			[2]string{"base12", scheme.ANSI[9]},
+			[2]string{"base13", scheme.ANSI[11]},
+			[2]string{"base14", scheme.ANSI[10]},
+			[2]string{"base15", scheme.ANSI[14]},
+			[2]string{"base16", scheme.ANSI[12]},
+			[2]string{"base17", scheme.ANSI[13]},
+		)
+	}
+	return slots
+}
+
+// buildBase16Scheme renders a tinted-theming scheme YAML. system is "base16"
+// or "base24".
+func buildBase16Scheme(system string, name string, roles themeRoles) []byte {
+	variant := "dark"
+	if !roles.Dark {
+		variant = "light"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "system: %q\n", system)
+	fmt.Fprintf(&b, "name: %q\n", strings.ReplaceAll(name, "\n", " "))
+	b.WriteString("author: \"ThemeSmith\"\n")
+	fmt.Fprintf(&b, "variant: %q\n", variant)
+	b.WriteString("palette:\n")
+	for _, slot := range base16Palette(roles, system == "base24") {
+		fmt.Fprintf(&b, "  %s: %q\n", slot[0], slot[1])
+	}
+	return []byte(b.String())
+}
+
+func buildBase16(name string, roles themeRoles) ([]byte, error) {
+	return buildBase16Scheme("base16", name, roles), nil
+}
+
+func buildBase24(name string, roles themeRoles) ([]byte, error) {
+	return buildBase16Scheme("base24", name, roles), nil
+}
+
+// pywalColors is the colors.json layout pywal writes to ~/.cache/wal and
+// reads from ~/.config/wal/colorschemes.
+type pywalColors struct {
+	Wallpaper string            `json:"wallpaper"`
+	Alpha     string            `json:"alpha"`
+	Special   map[string]string `json:"special"`
+	Colors    map[string]string `json:"colors"`
+}
+
+func buildPywalColors(name string, roles themeRoles) ([]byte, error) {
+	scheme := buildTerminalScheme(roles)
+	colors := pywalColors{
+		Wallpaper: "None",
+		Alpha:     "100",
+		Special: map[string]string{
+			"background": scheme.Background,
+			"foreground": scheme.Foreground,
+			"cursor":     scheme.Cursor,
+		},
+		Colors: make(map[string]string, len(scheme.ANSI)),
+	}
+	for i, hex := range scheme.ANSI {
+		colors.Colors[fmt.Sprintf("color%d", i)] = hex
+	}
+	return indentedJSON(colors, "    ")
+}
+
+// roleExport renders a file from theme roles; the toolkit exporters share
+// this shape so each can be served for both themes and palettes.
+type roleExport func(name string, roles themeRoles) ([]byte, error)
+
+// respondRoleExport sends a rendered file named <name><suffix>, or fileName
+// when it is set.
+func respondRoleExport(c *gin.Context, name string, roles themeRoles, suffix string, fileName string, contentType string, render roleExport) {
+	data, err := render(name, roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render theme"})
+		return
+	}
+	if fileName == "" {
+		fileName = vimColorschemeName(name) + suffix
+	}
+	sendAttachment(c, fileName, contentType, data)
+}
+
+func respondThemeRoleExport(c *gin.Context, suffix string, fileName string, contentType string, render roleExport) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	respondRoleExport(c, theme.Row.Name, theme.Roles, suffix, fileName, contentType, render)
+}
+
+func respondPaletteRoleExport(c *gin.Context, suffix string, fileName string, contentType string, render roleExport) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	name, roles, err := loadPaletteRoles(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	respondRoleExport(c, name, roles, suffix, fileName, contentType, render)
+}
+
+// ThemeKDEHandler renders a theme as a KDE Plasma color scheme.
+func ThemeKDEHandler(c *gin.Context) {
+	respondThemeRoleExport(c, ".colors", "", "text/plain; charset=utf-8", buildKDEColorScheme)
+}
+
+// PaletteKDEHandler renders a palette as a KDE Plasma color scheme.
+func PaletteKDEHandler(c *gin.Context) {
+	respondPaletteRoleExport(c, ".colors", "", "text/plain; charset=utf-8", buildKDEColorScheme)
+}
+
+// ThemeGTKHandler renders a theme as GTK 3/4 gtk.css color overrides.
+func ThemeGTKHandler(c *gin.Context) {
+	respondThemeRoleExport(c, "", "gtk.css", "text/css; charset=utf-8", buildGTKStylesheet)
+}
+
+// PaletteGTKHandler renders a palette as GTK 3/4 gtk.css color overrides.
+func PaletteGTKHandler(c *gin.Context) {
+	respondPaletteRoleExport(c, "", "gtk.css", "text/css; charset=utf-8", buildGTKStylesheet)
+}
+
+// ThemeXresourcesHandler renders a theme as X resources.
+func ThemeXresourcesHandler(c *gin.Context) {
+	respondThemeRoleExport(c, ".Xresources", "", "text/plain; charset=utf-8", buildXresources)
+}
+
+// PaletteXresourcesHandler renders a palette as X resources.
+func PaletteXresourcesHandler(c *gin.Context) {
+	respondPaletteRoleExport(c, ".Xresources", "", "text/plain; charset=utf-8", buildXresources)
+}
+
+// ThemeBase16Handler renders a theme as a base16 scheme.
+func ThemeBase16Handler(c *gin.Context) {
+	respondThemeRoleExport(c, ".yaml", "", "application/yaml", buildBase16)
+}
+
+// PaletteBase16Handler renders a palette as a base16 scheme.
+func PaletteBase16Handler(c *gin.Context) {
+	respondPaletteRoleExport(c, ".yaml", "", "application/yaml", buildBase16)
+}
+
+// ThemeBase24Handler renders a theme as a base24 scheme.
+func ThemeBase24Handler(c *gin.Context) {
+	respondThemeRoleExport(c, ".yaml", "", "application/yaml", buildBase24)
+}
+
+// PaletteBase24Handler renders a palette as a base24 scheme.
+func PaletteBase24Handler(c *gin.Context) {
+	respondPaletteRoleExport(c, ".yaml", "", "application/yaml", buildBase24)
+}
+
+// ThemePywalHandler renders a theme as a pywal colors.json.
+func ThemePywalHandler(c *gin.Context) {
+	respondThemeRoleExport(c, ".json", "", "application/json", buildPywalColors)
+}
+
+// PalettePywalHandler renders a palette as a pywal colors.json.
+func PalettePywalHandler(c *gin.Context) {
+	respondPaletteRoleExport(c, ".json", "", "application/json", buildPywalColors)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildKDEColorScheme(t *testing.T) {
+	data, err := buildKDEColorScheme("Dusk Theme", terminalTestRoles())
+	require.NoError(t, err)
+	kde := string(data)
+
+	assert.Contains(t, kde, "[General]\nColorScheme=dusk-theme\nName=Dusk Theme\n")
+	assert.Contains(t, kde, "[Colors:View]\nBackgroundAlternate=")
+	assert.Contains(t, kde, "BackgroundNormal=16,16,16\n")
+	assert.Contains(t, kde, "ForegroundNormal=238,238,238\n")
+	assert.Contains(t, kde, "\n[WM]\n")
+	assert.NotContains(t, kde, "=\n")
+}
+
+func TestBuildGTKStylesheet(t *testing.T) {
+	data, err := buildGTKStylesheet("Dusk */ Theme", terminalTestRoles())
+	require.NoError(t, err)
+	css := string(data)
+
+	assert.True(t, strings.HasPrefix(css, "/* Dusk * / Theme, generated by ThemeSmith */\n"))
+	assert.Contains(t, css, "@define-color theme_base_color #101010;\n")
+	assert.Contains(t, css, "@define-color window_fg_color #eeeeee;\n")
+	assert.Contains(t, css, "@define-color accent_bg_color #e04040;\n")
+	assert.NotContains(t, css, " ;")
+}
+
+func TestBuildXresources(t *testing.T) {
+	data, err := buildXresources("Dusk", terminalTestRoles())
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "*.background: #101010\n")
+	assert.Contains(t, string(data), "*.color1: #e04040\n")
+	assert.Contains(t, string(data), "*.color15: ")
+}
+
+func TestBuildBase16Schemes(t *testing.T) {
+	base16 := string(buildBase16Scheme("base16", "Dusk", terminalTestRoles()))
+	assert.Contains(t, base16, "system: \"base16\"\nname: \"Dusk\"\n")
+	assert.Contains(t, base16, "variant: \"dark\"\n")
+	assert.Contains(t, base16, "  base00: \"#101010\"\n")
+	assert.Contains(t, base16, "  base05: \"#eeeeee\"\n")
+	assert.Contains(t, base16, "  base08: \"#e04040\"\n")
+	assert.Contains(t, base16, "  base0D: \"#4080ff\"\n")
+	assert.NotContains(t, base16, "base10")
+
+	base24 := string(buildBase16Scheme("base24", "Dusk", terminalTestRoles()))
+	assert.Contains(t, base24, "system: \"base24\"\n")
+	assert.Equal(t, 24, strings.Count(base24, "  base"))
+}
+
+func TestBuildPywalColors(t *testing.T) {
+	data, err := buildPywalColors("Dusk", terminalTestRoles())
+	require.NoError(t, err)
+
+	var colors pywalColors
+	require.NoError(t, json.Unmarshal(data, &colors))
+	assert.Equal(t, "#101010", colors.Special["background"])
+	assert.Equal(t, "#e04040", colors.Colors["color1"])
+	assert.Len(t, colors.Colors, 16)
+}
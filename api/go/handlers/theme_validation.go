@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxThemeValidationIssues = 50
+
+// themeSchemaValidators maps every supported editor type to the validator for
+// its embedded theme. The keys double as the set of accepted editor types.
+var themeSchemaValidators = map[string]func(v *themeValidator, theme map[string]any, pointer string){
+	"vscode":    validateVSCodeTheme,
+	"zed":       validateZedThemeFamily,
+	"jetbrains": validateJetBrainsTheme,
+	"neovim":    validatePaletteTheme,
+	"vim":       validatePaletteTheme,
+	"emacs":     validatePaletteTheme,
+}
+
+var (
+	hexColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	// VS Code color ids look like "editor.background" or "focusBorder".
+	vscodeColorKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*(?:\.[a-zA-Z0-9]+)*$`)
+	// Zed style keys look like "border.variant" or "vim.helix_normal.background".
+	zedStyleKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(?:\.[a-z0-9_]+)*$`)
+)
+
+var (
+	themePayloadKeys   = []string{"id", "name", "editorType", "signature", "themeResult", "themeColorsWithUsage", "createdAt", "updatedAt", "isShared", "sharedAt", "version", "forkCount", "forkedFromId", "forkedFromUserId"}
+	themeResultKeys    = []string{"theme", "themeOverrides", "rawThemeOverrides", "colors", "boostCoefficient"}
+	themeOverrideKeys  = []string{"background", "foreground", "c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9", "constants"}
+	vscodeThemeKeys    = []string{"$schema", "name", "type", "colors", "tokenColors", "semanticHighlighting", "semanticTokenColors", "include"}
+	vscodeThemeTypes   = []string{"dark", "light", "hc", "hcDark", "hcLight", "vs", "vs-dark", "hc-black", "hc-light"}
+	vscodeTokenKeys    = []string{"name", "scope", "settings"}
+	vscodeSettingsKeys = []string{"foreground", "background", "fontStyle"}
+	vscodeFontStyles   = []string{"italic", "bold", "underline", "strikethrough"}
+	vscodeSemanticKeys = []string{"foreground", "fontStyle", "bold", "italic", "underline", "strikethrough"}
+	zedFamilyKeys      = []string{"$schema", "name", "author", "themes"}
+	zedThemeKeys       = []string{"name", "appearance", "style"}
+	zedAppearances     = []string{"dark", "light"}
+	zedBackgrounds     = []string{"opaque", "blurred", "transparent"}
+	zedPlayerKeys      = []string{"cursor", "selection", "background"}
+	zedSyntaxKeys      = []string{"color", "background_color", "font_style", "font_weight"}
+	zedFontStyles      = []string{"normal", "italic", "oblique"}
+)
+
+type ThemeValidationIssue struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+type ThemeValidationError struct {
+	Issues []ThemeValidationIssue
+}
+
+func (e *ThemeValidationError) Error() string {
+	if len(e.Issues) == 0 {
+		return "invalid theme payload"
+	}
+
+	first := e.Issues[0]
+	msg := fmt.Sprintf("invalid theme payload at %s: %s", displayPointer(first.Pointer), first.Message)
+	if len(e.Issues) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Issues)-1)
+	}
+	return msg
+}
+
+func displayPointer(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
+
+// themeValidationOptions controls how strictly a payload is checked. Strict
+// mode rejects unknown keys in every fixed-shape object. Open maps such as VS
+// Code colors, Zed style colors and Zed syntax captures are still only checked
+// for key format and value type, since editors keep adding new entries.
+type themeValidationOptions struct {
+	Strict bool
+}
+
+func themeValidationOptionsFromRequest(c *gin.Context) themeValidationOptions {
+	strict, _ := strconv.ParseBool(c.Query("strict"))
+	return themeValidationOptions{Strict: strict}
+}
+
+// respondThemePayloadError reports a rejected payload as a 400, listing every
+// schema issue when there are any.
+func respondThemePayloadError(c *gin.Context, err error) {
+	var validationErr *ThemeValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "issues": validationErr.Issues})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// prefixThemeValidationError rebases issue pointers onto the document that
+// embeds the payload, such as an entry of a batch request.
+func prefixThemeValidationError(err error, prefix string) error {
+	var validationErr *ThemeValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	issues := make([]ThemeValidationIssue, len(validationErr.Issues))
+	for i, issue := range validationErr.Issues {
+		issues[i] = ThemeValidationIssue{Pointer: prefix + issue.Pointer, Message: issue.Message}
+	}
+	return &ThemeValidationError{Issues: issues}
+}
+
+type themeValidator struct {
+	strict bool
+	issues []ThemeValidationIssue
+}
+
+func (v *themeValidator) add(pointer string, format string, args ...any) {
+	if len(v.issues) >= maxThemeValidationIssues {
+		return
+	}
+	v.issues = append(v.issues, ThemeValidationIssue{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *themeValidator) err() error {
+	if len(v.issues) == 0 {
+		return nil
+	}
+	return &ThemeValidationError{Issues: v.issues}
+}
+
+// pointerJoin appends a reference token to a JSON pointer (RFC 6901).
+func pointerJoin(pointer string, token any) string {
+	s := fmt.Sprint(token)
+	s = strings.ReplaceAll(s, "~", "~0")
+	s = strings.ReplaceAll(s, "/", "~1")
+	return pointer + "/" + s
+}
+
+func (v *themeValidator) checkKeys(obj map[string]any, pointer string, allowed []string) {
+	if !v.strict {
+		return
+	}
+
+	for _, key := range sortedKeys(obj) {
+		if !slices.Contains(allowed, key) {
+			v.add(pointerJoin(pointer, key), "unknown key %q", key)
+		}
+	}
+}
+
+func (v *themeValidator) object(value any, pointer string) (map[string]any, bool) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		v.add(pointer, "must be an object")
+	}
+	return obj, ok
+}
+
+func (v *themeValidator) array(value any, pointer string) ([]any, bool) {
+	arr, ok := value.([]any)
+	if !ok {
+		v.add(pointer, "must be an array")
+	}
+	return arr, ok
+}
+
+func (v *themeValidator) optionalString(obj map[string]any, key string, pointer string) {
+	if value, ok := obj[key]; ok {
+		if _, ok := value.(string); !ok {
+			v.add(pointerJoin(pointer, key), "must be a string")
+		}
+	}
+}
+
+func (v *themeValidator) requiredString(obj map[string]any, key string, pointer string) {
+	value, ok := obj[key]
+	if !ok {
+		v.add(pointerJoin(pointer, key), "is required")
+		return
+	}
+	if s, ok := value.(string); !ok || strings.TrimSpace(s) == "" {
+		v.add(pointerJoin(pointer, key), "must be a non-empty string")
+	}
+}
+
+func (v *themeValidator) enum(value any, pointer string, allowed []string) {
+	s, ok := value.(string)
+	if !ok || !slices.Contains(allowed, s) {
+		v.add(pointer, "must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func (v *themeValidator) color(value any, pointer string, nullable bool) {
+	if value == nil && nullable {
+		return
+	}
+	s, ok := value.(string)
+	if !ok || !hexColorPattern.MatchString(s) {
+		v.add(pointer, "must be a hex color like #RRGGBB or #RRGGBBAA")
+	}
+}
+
+// validateThemePayload checks a saved theme payload: the editor type, the
+// generator result wrapper and the editor specific theme inside it.
+func validateThemePayload(payload map[string]any, editorType string, opts themeValidationOptions) error {
+	v := &themeValidator{strict: opts.Strict}
+	v.checkKeys(payload, "", themePayloadKeys)
+
+	schema, ok := themeSchemaValidators[editorType]
+	if !ok {
+		v.add("/editorType", "unsupported editor type %q; expected one of %s", editorType, strings.Join(supportedEditorTypes(), ", "))
+		return v.err()
+	}
+
+	rawResult, ok := payload["themeResult"]
+	if !ok || rawResult == nil {
+		return v.err()
+	}
+
+	result, ok := v.object(rawResult, "/themeResult")
+	if !ok {
+		return v.err()
+	}
+	v.checkKeys(result, "/themeResult", themeResultKeys)
+
+	for _, key := range []string{"themeOverrides", "rawThemeOverrides"} {
+		if raw, ok := result[key]; ok && raw != nil {
+			pointer := pointerJoin("/themeResult", key)
+			if overrides, ok := v.object(raw, pointer); ok {
+				v.checkKeys(overrides, pointer, themeOverrideKeys)
+				for _, name := range sortedKeys(overrides) {
+					if value := overrides[name]; value != "" && slices.Contains(themeOverrideKeys, name) {
+						v.color(value, pointerJoin(pointer, name), true)
+					}
+				}
+			}
+		}
+	}
+
+	if raw, ok := result["colors"]; ok && raw != nil {
+		if colors, ok := v.array(raw, "/themeResult/colors"); ok {
+			for i, entry := range colors {
+				pointer := pointerJoin("/themeResult/colors", i)
+				if obj, ok := v.object(entry, pointer); ok {
+					v.checkKeys(obj, pointer, []string{"hex"})
+					v.color(obj["hex"], pointerJoin(pointer, "hex"), false)
+				}
+			}
+		}
+	}
+
+	if raw, ok := result["theme"]; ok && raw != nil {
+		if theme, ok := v.object(raw, "/themeResult/theme"); ok && schema != nil {
+			schema(v, theme, "/themeResult/theme")
+		}
+	}
+
+	return v.err()
+}
+
+func supportedEditorTypes() []string {
+	types := make([]string, 0, len(themeSchemaValidators))
+	for editorType := range themeSchemaValidators {
+		types = append(types, editorType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+func validateVSCodeTheme(v *themeValidator, theme map[string]any, pointer string) {
+	v.checkKeys(theme, pointer, vscodeThemeKeys)
+	v.optionalString(theme, "$schema", pointer)
+	v.optionalString(theme, "name", pointer)
+	v.optionalString(theme, "include", pointer)
+
+	if value, ok := theme["type"]; ok {
+		v.enum(value, pointerJoin(pointer, "type"), vscodeThemeTypes)
+	}
+
+	if value, ok := theme["semanticHighlighting"]; ok {
+		if _, ok := value.(bool); !ok {
+			v.add(pointerJoin(pointer, "semanticHighlighting"), "must be a boolean")
+		}
+	}
+
+	if raw, ok := theme["colors"]; ok {
+		colorsPointer := pointerJoin(pointer, "colors")
+		if colors, ok := v.object(raw, colorsPointer); ok {
+			for _, key := range sortedKeys(colors) {
+				keyPointer := pointerJoin(colorsPointer, key)
+				if !vscodeColorKeyPattern.MatchString(key) {
+					v.add(keyPointer, "is not a valid color id")
+					continue
+				}
+				v.color(colors[key], keyPointer, true)
+			}
+		}
+	}
+
+	if raw, ok := theme["tokenColors"]; ok {
+		tokensPointer := pointerJoin(pointer, "tokenColors")
+		if tokens, ok := v.array(raw, tokensPointer); ok {
+			for i, entry := range tokens {
+				validateVSCodeTokenColor(v, entry, pointerJoin(tokensPointer, i))
+			}
+		}
+	}
+
+	if raw, ok := theme["semanticTokenColors"]; ok {
+		semanticPointer := pointerJoin(pointer, "semanticTokenColors")
+		if rules, ok := v.object(raw, semanticPointer); ok {
+			for _, key := range sortedKeys(rules) {
+				rulePointer := pointerJoin(semanticPointer, key)
+				switch rule := rules[key].(type) {
+				case string:
+					v.color(rule, rulePointer, false)
+				case map[string]any:
+					v.checkKeys(rule, rulePointer, vscodeSemanticKeys)
+					if fg, ok := rule["foreground"]; ok {
+						v.color(fg, pointerJoin(rulePointer, "foreground"), false)
+					}
+					v.optionalString(rule, "fontStyle", rulePointer)
+				default:
+					v.add(rulePointer, "must be a color or a style object")
+				}
+			}
+		}
+	}
+}
+
+func validateVSCodeTokenColor(v *themeValidator, entry any, pointer string) {
+	token, ok := v.object(entry, pointer)
+	if !ok {
+		return
+	}
+	v.checkKeys(token, pointer, vscodeTokenKeys)
+	v.optionalString(token, "name", pointer)
+
+	if scope, ok := token["scope"]; ok {
+		scopePointer := pointerJoin(pointer, "scope")
+		switch s := scope.(type) {
+		case string:
+		case []any:
+			for i, item := range s {
+				if _, ok := item.(string); !ok {
+					v.add(pointerJoin(scopePointer, i), "must be a string")
+				}
+			}
+		default:
+			v.add(scopePointer, "must be a string or an array of strings")
+		}
+	}
+
+	settingsPointer := pointerJoin(pointer, "settings")
+	rawSettings, ok := token["settings"]
+	if !ok {
+		v.add(settingsPointer, "is required")
+		return
+	}
+	settings, ok := v.object(rawSettings, settingsPointer)
+	if !ok {
+		return
+	}
+	v.checkKeys(settings, settingsPointer, vscodeSettingsKeys)
+
+	for _, key := range []string{"foreground", "background"} {
+		if value, ok := settings[key]; ok {
+			v.color(value, pointerJoin(settingsPointer, key), false)
+		}
+	}
+
+	if value, ok := settings["fontStyle"]; ok {
+		stylePointer := pointerJoin(settingsPointer, "fontStyle")
+		style, ok := value.(string)
+		if !ok {
+			v.add(stylePointer, "must be a string")
+			return
+		}
+		for word := range strings.FieldsSeq(style) {
+			if !slices.Contains(vscodeFontStyles, word) {
+				v.add(stylePointer, "unknown font style %q", word)
+			}
+		}
+	}
+}
+
+func validateZedThemeFamily(v *themeValidator, family map[string]any, pointer string) {
+	v.checkKeys(family, pointer, zedFamilyKeys)
+	v.optionalString(family, "$schema", pointer)
+	v.optionalString(family, "name", pointer)
+	v.optionalString(family, "author", pointer)
+
+	themesPointer := pointerJoin(pointer, "themes")
+	raw, ok := family["themes"]
+	if !ok {
+		// Minimal payloads only carry the name; a family without themes is
+		// still rejected once it has any structure of its own.
+		if len(family) > 1 {
+			v.add(themesPointer, "is required")
+		}
+		return
+	}
+
+	themes, ok := v.array(raw, themesPointer)
+	if !ok {
+		return
+	}
+	if len(themes) == 0 {
+		v.add(themesPointer, "must contain at least one theme")
+	}
+
+	for i, entry := range themes {
+		entryPointer := pointerJoin(themesPointer, i)
+		theme, ok := v.object(entry, entryPointer)
+		if !ok {
+			continue
+		}
+		v.checkKeys(theme, entryPointer, zedThemeKeys)
+		v.requiredString(theme, "name", entryPointer)
+
+		if appearance, ok := theme["appearance"]; ok {
+			v.enum(appearance, pointerJoin(entryPointer, "appearance"), zedAppearances)
+		} else {
+			v.add(pointerJoin(entryPointer, "appearance"), "is required")
+		}
+
+		stylePointer := pointerJoin(entryPointer, "style")
+		rawStyle, ok := theme["style"]
+		if !ok {
+			v.add(stylePointer, "is required")
+			continue
+		}
+		if style, ok := v.object(rawStyle, stylePointer); ok {
+			validateZedStyle(v, style, stylePointer)
+		}
+	}
+}
+
+func validateZedStyle(v *themeValidator, style map[string]any, pointer string) {
+	for _, key := range sortedKeys(style) {
+		value := style[key]
+		keyPointer := pointerJoin(pointer, key)
+
+		switch key {
+		case "accents":
+			if accents, ok := v.array(value, keyPointer); ok {
+				for i, accent := range accents {
+					v.color(accent, pointerJoin(keyPointer, i), true)
+				}
+			}
+		case "background.appearance":
+			v.enum(value, keyPointer, zedBackgrounds)
+		case "players":
+			if players, ok := v.array(value, keyPointer); ok {
+				for i, entry := range players {
+					playerPointer := pointerJoin(keyPointer, i)
+					if player, ok := v.object(entry, playerPointer); ok {
+						v.checkKeys(player, playerPointer, zedPlayerKeys)
+						for _, field := range sortedKeys(player) {
+							if slices.Contains(zedPlayerKeys, field) {
+								v.color(player[field], pointerJoin(playerPointer, field), true)
+							}
+						}
+					}
+				}
+			}
+		case "syntax":
+			if syntax, ok := v.object(value, keyPointer); ok {
+				for _, capture := range sortedKeys(syntax) {
+					validateZedSyntaxStyle(v, syntax[capture], pointerJoin(keyPointer, capture))
+				}
+			}
+		default:
+			if !zedStyleKeyPattern.MatchString(key) {
+				v.add(keyPointer, "is not a valid style key")
+				continue
+			}
+			v.color(value, keyPointer, true)
+		}
+	}
+}
+
+func validateZedSyntaxStyle(v *themeValidator, value any, pointer string) {
+	style, ok := v.object(value, pointer)
+	if !ok {
+		return
+	}
+	v.checkKeys(style, pointer, zedSyntaxKeys)
+
+	for _, key := range []string{"color", "background_color"} {
+		if color, ok := style[key]; ok {
+			v.color(color, pointerJoin(pointer, key), true)
+		}
+	}
+
+	if fontStyle, ok := style["font_style"]; ok && fontStyle != nil {
+		v.enum(fontStyle, pointerJoin(pointer, "font_style"), zedFontStyles)
+	}
+
+	if weight, ok := style["font_weight"]; ok && weight != nil {
+		w, ok := weight.(float64)
+		if !ok || w < 100 || w > 900 {
+			v.add(pointerJoin(pointer, "font_weight"), "must be a number between 100 and 900")
+		}
+	}
+}
+
+func sortedKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"themesmith/db"
+	"themesmith/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// vimHighlight styles one highlight group from palette roles, or links it to
+// another group. Groups starting with @ are Neovim only.
+type vimHighlight struct {
+	Group  string
+	Fg     string
+	Bg     string
+	Sp     string
+	Styles []string
+	Link   string
+}
+
+// vimPaletteRoles are the roles written to the Lua palette table, in order.
+// The diff_* entries are tints derived from the background.
+var vimPaletteRoles = slices.Concat(themeRoleNames, []string{"diff_add", "diff_change", "diff_delete", "diff_text"})
+
+// vimEditorHighlights are the built-in UI and syntax groups both Vim and
+// Neovim understand.
+var vimEditorHighlights = []vimHighlight{
+	{Group: "Normal", Fg: "foreground", Bg: "background"},
+	{Group: "NormalNC", Fg: "foreground", Bg: "background"},
+	{Group: "NormalFloat", Fg: "foreground", Bg: "surface"},
+	{Group: "FloatBorder", Fg: "border", Bg: "surface"},
+	{Group: "ColorColumn", Bg: "line_highlight"},
+	{Group: "Cursor", Fg: "background", Bg: "cursor"},
+	{Group: "CursorLine", Bg: "line_highlight"},
+	{Group: "CursorColumn", Link: "CursorLine"},
+	{Group: "CursorLineNr", Fg: "foreground", Styles: []string{"bold"}},
+	{Group: "LineNr", Fg: "comment"},
+	{Group: "SignColumn", Bg: "background"},
+	{Group: "Folded", Fg: "comment", Bg: "surface"},
+	{Group: "FoldColumn", Fg: "comment"},
+	{Group: "VertSplit", Fg: "border"},
+	{Group: "WinSeparator", Fg: "border"},
+	{Group: "StatusLine", Fg: "foreground", Bg: "surface_dark"},
+	{Group: "StatusLineNC", Fg: "comment", Bg: "surface_dark"},
+	{Group: "TabLine", Fg: "comment", Bg: "surface_dark"},
+	{Group: "TabLineFill", Bg: "surface_dark"},
+	{Group: "TabLineSel", Fg: "foreground", Bg: "background", Styles: []string{"bold"}},
+	{Group: "Pmenu", Fg: "foreground", Bg: "surface"},
+	{Group: "PmenuSel", Bg: "selection", Styles: []string{"bold"}},
+	{Group: "PmenuSbar", Bg: "surface"},
+	{Group: "PmenuThumb", Bg: "border"},
+	{Group: "WildMenu", Link: "PmenuSel"},
+	{Group: "Visual", Bg: "selection"},
+	{Group: "Search", Fg: "background", Bg: "warning"},
+	{Group: "IncSearch", Fg: "background", Bg: "c2"},
+	{Group: "MatchParen", Bg: "selection", Styles: []string{"bold"}},
+	{Group: "NonText", Fg: "border"},
+	{Group: "SpecialKey", Fg: "border"},
+	{Group: "EndOfBuffer", Fg: "background"},
+	{Group: "Directory", Fg: "c2"},
+	{Group: "Title", Fg: "c2", Styles: []string{"bold"}},
+	{Group: "ErrorMsg", Fg: "error"},
+	{Group: "WarningMsg", Fg: "warning"},
+	{Group: "MoreMsg", Fg: "success"},
+	{Group: "ModeMsg", Fg: "foreground", Styles: []string{"bold"}},
+	{Group: "Question", Fg: "c2"},
+	{Group: "Conceal", Fg: "comment"},
+	{Group: "SpellBad", Sp: "error", Styles: []string{"undercurl"}},
+	{Group: "SpellCap", Sp: "warning", Styles: []string{"undercurl"}},
+	{Group: "SpellRare", Sp: "info", Styles: []string{"undercurl"}},
+	{Group: "SpellLocal", Sp: "info", Styles: []string{"undercurl"}},
+	{Group: "DiffAdd", Bg: "diff_add"},
+	{Group: "DiffChange", Bg: "diff_change"},
+	{Group: "DiffDelete", Fg: "error", Bg: "diff_delete"},
+	{Group: "DiffText", Bg: "diff_text"},
+
+	{Group: "Comment", Fg: "comment", Styles: []string{"italic"}},
+	{Group: "Constant", Fg: "constants"},
+	{Group: "String", Fg: "c3"},
+	{Group: "Character", Fg: "c3"},
+	{Group: "Number", Fg: "constants"},
+	{Group: "Boolean", Fg: "constants"},
+	{Group: "Float", Fg: "constants"},
+	{Group: "Identifier", Fg: "foreground"},
+	{Group: "Function", Fg: "c2"},
+	{Group: "Statement", Fg: "c6"},
+	{Group: "Conditional", Fg: "c6"},
+	{Group: "Repeat", Fg: "c6"},
+	{Group: "Label", Fg: "c9"},
+	{Group: "Operator", Fg: "c8"},
+	{Group: "Keyword", Fg: "c6"},
+	{Group: "Exception", Fg: "c6"},
+	{Group: "PreProc", Fg: "c6"},
+	{Group: "Include", Fg: "c6"},
+	{Group: "Define", Fg: "c6"},
+	{Group: "Macro", Fg: "c9"},
+	{Group: "PreCondit", Fg: "c6"},
+	{Group: "Type", Fg: "c5"},
+	{Group: "StorageClass", Fg: "c6"},
+	{Group: "Structure", Fg: "c5"},
+	{Group: "Typedef", Fg: "c5"},
+	{Group: "Special", Fg: "c4"},
+	{Group: "SpecialChar", Fg: "c4"},
+	{Group: "Tag", Fg: "c2"},
+	{Group: "Delimiter", Fg: "muted"},
+	{Group: "SpecialComment", Fg: "comment", Styles: []string{"bold"}},
+	{Group: "Debug", Fg: "error"},
+	{Group: "Underlined", Fg: "c2", Styles: []string{"underline"}},
+	{Group: "Error", Fg: "error"},
+	{Group: "Todo", Fg: "background", Bg: "c8", Styles: []string{"bold"}},
+}
+
+// neovimHighlights adds diagnostics, Tree-sitter captures and LSP semantic
+// token groups on top of vimEditorHighlights.
+var neovimHighlights = []vimHighlight{
+	{Group: "WinBar", Fg: "foreground", Bg: "background"},
+	{Group: "WinBarNC", Fg: "comment", Bg: "background"},
+	{Group: "CurSearch", Link: "IncSearch"},
+	{Group: "Whitespace", Fg: "border"},
+	{Group: "Added", Fg: "success"},
+	{Group: "Changed", Fg: "warning"},
+	{Group: "Removed", Fg: "error"},
+	{Group: "DiagnosticError", Fg: "error"},
+	{Group: "DiagnosticWarn", Fg: "warning"},
+	{Group: "DiagnosticInfo", Fg: "info"},
+	{Group: "DiagnosticHint", Fg: "c5"},
+	{Group: "DiagnosticOk", Fg: "success"},
+	{Group: "DiagnosticUnderlineError", Sp: "error", Styles: []string{"undercurl"}},
+	{Group: "DiagnosticUnderlineWarn", Sp: "warning", Styles: []string{"undercurl"}},
+	{Group: "DiagnosticUnderlineInfo", Sp: "info", Styles: []string{"undercurl"}},
+	{Group: "DiagnosticUnderlineHint", Sp: "c5", Styles: []string{"undercurl"}},
+	{Group: "LspReferenceText", Bg: "line_highlight"},
+	{Group: "LspReferenceRead", Bg: "line_highlight"},
+	{Group: "LspReferenceWrite", Bg: "selection"},
+	{Group: "LspInlayHint", Fg: "comment", Bg: "line_highlight"},
+
+	{Group: "@comment", Link: "Comment"},
+	{Group: "@comment.documentation", Fg: "comment"},
+	{Group: "@comment.todo", Link: "Todo"},
+	{Group: "@comment.error", Fg: "error", Styles: []string{"bold"}},
+	{Group: "@comment.warning", Fg: "warning", Styles: []string{"bold"}},
+	{Group: "@keyword", Fg: "c6"},
+	{Group: "@keyword.function", Fg: "c6"},
+	{Group: "@keyword.return", Fg: "c6"},
+	{Group: "@keyword.import", Fg: "c6"},
+	{Group: "@keyword.operator", Fg: "c8"},
+	{Group: "@keyword.directive", Fg: "c6"},
+	{Group: "@operator", Fg: "c8"},
+	{Group: "@function", Fg: "c2"},
+	{Group: "@function.call", Fg: "c2"},
+	{Group: "@function.method", Fg: "c2"},
+	{Group: "@function.method.call", Fg: "c2"},
+	{Group: "@function.builtin", Fg: "c9"},
+	{Group: "@function.macro", Fg: "c9"},
+	{Group: "@constructor", Fg: "c8"},
+	{Group: "@type", Fg: "c5"},
+	{Group: "@type.builtin", Fg: "c9"},
+	{Group: "@type.definition", Fg: "c5"},
+	{Group: "@module", Fg: "c5"},
+	{Group: "@namespace", Fg: "c5"},
+	{Group: "@variable", Fg: "foreground"},
+	{Group: "@variable.builtin", Fg: "c9"},
+	{Group: "@variable.parameter", Fg: "c7"},
+	{Group: "@variable.member", Fg: "c1"},
+	{Group: "@parameter", Fg: "c7"},
+	{Group: "@field", Fg: "c1"},
+	{Group: "@property", Fg: "c1"},
+	{Group: "@string", Fg: "c3"},
+	{Group: "@string.escape", Fg: "c4"},
+	{Group: "@string.special", Fg: "c4"},
+	{Group: "@string.regexp", Fg: "constants"},
+	{Group: "@character", Fg: "c3"},
+	{Group: "@number", Fg: "constants"},
+	{Group: "@number.float", Fg: "constants"},
+	{Group: "@boolean", Fg: "constants"},
+	{Group: "@constant", Fg: "constants"},
+	{Group: "@constant.builtin", Fg: "c9"},
+	{Group: "@constant.macro", Fg: "c9"},
+	{Group: "@label", Fg: "c9"},
+	{Group: "@attribute", Fg: "constants"},
+	{Group: "@tag", Fg: "c2"},
+	{Group: "@tag.attribute", Fg: "c1"},
+	{Group: "@tag.delimiter", Fg: "c7"},
+	{Group: "@punctuation", Fg: "muted"},
+	{Group: "@punctuation.bracket", Fg: "muted"},
+	{Group: "@punctuation.delimiter", Fg: "muted"},
+	{Group: "@punctuation.special", Fg: "c4"},
+	{Group: "@markup.heading", Fg: "c2", Styles: []string{"bold"}},
+	{Group: "@markup.strong", Styles: []string{"bold"}},
+	{Group: "@markup.italic", Styles: []string{"italic"}},
+	{Group: "@markup.strikethrough", Styles: []string{"strikethrough"}},
+	{Group: "@markup.link", Fg: "c2", Styles: []string{"underline"}},
+	{Group: "@markup.link.url", Fg: "c2", Styles: []string{"underline"}},
+	{Group: "@markup.raw", Fg: "c3"},
+	{Group: "@markup.list", Fg: "c6"},
+	{Group: "@diff.plus", Fg: "success"},
+	{Group: "@diff.minus", Fg: "error"},
+	{Group: "@diff.delta", Fg: "warning"},
+
+	{Group: "@lsp.type.class", Link: "@type"},
+	{Group: "@lsp.type.comment", Link: "@comment"},
+	{Group: "@lsp.type.decorator", Link: "@attribute"},
+	{Group: "@lsp.type.enum", Link: "@type"},
+	{Group: "@lsp.type.enumMember", Link: "@constant"},
+	{Group: "@lsp.type.function", Link: "@function"},
+	{Group: "@lsp.type.interface", Link: "@type"},
+	{Group: "@lsp.type.keyword", Link: "@keyword"},
+	{Group: "@lsp.type.macro", Link: "@function.macro"},
+	{Group: "@lsp.type.method", Link: "@function.method"},
+	{Group: "@lsp.type.namespace", Link: "@module"},
+	{Group: "@lsp.type.parameter", Link: "@variable.parameter"},
+	{Group: "@lsp.type.property", Link: "@property"},
+	{Group: "@lsp.type.struct", Link: "@type"},
+	{Group: "@lsp.type.type", Link: "@type"},
+	{Group: "@lsp.type.typeParameter", Link: "@type.definition"},
+	{Group: "@lsp.type.variable", Link: "@variable"},
+	{Group: "@lsp.mod.deprecated", Styles: []string{"strikethrough"}},
+	{Group: "@lsp.typemod.function.defaultLibrary", Link: "@function.builtin"},
+	{Group: "@lsp.typemod.variable.defaultLibrary", Link: "@variable.builtin"},
+	{Group: "@lsp.typemod.variable.readonly", Link: "@constant"},
+}
+
+// vimPalette resolves the colors named in vimPaletteRoles.
+func vimPalette(roles themeRoles) map[string]string {
+	palette := map[string]string{
+		"diff_add":    mixHex(roles.Background, roles.Success, 0.2),
+		"diff_change": mixHex(roles.Background, roles.Warning, 0.15),
+		"diff_delete": mixHex(roles.Background, roles.Error, 0.2),
+		"diff_text":   mixHex(roles.Background, roles.Warning, 0.3),
+	}
+	for _, role := range vimPaletteRoles {
+		if _, ok := palette[role]; !ok {
+			palette[role] = roles.named(role)
+		}
+	}
+	return palette
+}
+
+// vimColorschemeName is the name passed to :colorscheme, which is also the
+// file name under colors/.
+func vimColorschemeName(name string) string {
+	if sanitized := sanitizeThemeName(name); sanitized != "" {
+		return sanitized
+	}
+	return "generated-theme"
+}
+
+func vimBackground(roles themeRoles) string {
+	if roles.Dark {
+		return "dark"
+	}
+	return "light"
+}
+
+func luaString(s string) string {
+	return strconv.Quote(s)
+}
+
+// buildNeovimColorscheme renders colors/<name>.lua.
+func buildNeovimColorscheme(name string, roles themeRoles) []byte {
+	scheme := vimColorschemeName(name)
+	palette := vimPalette(roles)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- %s, generated by ThemeSmith\n\n", strings.ReplaceAll(name, "\n", " "))
+	b.WriteString("vim.cmd(\"highlight clear\")\n")
+	b.WriteString("if vim.fn.exists(\"syntax_on\") == 1 then\n  vim.cmd(\"syntax reset\")\nend\n")
+	fmt.Fprintf(&b, "vim.o.background = %s\n", luaString(vimBackground(roles)))
+	fmt.Fprintf(&b, "vim.g.colors_name = %s\n\n", luaString(scheme))
+
+	b.WriteString("local palette = {\n")
+	for _, role := range vimPaletteRoles {
+		fmt.Fprintf(&b, "  %s = %s,\n", role, luaString(palette[role]))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("local highlights = {\n")
+	for _, group := range slices.Concat(vimEditorHighlights, neovimHighlights) {
+		fmt.Fprintf(&b, "  [%s] = { ", luaString(group.Group))
+		var fields []string
+		if group.Link != "" {
+			fields = append(fields, "link = "+luaString(group.Link))
+		}
+		for _, attr := range []struct{ key, role string }{{"fg", group.Fg}, {"bg", group.Bg}, {"sp", group.Sp}} {
+			if attr.role != "" {
+				fields = append(fields, attr.key+" = palette."+attr.role)
+			}
+		}
+		for _, style := range group.Styles {
+			fields = append(fields, style+" = true")
+		}
+		b.WriteString(strings.Join(fields, ", "))
+		b.WriteString(" },\n")
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("for group, spec in pairs(highlights) do\n  vim.api.nvim_set_hl(0, group, spec)\nend\n")
+	return []byte(b.String())
+}
+
+// xterm256 returns the closest xterm 256-color index for a #rrggbb color,
+// for ctermfg and ctermbg in terminals without true color.
+func xterm256(hex string) int {
+	c, err := utils.HexToRGBA(hex)
+	if err != nil {
+		return 0
+	}
+	levels := []int{0, 95, 135, 175, 215, 255}
+	nearest := func(v uint8) int {
+		best := 0
+		for i, level := range levels {
+			if math.Abs(float64(int(v)-level)) < math.Abs(float64(int(v)-levels[best])) {
+				best = i
+			}
+		}
+		return best
+	}
+	distance := func(r, g, b int) int {
+		dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+		return dr*dr + dg*dg + db*db
+	}
+
+	ri, gi, bi := nearest(c.R), nearest(c.G), nearest(c.B)
+	index := 16 + 36*ri + 6*gi + bi
+	best := distance(levels[ri], levels[gi], levels[bi])
+
+	gray := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIndex := min(max((gray-8+5)/10, 0), 23)
+	grayLevel := 8 + 10*grayIndex
+	if d := distance(grayLevel, grayLevel, grayLevel); d < best {
+		index = 232 + grayIndex
+	}
+	return index
+}
+
+// buildVimColorscheme renders colors/<name>.vim with GUI and 256-color
+// attributes for the groups classic Vim knows.
+func buildVimColorscheme(name string, roles themeRoles) []byte {
+	scheme := vimColorschemeName(name)
+	palette := vimPalette(roles)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\" %s, generated by ThemeSmith\n\n", strings.ReplaceAll(name, "\n", " "))
+	b.WriteString("highlight clear\n")
+	b.WriteString("if exists('syntax_on')\n  syntax reset\nendif\n")
+	fmt.Fprintf(&b, "set background=%s\n", vimBackground(roles))
+	fmt.Fprintf(&b, "let g:colors_name = '%s'\n\n", scheme)
+
+	for _, group := range vimEditorHighlights {
+		if group.Link != "" {
+			fmt.Fprintf(&b, "highlight! link %s %s\n", group.Group, group.Link)
+			continue
+		}
+
+		parts := []string{"highlight", group.Group}
+		if group.Fg != "" {
+			parts = append(parts, "guifg="+palette[group.Fg], fmt.Sprintf("ctermfg=%d", xterm256(palette[group.Fg])))
+		}
+		if group.Bg != "" {
+			parts = append(parts, "guibg="+palette[group.Bg], fmt.Sprintf("ctermbg=%d", xterm256(palette[group.Bg])))
+		}
+		if group.Sp != "" {
+			parts = append(parts, "guisp="+palette[group.Sp])
+		}
+		style := "NONE"
+		if len(group.Styles) > 0 {
+			style = strings.Join(group.Styles, ",")
+		}
+		parts = append(parts, "gui="+style, "cterm="+style)
+		b.WriteString(strings.Join(parts, " "))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+func respondVimColorscheme(c *gin.Context, extension string, contentType string, build func(string, themeRoles) []byte) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadRoleTheme(c, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	sendAttachment(c, vimColorschemeName(theme.Row.Name)+extension, contentType, build(theme.Row.Name, theme.Roles))
+}
+
+// ThemeNeovimHandler renders a saved theme of any editor type as a Neovim Lua
+// colorscheme for ~/.config/nvim/colors.
+func ThemeNeovimHandler(c *gin.Context) {
+	respondVimColorscheme(c, ".lua", "text/x-lua; charset=utf-8", buildNeovimColorscheme)
+}
+
+// ThemeVimHandler renders a saved theme of any editor type as a classic Vim
+// colorscheme for ~/.vim/colors.
+func ThemeVimHandler(c *gin.Context) {
+	respondVimColorscheme(c, ".vim", "text/plain; charset=utf-8", buildVimColorscheme)
+}
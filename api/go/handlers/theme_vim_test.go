@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+	"themesmith/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func vimTestRoles() themeRoles {
+	return resolveThemeRoles(model.Theme{Name: "Dusk", EditorType: "neovim"}, map[string]any{
+		"themeResult": map[string]any{"theme": map[string]any{
+			"background": "dark",
+			"palette":    map[string]any{"background": "#101010", "foreground": "#eeeeee", "c2": "#0000ff", "c6": "#ff00ff"},
+		}},
+	})
+}
+
+func TestBuildNeovimColorscheme(t *testing.T) {
+	lua := string(buildNeovimColorscheme("Dusk Theme", vimTestRoles()))
+
+	assert.Contains(t, lua, `vim.g.colors_name = "dusk-theme"`)
+	assert.Contains(t, lua, `vim.o.background = "dark"`)
+	assert.Contains(t, lua, `  c6 = "#ff00ff",`)
+	assert.Contains(t, lua, `  ["Normal"] = { fg = palette.foreground, bg = palette.background },`)
+	assert.Contains(t, lua, `  ["@keyword"] = { fg = palette.c6 },`)
+	assert.Contains(t, lua, `  ["@lsp.type.parameter"] = { link = "@variable.parameter" },`)
+	assert.Contains(t, lua, `  ["SpellBad"] = { sp = palette.error, undercurl = true },`)
+	assert.NotContains(t, lua, `= ""`)
+}
+
+func TestBuildVimColorscheme(t *testing.T) {
+	vim := string(buildVimColorscheme("Dusk", vimTestRoles()))
+
+	assert.Contains(t, vim, "let g:colors_name = 'dusk'")
+	assert.Contains(t, vim, "highlight Normal guifg=#eeeeee ctermfg=255 guibg=#101010 ctermbg=233 gui=NONE cterm=NONE\n")
+	assert.Contains(t, vim, "highlight Keyword guifg=#ff00ff ctermfg=201 gui=NONE cterm=NONE\n")
+	assert.Contains(t, vim, "highlight! link CursorColumn CursorLine\n")
+	assert.NotContains(t, vim, "@")
+	assert.NotContains(t, vim, "=\n")
+}
+
+func TestXterm256(t *testing.T) {
+	assert.Equal(t, 16, xterm256("#000000"))
+	assert.Equal(t, 231, xterm256("#ffffff"))
+	assert.Equal(t, 196, xterm256("#ff0000"))
+	assert.Equal(t, 244, xterm256("#808080"))
+}
+
+func TestValidateVimTheme(t *testing.T) {
+	payload := func(theme map[string]any) map[string]any {
+		return map[string]any{"themeResult": map[string]any{"theme": theme}}
+	}
+
+	assert.NoError(t, validateThemePayload(payload(map[string]any{"background": "light", "palette": map[string]any{"c1": "#123456"}}), "vim", themeValidationOptions{}))
+	assert.Error(t, validateThemePayload(payload(map[string]any{"background": "dim"}), "neovim", themeValidationOptions{}))
+	assert.Error(t, validateThemePayload(payload(map[string]any{"palette": map[string]any{"c1": "blue"}}), "neovim", themeValidationOptions{}))
+}
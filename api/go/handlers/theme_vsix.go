@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"themesmith/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	vsixPublisher     = "themesmith"
+	vsixEngineVersion = "^1.70.0"
+)
+
+// vscodePackageJSON and vscodeThemeEntry match the package.json the desktop
+// app writes for its local extension.
+type vscodePackageJSON struct {
+	Name        string                       `json:"name"`
+	DisplayName string                       `json:"displayName"`
+	Description string                       `json:"description"`
+	Version     string                       `json:"version"`
+	Publisher   string                       `json:"publisher"`
+	Engines     map[string]string            `json:"engines"`
+	Categories  []string                     `json:"categories,omitempty"`
+	Contributes vscodePackageJSONContributes `json:"contributes"`
+}
+
+type vscodePackageJSONContributes struct {
+	Themes []vscodeThemeEntry `json:"themes"`
+}
+
+type vscodeThemeEntry struct {
+	Label   string `json:"label"`
+	UITheme string `json:"uiTheme"`
+	Path    string `json:"path"`
+}
+
+type vsixManifest struct {
+	XMLName      xml.Name `xml:"PackageManifest"`
+	Version      string   `xml:"Version,attr"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	XmlnsD       string   `xml:"xmlns:d,attr"`
+	Metadata     vsixMetadata
+	Installation struct {
+		InstallationTarget struct {
+			ID string `xml:"Id,attr"`
+		}
+	}
+	Dependencies struct{}
+	Assets       struct {
+		Asset []vsixAsset
+	}
+}
+
+type vsixMetadata struct {
+	Identity struct {
+		Language  string `xml:"Language,attr"`
+		ID        string `xml:"Id,attr"`
+		Version   string `xml:"Version,attr"`
+		Publisher string `xml:"Publisher,attr"`
+	}
+	DisplayName string
+	Description struct {
+		Space string `xml:"xml:space,attr"`
+		Text  string `xml:",chardata"`
+	}
+	Tags         string
+	Categories   string
+	GalleryFlags string
+	Properties   struct {
+		Property []vsixProperty
+	}
+}
+
+type vsixProperty struct {
+	ID    string `xml:"Id,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+type vsixAsset struct {
+	Type        string `xml:"Type,attr"`
+	Path        string `xml:"Path,attr"`
+	Addressable string `xml:"Addressable,attr"`
+}
+
+type vsixContentTypes struct {
+	XMLName  xml.Name `xml:"Types"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Defaults []vsixContentTypeDefault
+}
+
+type vsixContentTypeDefault struct {
+	XMLName     xml.Name `xml:"Default"`
+	Extension   string   `xml:"Extension,attr"`
+	ContentType string   `xml:"ContentType,attr"`
+}
+
+// vscodeUITheme maps a theme's type to the base theme VS Code layers it on.
+func vscodeUITheme(theme map[string]any) string {
+	themeType, _ := theme["type"].(string)
+	switch strings.ToLower(strings.TrimSpace(themeType)) {
+	case "light", "vs":
+		return "vs"
+	case "hc", "hcdark", "hc-black":
+		return "hc-black"
+	case "hclight", "hc-light":
+		return "hc-light"
+	default:
+		return "vs-dark"
+	}
+}
+
+// buildVSIX packages VS Code themes as an extension that installs with
+// `code --install-extension`. It returns the archive and its file name.
+func buildVSIX(themes []exportedTheme) ([]byte, string, error) {
+	fileNames := themeFileNames(themes)
+
+	name := "themesmith-" + fileNames[0]
+	displayName := themes[0].Row.Name
+	description := "Color theme generated by ThemeSmith"
+	if len(themes) > 1 {
+		name = "themesmith-collection-" + fileNames[0]
+		displayName = fmt.Sprintf("%s and %d more", themes[0].Row.Name, len(themes)-1)
+		description = "Color themes generated by ThemeSmith"
+	}
+
+	version := exportVersion(themes)
+
+	pkg := vscodePackageJSON{
+		Name:        name,
+		DisplayName: displayName,
+		Description: description,
+		Version:     version,
+		Publisher:   vsixPublisher,
+		Engines:     map[string]string{"vscode": vsixEngineVersion},
+		Categories:  []string{"Themes"},
+	}
+
+	entries := make([]zipEntry, 0, len(themes)+3)
+	for i, theme := range themes {
+		path := "themes/" + fileNames[i] + ".json"
+		pkg.Contributes.Themes = append(pkg.Contributes.Themes, vscodeThemeEntry{
+			Label:   theme.Row.Name,
+			UITheme: vscodeUITheme(theme.Theme),
+			Path:    "./" + path,
+		})
+
+		data, err := indentedJSON(theme.Theme, "    ")
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, zipEntry{Name: "extension/" + path, Data: data})
+	}
+
+	packageData, err := indentedJSON(pkg, "  ")
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest := vsixManifest{
+		Version: "2.0.0",
+		Xmlns:   "http://schemas.microsoft.com/developer/vsx-schema/2011",
+		XmlnsD:  "http://schemas.microsoft.com/developer/vsx-schema-design/2011",
+	}
+	manifest.Metadata.Identity.Language = "en-US"
+	manifest.Metadata.Identity.ID = name
+	manifest.Metadata.Identity.Version = version
+	manifest.Metadata.Identity.Publisher = vsixPublisher
+	manifest.Metadata.DisplayName = displayName
+	manifest.Metadata.Description.Space = "preserve"
+	manifest.Metadata.Description.Text = description
+	manifest.Metadata.Tags = "theme,color-theme"
+	manifest.Metadata.Categories = "Themes"
+	manifest.Metadata.GalleryFlags = "Public"
+	manifest.Metadata.Properties.Property = []vsixProperty{
+		{ID: "Microsoft.VisualStudio.Code.Engine", Value: vsixEngineVersion},
+		{ID: "Microsoft.VisualStudio.Code.ExtensionDependencies", Value: ""},
+		{ID: "Microsoft.VisualStudio.Code.ExtensionPack", Value: ""},
+		{ID: "Microsoft.VisualStudio.Code.ExtensionKind", Value: "ui,workspace"},
+		{ID: "Microsoft.VisualStudio.Code.LocalizedLanguages", Value: ""},
+	}
+	manifest.Installation.InstallationTarget.ID = "Microsoft.VisualStudio.Code"
+	manifest.Assets.Asset = []vsixAsset{
+		{Type: "Microsoft.VisualStudio.Code.Manifest", Path: "extension/package.json", Addressable: "true"},
+	}
+
+	manifestData, err := marshalXMLDocument(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentTypesData, err := marshalXMLDocument(vsixContentTypes{
+		Xmlns: "http://schemas.openxmlformats.org/package/2006/content-types",
+		Defaults: []vsixContentTypeDefault{
+			{Extension: ".json", ContentType: "application/json"},
+			{Extension: ".vsixmanifest", ContentType: "text/xml"},
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries = append([]zipEntry{
+		{Name: "[Content_Types].xml", Data: contentTypesData},
+		{Name: "extension.vsixmanifest", Data: manifestData},
+		{Name: "extension/package.json", Data: packageData},
+	}, entries...)
+
+	archive, err := buildZip(entries)
+	if err != nil {
+		return nil, "", err
+	}
+	return archive, fmt.Sprintf("%s-%s.vsix", name, version), nil
+}
+
+func marshalXMLDocument(value any) ([]byte, error) {
+	encoded, err := xml.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(`<?xml version="1.0" encoding="utf-8"?>`+"\n"), append(encoded, '\n')...), nil
+}
+
+func respondVSIX(c *gin.Context, themes []exportedTheme) {
+	archive, fileName, err := buildVSIX(themes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build VSIX package"})
+		return
+	}
+	sendAttachment(c, fileName, "application/vsix", archive)
+}
+
+// ThemeVSIXHandler packages one VS Code theme. Shared themes are public;
+// private ones need the owner's token.
+func ThemeVSIXHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadExportedTheme(c, c.Param("id"), "vscode")
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	respondVSIX(c, []exportedTheme{theme})
+}
+
+// ThemesVSIXHandler packages several VS Code themes, given as ?ids=, into a
+// single extension.
+func ThemesVSIXHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	ids, err := exportThemeIDs(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	themes, err := loadExportedThemes(c, ids, "vscode")
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	respondVSIX(c, themes)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"themesmith/db"
+	"themesmith/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const zedThemeSchema = "https://zed.dev/schema/themes/v0.2.0.json"
+
+// zedThemeAuthors lists the names of the users who own the exported themes.
+// Emails are left out because shared themes can be downloaded by anyone.
+func zedThemeAuthors(themes []exportedTheme) ([]string, error) {
+	var userIDs []uint
+	for _, theme := range themes {
+		if theme.Row.UserID != nil && !slices.Contains(userIDs, *theme.Row.UserID) {
+			userIDs = append(userIDs, *theme.Row.UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return []string{"ThemeSmith"}, nil
+	}
+
+	var users []model.User
+	if err := db.DB.Select("id", "name").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	authors := make([]string, 0, len(users))
+	for _, id := range userIDs {
+		for _, user := range users {
+			name := strings.TrimSpace(user.Name)
+			if user.ID == id && name != "" && !slices.Contains(authors, name) {
+				authors = append(authors, name)
+			}
+		}
+	}
+	if len(authors) == 0 {
+		authors = []string{"ThemeSmith"}
+	}
+	return authors, nil
+}
+
+// buildZedFamily merges the saved Zed theme families into one, renaming
+// variants whose names collide since Zed keys themes by name.
+func buildZedFamily(name string, author string, themes []exportedTheme) map[string]any {
+	variants := make([]any, 0, len(themes))
+	used := map[string]int{}
+	for _, theme := range themes {
+		entries, _ := theme.Theme["themes"].([]any)
+		for _, entry := range entries {
+			variant, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			variantName, _ := variant["name"].(string)
+			if strings.TrimSpace(variantName) == "" {
+				variantName = theme.Row.Name
+			}
+			used[variantName]++
+			if used[variantName] > 1 {
+				variantName = fmt.Sprintf("%s (%d)", variantName, used[variantName])
+			}
+
+			copied := make(map[string]any, len(variant))
+			for key, value := range variant {
+				copied[key] = value
+			}
+			copied["name"] = variantName
+			variants = append(variants, copied)
+		}
+	}
+
+	return map[string]any{
+		"$schema": zedThemeSchema,
+		"name":    name,
+		"author":  author,
+		"themes":  variants,
+	}
+}
+
+// buildZedExtension lays the themes out as a Zed extension that can be
+// installed with "zed: install dev extension". It returns the zip and its
+// file name.
+func buildZedExtension(themes []exportedTheme, authors []string) ([]byte, string, error) {
+	fileNames := themeFileNames(themes)
+
+	id := "themesmith-" + fileNames[0]
+	name := themes[0].Row.Name
+	description := "Color theme generated by ThemeSmith"
+	if len(themes) > 1 {
+		id = "themesmith-collection-" + fileNames[0]
+		name = fmt.Sprintf("%s and %d more", themes[0].Row.Name, len(themes)-1)
+		description = "Color themes generated by ThemeSmith"
+	}
+	version := exportVersion(themes)
+
+	family := buildZedFamily(name, strings.Join(authors, ", "), themes)
+	if variants, _ := family["themes"].([]any); len(variants) == 0 {
+		return nil, "", &statusError{Status: http.StatusUnprocessableEntity, Message: "selected themes contain no Zed theme variants"}
+	}
+
+	familyData, err := indentedJSON(family, "    ")
+	if err != nil {
+		return nil, "", err
+	}
+
+	quotedAuthors := make([]string, len(authors))
+	for i, author := range authors {
+		quotedAuthors[i] = tomlString(author)
+	}
+
+	var manifest strings.Builder
+	fmt.Fprintf(&manifest, "id = %s\n", tomlString(id))
+	fmt.Fprintf(&manifest, "name = %s\n", tomlString(name))
+	fmt.Fprintf(&manifest, "version = %s\n", tomlString(version))
+	manifest.WriteString("schema_version = 1\n")
+	fmt.Fprintf(&manifest, "authors = [%s]\n", strings.Join(quotedAuthors, ", "))
+	fmt.Fprintf(&manifest, "description = %s\n", tomlString(description))
+
+	root := id + "/"
+	archive, err := buildZip([]zipEntry{
+		{Name: root + "extension.toml", Data: []byte(manifest.String())},
+		{Name: root + "themes/" + fileNames[0] + ".json", Data: familyData},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return archive, fmt.Sprintf("%s-%s.zip", id, version), nil
+}
+
+func respondZedExtension(c *gin.Context, themes []exportedTheme) {
+	authors, err := zedThemeAuthors(themes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load theme authors"})
+		return
+	}
+
+	archive, fileName, err := buildZedExtension(themes, authors)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+	sendAttachment(c, fileName, "application/zip", archive)
+}
+
+// ThemeZedExtensionHandler packages one Zed theme family as an extension.
+// Shared themes are public; private ones need the owner's token.
+func ThemeZedExtensionHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	theme, err := loadExportedTheme(c, c.Param("id"), "zed")
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	respondZedExtension(c, []exportedTheme{theme})
+}
+
+// ThemesZedExtensionHandler bundles several Zed themes, given as ?ids=, into
+// a single extension with one theme family.
+func ThemesZedExtensionHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	ids, err := exportThemeIDs(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	themes, err := loadExportedThemes(c, ids, "zed")
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	respondZedExtension(c, themes)
+}
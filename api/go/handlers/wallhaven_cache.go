@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type wallhavenCacheKind string
+
+const (
+	wallhavenCacheSearch    wallhavenCacheKind = "search"
+	wallhavenCacheWallpaper wallhavenCacheKind = "wallpaper"
+	wallhavenCacheThumbnail wallhavenCacheKind = "thumbnail"
+)
+
+const (
+	defaultWallhavenSearchTTL    = 5 * time.Minute
+	defaultWallhavenWallpaperTTL = time.Hour
+	defaultWallhavenThumbnailTTL = 24 * time.Hour
+
+	defaultWallhavenMemoryCacheBytes int64 = 64 << 20
+	defaultWallhavenDiskCacheBytes   int64 = 512 << 20
+
+	initialWallhavenBackoff = 15 * time.Second
+	maxWallhavenBackoff     = 5 * time.Minute
+
+	headerCacheStatus = "X-ThemeSmith-Cache"
+)
+
+const (
+	cacheStatusHit   = "HIT"
+	cacheStatusMiss  = "MISS"
+	cacheStatusStale = "STALE"
+)
+
+// upstreamRateLimitedError is returned while Wallhaven is backing us off and
+// nothing usable is cached. It is reported as 503 with a Retry-After header
+// rather than passing the upstream 429 through.
+type upstreamRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *upstreamRateLimitedError) Error() string {
+	return "wallhaven rate limit reached, retry later"
+}
+
+func (e *upstreamRateLimitedError) retryAfterSeconds() int {
+	return max(int(math.Ceil(e.RetryAfter.Seconds())), 1)
+}
+
+type wallhavenCacheEntry struct {
+	StatusCode  int       `json:"statusCode"`
+	ContentType string    `json:"contentType"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Body        []byte    `json:"-"`
+}
+
+func (e wallhavenCacheEntry) response(cacheStatus string) *fetchedResponse {
+	return &fetchedResponse{
+		StatusCode:  e.StatusCode,
+		Header:      http.Header{"Content-Type": []string{e.ContentType}},
+		Body:        e.Body,
+		CacheStatus: cacheStatus,
+	}
+}
+
+func wallhavenCacheEntrySize(e wallhavenCacheEntry) int64 {
+	return int64(len(e.Body) + len(e.ContentType))
+}
+
+type wallhavenCacheConfig struct {
+	MemoryBytes int64
+	DiskBytes   int64
+	// Dir enables the on-disk tier. It is empty, and the tier disabled, unless
+	// WALLHAVEN_CACHE_DIR is set.
+	Dir  string
+	TTLs map[wallhavenCacheKind]time.Duration
+}
+
+func loadWallhavenCacheConfig() wallhavenCacheConfig {
+	return wallhavenCacheConfig{
+		MemoryBytes: envInt64("WALLHAVEN_CACHE_BYTES", defaultWallhavenMemoryCacheBytes),
+		DiskBytes:   envInt64("WALLHAVEN_DISK_CACHE_BYTES", defaultWallhavenDiskCacheBytes),
+		Dir:         strings.TrimSpace(os.Getenv("WALLHAVEN_CACHE_DIR")),
+		TTLs: map[wallhavenCacheKind]time.Duration{
+			wallhavenCacheSearch:    envDuration("WALLHAVEN_SEARCH_TTL", defaultWallhavenSearchTTL),
+			wallhavenCacheWallpaper: envDuration("WALLHAVEN_WALLPAPER_TTL", defaultWallhavenWallpaperTTL),
+			wallhavenCacheThumbnail: envDuration("WALLHAVEN_THUMBNAIL_TTL", defaultWallhavenThumbnailTTL),
+		},
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+
+	v, err := time.ParseDuration(raw)
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
+
+// wallhavenCache fronts every Wallhaven request with a memory tier and an
+// optional disk tier. Expired entries are kept until evicted so they can be
+// served while upstream is rate limiting us or unreachable.
+type wallhavenCache struct {
+	ttls    map[wallhavenCacheKind]time.Duration
+	memory  *lruCache[wallhavenCacheEntry]
+	disk    *diskCache
+	backoff *hostBackoff
+	now     func() time.Time
+}
+
+func newWallhavenCache(cfg wallhavenCacheConfig) *wallhavenCache {
+	c := &wallhavenCache{
+		ttls:    cfg.TTLs,
+		memory:  newLRUCache(cfg.MemoryBytes, wallhavenCacheEntrySize),
+		backoff: newHostBackoff(),
+		now:     time.Now,
+	}
+
+	if cfg.Dir != "" {
+		disk, err := newDiskCache(cfg.Dir, cfg.DiskBytes)
+		if err != nil {
+			log.Printf("wallhaven disk cache disabled: %v", err)
+		} else {
+			c.disk = disk
+		}
+	}
+
+	return c
+}
+
+var (
+	wallhavenCacheOnce     sync.Once
+	wallhavenCacheInstance *wallhavenCache
+)
+
+func sharedWallhavenCache() *wallhavenCache {
+	wallhavenCacheOnce.Do(func() {
+		wallhavenCacheInstance = newWallhavenCache(loadWallhavenCacheConfig())
+	})
+	return wallhavenCacheInstance
+}
+
+func (c *wallhavenCache) ttl(kind wallhavenCacheKind) time.Duration {
+	return c.ttls[kind]
+}
+
+// wallhavenCacheKey separates entries per API key, since a key changes which
+// wallpapers Wallhaven returns. Only a hash of the key is kept.
+func wallhavenCacheKey(kind wallhavenCacheKind, rawURL string, apiKey string) string {
+	key := string(kind) + "\n" + rawURL
+	if apiKey != "" {
+		key += "\n" + hashBytes([]byte(apiKey))
+	}
+	return hashBytes([]byte(key))
+}
+
+func (c *wallhavenCache) lookup(key string) (wallhavenCacheEntry, bool) {
+	if entry, ok := c.memory.Get(key); ok {
+		return entry, true
+	}
+	if c.disk == nil {
+		return wallhavenCacheEntry{}, false
+	}
+
+	entry, ok := c.disk.Get(key)
+	if ok {
+		c.memory.Add(key, entry)
+	}
+	return entry, ok
+}
+
+func (c *wallhavenCache) store(key string, entry wallhavenCacheEntry) {
+	c.memory.Add(key, entry)
+	if c.disk != nil {
+		if err := c.disk.Add(key, entry); err != nil {
+			log.Printf("wallhaven disk cache write failed: %v", err)
+		}
+	}
+}
+
+// fetch returns a cached response when it is still fresh and otherwise goes
+// upstream through safeFetch. Only 200 responses are cached. A 429 starts a
+// backoff for the host during which no requests are sent; stale entries are
+// served in the meantime when available.
+func (c *wallhavenCache) fetch(ctx context.Context, kind wallhavenCacheKind, rawURL string, opts fetchOptions, apiKey string) (*fetchedResponse, error) {
+	key := wallhavenCacheKey(kind, rawURL, apiKey)
+	now := c.now()
+
+	cached, found := c.lookup(key)
+	if found && now.Before(cached.ExpiresAt) {
+		return cached.response(cacheStatusHit), nil
+	}
+
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	if wait := c.backoff.remaining(host, now); wait > 0 {
+		if found {
+			return cached.response(cacheStatusStale), nil
+		}
+		return nil, &upstreamRateLimitedError{RetryAfter: wait}
+	}
+
+	resp, err := safeFetch(ctx, rawURL, opts)
+	if err != nil {
+		if found {
+			return cached.response(cacheStatusStale), nil
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := c.backoff.trip(host, now, parseRetryAfter(resp.Header.Get("Retry-After"), now))
+		if found {
+			return cached.response(cacheStatusStale), nil
+		}
+		return nil, &upstreamRateLimitedError{RetryAfter: wait}
+	}
+	c.backoff.reset(host)
+
+	if resp.StatusCode == http.StatusOK {
+		c.store(key, wallhavenCacheEntry{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.ContentType(),
+			ExpiresAt:   now.Add(c.ttl(kind)),
+			Body:        resp.Body,
+		})
+	}
+
+	resp.CacheStatus = cacheStatusMiss
+	return resp, nil
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds and an
+// HTTP date. It returns zero when the header is missing or unusable.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+type backoffState struct {
+	until    time.Time
+	failures int
+}
+
+// hostBackoff tracks rate limiting per upstream host so a throttled API does
+// not block thumbnails served from a different host.
+type hostBackoff struct {
+	mu    sync.Mutex
+	hosts map[string]backoffState
+}
+
+func newHostBackoff() *hostBackoff {
+	return &hostBackoff{hosts: map[string]backoffState{}}
+}
+
+func (b *hostBackoff) remaining(host string, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return max(b.hosts[host].until.Sub(now), 0)
+}
+
+// trip starts or extends the backoff for host. Without a Retry-After hint the
+// delay doubles with every consecutive 429, capped at maxWallhavenBackoff.
+func (b *hostBackoff) trip(host string, now time.Time, retryAfter time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.hosts[host]
+	wait := retryAfter
+	if wait <= 0 {
+		wait = initialWallhavenBackoff << min(state.failures, 8)
+	}
+	wait = min(wait, maxWallhavenBackoff)
+
+	state.failures++
+	state.until = now.Add(wait)
+	b.hosts[host] = state
+	return wait
+}
+
+func (b *hostBackoff) reset(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.hosts, host)
+}
+
+// diskCache persists entries as one file per key: a JSON header line followed
+// by the raw body. File sizes are tracked in an lruCache so the directory stays
+// within its byte budget; least recently used files are deleted first.
+type diskCache struct {
+	dir   string
+	index *lruCache[int64]
+}
+
+func newDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	d := &diskCache{
+		dir:   dir,
+		index: newLRUCache(maxBytes, func(size int64) int64 { return size }),
+	}
+	d.index.onEvict = func(key string, _ int64) {
+		os.Remove(d.path(key))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existingFile struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []existingFile
+	for _, entry := range entries {
+		if entry.IsDir() || !isCacheKey(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, existingFile{key: entry.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	// Oldest first, so the most recently written files end up most recently used.
+	slices.SortFunc(files, func(a, b existingFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range files {
+		d.index.Add(f.key, f.size)
+	}
+
+	return d, nil
+}
+
+func isCacheKey(name string) bool {
+	if len(name) != 64 {
+		return false
+	}
+	for _, r := range name {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *diskCache) path(key string) string {
+	return filepath.Join(d.dir, key)
+}
+
+func (d *diskCache) Get(key string) (wallhavenCacheEntry, bool) {
+	if _, ok := d.index.Get(key); !ok {
+		return wallhavenCacheEntry{}, false
+	}
+
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		d.index.Remove(key)
+		return wallhavenCacheEntry{}, false
+	}
+
+	entry, err := decodeDiskEntry(data)
+	if err != nil {
+		d.index.Remove(key)
+		os.Remove(d.path(key))
+		return wallhavenCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (d *diskCache) Add(key string, entry wallhavenCacheEntry) error {
+	header, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(header) + 1 + len(entry.Body))
+	if size > d.index.maxBytes {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	w.Write(header)
+	w.WriteByte('\n')
+	w.Write(entry.Body)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		return err
+	}
+
+	d.index.Add(key, size)
+	return nil
+}
+
+func decodeDiskEntry(data []byte) (wallhavenCacheEntry, error) {
+	newline := bytes.IndexByte(data, '\n')
+	if newline < 0 {
+		return wallhavenCacheEntry{}, errors.New("missing cache entry header")
+	}
+
+	var entry wallhavenCacheEntry
+	if err := json.Unmarshal(data[:newline], &entry); err != nil {
+		return wallhavenCacheEntry{}, fmt.Errorf("invalid cache entry header: %w", err)
+	}
+	entry.Body = data[newline+1:]
+	return entry, nil
+}
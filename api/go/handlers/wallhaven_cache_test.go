@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWallhavenCacheConfig(dir string) wallhavenCacheConfig {
+	return wallhavenCacheConfig{
+		MemoryBytes: 1 << 20,
+		DiskBytes:   1 << 20,
+		Dir:         dir,
+		TTLs: map[wallhavenCacheKind]time.Duration{
+			wallhavenCacheSearch:    time.Minute,
+			wallhavenCacheWallpaper: time.Minute,
+			wallhavenCacheThumbnail: time.Hour,
+		},
+	}
+}
+
+// useTestWallhavenCache installs a fresh memory-only cache for the duration of
+// the test so cached responses do not leak between tests.
+func useTestWallhavenCache(t *testing.T) *wallhavenCache {
+	t.Helper()
+
+	sharedWallhavenCache()
+	orig := wallhavenCacheInstance
+	wallhavenCacheInstance = newWallhavenCache(testWallhavenCacheConfig(""))
+	t.Cleanup(func() { wallhavenCacheInstance = orig })
+	return wallhavenCacheInstance
+}
+
+type countingUpstream struct {
+	*httptest.Server
+	hits   atomic.Int32
+	status atomic.Int32
+}
+
+func newCountingUpstream(t *testing.T, retryAfter string) *countingUpstream {
+	t.Helper()
+
+	u := &countingUpstream{}
+	u.status.Store(http.StatusOK)
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.hits.Add(1)
+		status := int(u.status.Load())
+		if status == http.StatusTooManyRequests && retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		if strings.HasPrefix(r.URL.Path, "/thumb") {
+			w.Header().Set("Content-Type", "image/jpeg")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(u.Close)
+
+	t.Setenv("WALLHAVEN_API_BASE", u.URL)
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+	return u
+}
+
+func TestWallhavenCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Serves fresh entries from memory", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "")
+		cache := newWallhavenCache(testWallhavenCacheConfig(""))
+
+		first, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search?q=a", fetchOptions{}, "")
+		require.NoError(t, err)
+		assert.Equal(t, cacheStatusMiss, first.CacheStatus)
+
+		second, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search?q=a", fetchOptions{}, "")
+		require.NoError(t, err)
+		assert.Equal(t, cacheStatusHit, second.CacheStatus)
+		assert.Equal(t, first.Body, second.Body)
+		assert.Equal(t, "application/json", second.ContentType())
+		assert.EqualValues(t, 1, upstream.hits.Load())
+
+		_, err = cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search?q=a", fetchOptions{}, "other-key")
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, upstream.hits.Load(), "entries are separated per API key")
+	})
+
+	t.Run("Refetches after the TTL", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "")
+		cache := newWallhavenCache(testWallhavenCacheConfig(""))
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		_, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search", fetchOptions{}, "")
+		require.NoError(t, err)
+
+		now = now.Add(2 * time.Minute)
+		resp, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search", fetchOptions{}, "")
+		require.NoError(t, err)
+		assert.Equal(t, cacheStatusMiss, resp.CacheStatus)
+		assert.EqualValues(t, 2, upstream.hits.Load())
+	})
+
+	t.Run("Does not cache errors", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "")
+		upstream.status.Store(http.StatusNotFound)
+		cache := newWallhavenCache(testWallhavenCacheConfig(""))
+
+		for range 2 {
+			resp, err := cache.fetch(ctx, wallhavenCacheWallpaper, upstream.URL+"/w/x", fetchOptions{}, "")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+		assert.EqualValues(t, 2, upstream.hits.Load())
+	})
+
+	t.Run("Backs off after 429", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "120")
+		upstream.status.Store(http.StatusTooManyRequests)
+		cache := newWallhavenCache(testWallhavenCacheConfig(""))
+
+		_, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search?q=a", fetchOptions{}, "")
+		var rateLimitErr *upstreamRateLimitedError
+		require.True(t, errors.As(err, &rateLimitErr))
+		assert.Equal(t, 120, rateLimitErr.retryAfterSeconds())
+
+		_, err = cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search?q=b", fetchOptions{}, "")
+		require.True(t, errors.As(err, &rateLimitErr))
+		assert.EqualValues(t, 1, upstream.hits.Load(), "no requests are sent while backing off")
+	})
+
+	t.Run("Serves stale entries while backing off", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "")
+		cache := newWallhavenCache(testWallhavenCacheConfig(""))
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		_, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search", fetchOptions{}, "")
+		require.NoError(t, err)
+
+		now = now.Add(2 * time.Minute)
+		upstream.status.Store(http.StatusTooManyRequests)
+		resp, err := cache.fetch(ctx, wallhavenCacheSearch, upstream.URL+"/search", fetchOptions{}, "")
+		require.NoError(t, err)
+		assert.Equal(t, cacheStatusStale, resp.CacheStatus)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Persists entries on disk", func(t *testing.T) {
+		upstream := newCountingUpstream(t, "")
+		dir := t.TempDir()
+
+		_, err := newWallhavenCache(testWallhavenCacheConfig(dir)).fetch(ctx, wallhavenCacheWallpaper, upstream.URL+"/w/abc", fetchOptions{}, "")
+		require.NoError(t, err)
+
+		resp, err := newWallhavenCache(testWallhavenCacheConfig(dir)).fetch(ctx, wallhavenCacheWallpaper, upstream.URL+"/w/abc", fetchOptions{}, "")
+		require.NoError(t, err)
+		assert.Equal(t, cacheStatusHit, resp.CacheStatus)
+		assert.Equal(t, `{"data":[]}`, string(resp.Body))
+		assert.EqualValues(t, 1, upstream.hits.Load())
+	})
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := newDiskCache(dir, 200)
+	require.NoError(t, err)
+
+	entry := wallhavenCacheEntry{StatusCode: 200, ContentType: "image/png", Body: []byte(strings.Repeat("x", 60))}
+	keys := []string{hashBytes([]byte("a")), hashBytes([]byte("b")), hashBytes([]byte("c"))}
+	for _, key := range keys {
+		require.NoError(t, disk.Add(key, entry))
+	}
+
+	_, ok := disk.Get(keys[0])
+	assert.False(t, ok, "oldest entry is evicted")
+	assert.NoFileExists(t, disk.path(keys[0]))
+
+	got, ok := disk.Get(keys[2])
+	require.True(t, ok)
+	assert.Equal(t, entry.Body, got.Body)
+	assert.Equal(t, "image/png", got.ContentType)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
+
+func TestHostBackoff(t *testing.T) {
+	backoff := newHostBackoff()
+	now := time.Now()
+
+	assert.Equal(t, initialWallhavenBackoff, backoff.trip("wallhaven.cc", now, 0))
+	assert.Equal(t, 2*initialWallhavenBackoff, backoff.trip("wallhaven.cc", now, 0))
+	assert.Equal(t, maxWallhavenBackoff, backoff.trip("wallhaven.cc", now, time.Hour))
+	assert.Zero(t, backoff.remaining("th.wallhaven.cc", now))
+
+	backoff.reset("wallhaven.cc")
+	assert.Zero(t, backoff.remaining("wallhaven.cc", now))
+}
+
+func TestWallhavenRateLimitResponse(t *testing.T) {
+	upstream := newCountingUpstream(t, "42")
+	upstream.status.Store(http.StatusTooManyRequests)
+	useTestWallhavenCache(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/wallhaven/search", WallhavenSearchHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/wallhaven/search?q=test", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "42", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"retryAfter":42`)
+}
+
+func TestWallhavenThumbnailHandler(t *testing.T) {
+	upstream := newCountingUpstream(t, "")
+	useTestWallhavenCache(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/wallhaven/thumbnail", WallhavenThumbnailHandler)
+
+	for _, status := range []string{cacheStatusMiss, cacheStatusHit} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/wallhaven/thumbnail?url="+upstream.URL+"/thumb/ab.jpg", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		assert.Equal(t, status, w.Header().Get(headerCacheStatus))
+		assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+	}
+	assert.EqualValues(t, 1, upstream.hits.Load())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/wallhaven/thumbnail", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"themesmith/auth"
+	"themesmith/db"
+	"themesmith/model"
+	"themesmith/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxWallhavenKeyLength = 128
+
+var errWallhavenKeyStorageDisabled = errors.New("wallhaven key storage is not configured")
+
+type WallhavenKeyRequest struct {
+	APIKey string `json:"apiKey"`
+}
+
+type WallhavenKeyStatus struct {
+	Configured bool       `json:"configured"`
+	KeyHint    string     `json:"keyHint,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+// wallhavenKeySecret returns the server key used to encrypt stored Wallhaven
+// API keys, read from WALLHAVEN_KEY_SECRET as 32 base64 encoded bytes.
+func wallhavenKeySecret() ([]byte, error) {
+	raw := strings.TrimSpace(os.Getenv("WALLHAVEN_KEY_SECRET"))
+	if raw == "" {
+		return nil, errWallhavenKeyStorageDisabled
+	}
+	return utils.ParseSecretKey(raw)
+}
+
+// wallhavenKeyAssociatedData binds a ciphertext to its owner, so a stored key
+// copied onto another user's row fails to decrypt.
+func wallhavenKeyAssociatedData(userID uint) []byte {
+	return fmt.Appendf(nil, "wallhaven-credential:%d", userID)
+}
+
+func wallhavenKeyHint(apiKey string) string {
+	if len(apiKey) <= 4 {
+		return ""
+	}
+	return apiKey[len(apiKey)-4:]
+}
+
+func wallhavenKeyStatus(credential *model.WallhavenCredential) WallhavenKeyStatus {
+	if credential == nil {
+		return WallhavenKeyStatus{}
+	}
+
+	updatedAt := credential.UpdatedAt
+	return WallhavenKeyStatus{
+		Configured: true,
+		KeyHint:    credential.KeyHint,
+		UpdatedAt:  &updatedAt,
+	}
+}
+
+func findWallhavenCredential(userID uint) (*model.WallhavenCredential, error) {
+	var credential model.WallhavenCredential
+	if err := db.DB.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func saveWallhavenCredential(userID uint, apiKey string) (*model.WallhavenCredential, error) {
+	secret, err := wallhavenKeySecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.EncryptSecret(secret, apiKey, wallhavenKeyAssociatedData(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt wallhaven key: %w", err)
+	}
+
+	credential, err := findWallhavenCredential(userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		credential = &model.WallhavenCredential{UserID: userID}
+	}
+	credential.EncryptedKey = encrypted
+	credential.KeyHint = wallhavenKeyHint(apiKey)
+
+	if err := db.DB.Save(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// loadWallhavenKey returns the decrypted key stored for userID, or an empty
+// string when none is stored.
+func loadWallhavenKey(userID uint) (string, error) {
+	credential, err := findWallhavenCredential(userID)
+	if err != nil || credential == nil {
+		return "", err
+	}
+
+	secret, err := wallhavenKeySecret()
+	if err != nil {
+		return "", err
+	}
+	return utils.DecryptSecret(secret, credential.EncryptedKey, wallhavenKeyAssociatedData(userID))
+}
+
+// wallhavenAPIKey picks the key for a proxied Wallhaven request. An explicit
+// X-API-Key header wins; otherwise an authenticated user's stored key is used.
+func wallhavenAPIKey(c *gin.Context) string {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		return apiKey
+	}
+	if db.DB == nil || c.GetHeader("Authorization") == "" {
+		return ""
+	}
+
+	userID, err := auth.GetUserFromRequest(c)
+	if err != nil {
+		return ""
+	}
+
+	apiKey, err := loadWallhavenKey(userID)
+	if err != nil {
+		log.Printf("failed to load wallhaven key for user %d: %v", userID, err)
+		return ""
+	}
+	return apiKey
+}
+
+// verifyWallhavenKey asks Wallhaven for the account settings, which only
+// succeeds with a valid API key.
+func verifyWallhavenKey(ctx context.Context, apiKey string) (bool, error) {
+	resp, err := safeFetch(ctx, wallhavenBase()+"/settings", fetchOptions{
+		Header: wallhavenHeaders(apiKey),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, nil
+	case http.StatusTooManyRequests:
+		return false, &upstreamRateLimitedError{RetryAfter: max(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), time.Second)}
+	default:
+		return false, &statusError{Status: http.StatusBadGateway, Message: fmt.Sprintf("wallhaven returned status %d", resp.StatusCode)}
+	}
+}
+
+func respondWallhavenKeyError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, errWallhavenKeyStorageDisabled) || errors.Is(err, utils.ErrInvalidSecretKey) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errWallhavenKeyStorageDisabled.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+func GetWallhavenKeyHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	credential, err := findWallhavenCredential(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Wallhaven key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, wallhavenKeyStatus(credential))
+}
+
+func SetWallhavenKeyHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req WallhavenKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	apiKey := strings.TrimSpace(req.APIKey)
+	if apiKey == "" || len(apiKey) > maxWallhavenKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("apiKey must be between 1 and %d characters", maxWallhavenKeyLength)})
+		return
+	}
+
+	credential, err := saveWallhavenCredential(userID, apiKey)
+	if err != nil {
+		respondWallhavenKeyError(c, err, "Failed to save Wallhaven key")
+		return
+	}
+
+	c.JSON(http.StatusOK, wallhavenKeyStatus(credential))
+}
+
+// VerifyWallhavenKeyHandler checks a key against Wallhaven. It tests the key in
+// the request body when given, so a key can be verified before it is saved,
+// and the stored key otherwise.
+func VerifyWallhavenKeyHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req WallhavenKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+			return
+		}
+	}
+
+	apiKey := strings.TrimSpace(req.APIKey)
+	if apiKey == "" {
+		apiKey, err = loadWallhavenKey(userID)
+		if err != nil {
+			respondWallhavenKeyError(c, err, "Failed to load Wallhaven key")
+			return
+		}
+		if apiKey == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No Wallhaven key stored"})
+			return
+		}
+	}
+
+	valid, err := verifyWallhavenKey(c.Request.Context(), apiKey)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": valid})
+}
+
+func DeleteWallhavenKeyHandler(c *gin.Context) {
+	if db.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not available"})
+		return
+	}
+
+	userID, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := db.DB.Where("user_id = ?", userID).Delete(&model.WallhavenCredential{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete Wallhaven key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, wallhavenKeyStatus(nil))
+}
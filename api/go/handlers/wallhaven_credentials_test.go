@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWallhavenKeyHint(t *testing.T) {
+	assert.Equal(t, "wxyz", wallhavenKeyHint("abcdefwxyz"))
+	assert.Equal(t, "", wallhavenKeyHint("abcd"))
+}
+
+func TestVerifyWallhavenKey(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/settings", r.URL.Path)
+		switch r.Header.Get("X-API-Key") {
+		case "good":
+			w.Write([]byte(`{"data":{}}`))
+		case "busy":
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer upstream.Close()
+	t.Setenv("WALLHAVEN_API_BASE", upstream.URL)
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+
+	valid, err := verifyWallhavenKey(context.Background(), "good")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = verifyWallhavenKey(context.Background(), "bad")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	_, err = verifyWallhavenKey(context.Background(), "busy")
+	var rateLimitErr *upstreamRateLimitedError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, 7, rateLimitErr.retryAfterSeconds())
+}
@@ -1,14 +1,29 @@
 package handlers
 
 import (
-	"io"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-const wallhavenBase = "https://wallhaven.cc/api/v1"
+const defaultWallhavenBase = "https://wallhaven.cc/api/v1"
+
+// wallhavenBase returns the Wallhaven API root, overridable through
+// WALLHAVEN_API_BASE so tests can point the proxy at a local server.
+func wallhavenBase() string {
+	if base := strings.TrimSpace(os.Getenv("WALLHAVEN_API_BASE")); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return defaultWallhavenBase
+}
 
 func WallhavenSearchHandler(c *gin.Context) {
 	q := url.Values{}
@@ -18,72 +33,140 @@ func WallhavenSearchHandler(c *gin.Context) {
 		}
 	}
 
-	target := wallhavenBase + "/search?" + q.Encode()
-
-	req, err := http.NewRequest("GET", target, nil)
+	apiKey := wallhavenAPIKey(c)
+	resp, err := sharedWallhavenCache().fetch(c.Request.Context(), wallhavenCacheSearch, wallhavenBase()+"/search?"+q.Encode(), fetchOptions{
+		Header: wallhavenHeaders(apiKey),
+	}, apiKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
+		respondStatusError(c, err)
 		return
 	}
 
-	// Forward API key header if present
-	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
-		req.Header.Set("X-API-Key", apiKey)
+	writeFetchedResponse(c, resp)
+}
+
+func WallhavenGetWallpaperHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id required"})
+		return
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := fetchWallhavenWallpaper(c.Request.Context(), id, wallhavenAPIKey(c))
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to contact wallhaven: " + err.Error()})
+		respondStatusError(c, err)
 		return
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			_ = c.Error(err)
-		}
-	}()
 
-	c.Status(resp.StatusCode)
-	c.Header("Content-Type", resp.Header.Get("Content-Type"))
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		_ = c.Error(err)
-	}
+	writeFetchedResponse(c, resp)
 }
 
-func WallhavenGetWallpaperHandler(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id required"})
+// WallhavenThumbnailHandler proxies search result thumbnails through the
+// cache so repeated browsing does not hit the image host again.
+func WallhavenThumbnailHandler(c *gin.Context) {
+	thumbURL := c.Query("url")
+	if thumbURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url query parameter required"})
 		return
 	}
 
-	target := wallhavenBase + "/w/" + url.PathEscape(id)
-	req, err := http.NewRequest("GET", target, nil)
+	cache := sharedWallhavenCache()
+	resp, err := cache.fetch(c.Request.Context(), wallhavenCacheThumbnail, thumbURL, fetchOptions{
+		ContentTypes: []string{"image/"},
+	}, "")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
+		respondStatusError(c, err)
 		return
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		respondImageHostStatus(c, resp.StatusCode)
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cache.ttl(wallhavenCacheThumbnail).Seconds())))
+	writeFetchedResponse(c, resp)
+}
+
+func writeFetchedResponse(c *gin.Context, resp *fetchedResponse) {
+	if resp.CacheStatus != "" {
+		c.Header(headerCacheStatus, resp.CacheStatus)
+	}
+	c.Data(resp.StatusCode, resp.ContentType(), resp.Body)
+}
+
+func respondImageHostStatus(c *gin.Context, upstreamStatus int) {
+	status := upstreamStatus
+	if status >= http.StatusInternalServerError {
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, gin.H{"error": fmt.Sprintf("image host returned status %d", upstreamStatus)})
+}
+
+func wallhavenHeaders(apiKey string) http.Header {
+	header := http.Header{}
 	// Forward API key header if present
-	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
-		req.Header.Set("X-API-Key", apiKey)
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
 	}
+	return header
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to contact wallhaven: " + err.Error()})
+func fetchWallhavenWallpaper(ctx context.Context, id string, apiKey string) (*fetchedResponse, error) {
+	return sharedWallhavenCache().fetch(ctx, wallhavenCacheWallpaper, wallhavenBase()+"/w/"+url.PathEscape(id), fetchOptions{
+		Header: wallhavenHeaders(apiKey),
+	}, apiKey)
+}
+
+type wallhavenWallpaperData struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	Path       string   `json:"path"`
+	FileType   string   `json:"file_type"`
+	FileSize   int64    `json:"file_size"`
+	DimensionX int      `json:"dimension_x"`
+	DimensionY int      `json:"dimension_y"`
+	Colors     []string `json:"colors"`
+	Thumbs     struct {
+		Large    string `json:"large"`
+		Original string `json:"original"`
+		Small    string `json:"small"`
+	} `json:"thumbs"`
+}
+
+type wallhavenWallpaperResponse struct {
+	Data wallhavenWallpaperData `json:"data"`
+}
+
+type wallhavenSearchResponse struct {
+	Data []wallhavenWallpaperData `json:"data"`
+	Meta struct {
+		CurrentPage int `json:"current_page"`
+		LastPage    int `json:"last_page"`
+		Total       int `json:"total"`
+	} `json:"meta"`
+}
+
+// WallhavenApplyPaletteHandler recolors a Wallhaven wallpaper server-side, so
+// the image never has to make the round trip through the browser. It accepts
+// the same form fields as ApplyPaletteHandler except for the file.
+func WallhavenApplyPaletteHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id required"})
 		return
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			_ = c.Error(err)
-		}
-	}()
 
-	c.Status(resp.StatusCode)
-	c.Header("Content-Type", resp.Header.Get("Content-Type"))
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		_ = c.Error(err)
-	}
+	applyPaletteToWallpaper(c, wallhavenProvider{}, WallpaperRequest{APIKey: wallhavenAPIKey(c)}, id)
+}
+
+// fetchRemoteImage downloads an image from an allowed host, enforcing the
+// encoded size limit and an image content type.
+func fetchRemoteImage(ctx context.Context, imageURL string, limits ImageLimits) (*fetchedResponse, error) {
+	return safeFetch(ctx, imageURL, fetchOptions{
+		ContentTypes: []string{"image/"},
+		Limits:       &limits,
+	})
 }
 
 func WallhavenDownloadHandler(c *gin.Context) {
@@ -93,37 +176,150 @@ func WallhavenDownloadHandler(c *gin.Context) {
 		return
 	}
 
-	u, err := url.Parse(imageURL)
-	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid url"})
+	limits := loadImageLimits()
+	resp, err := fetchRemoteImage(c.Request.Context(), imageURL, limits)
+	if err != nil {
+		respondStatusError(c, err)
 		return
 	}
 
-	req, err := http.NewRequest("GET", imageURL, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
+	if resp.StatusCode != http.StatusOK {
+		respondImageHostStatus(c, resp.StatusCode)
 		return
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch image: " + err.Error()})
+	var limitErr *ImageLimitError
+	if err := limits.checkDecodedSize(resp.Body); errors.As(err, &limitErr) {
+		respondImageLimitError(c, limitErr)
 		return
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			_ = c.Error(err)
-		}
-	}()
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	c.Data(resp.StatusCode, resp.ContentType(), resp.Body)
+}
+
+// wallhavenProvider exposes Wallhaven through the WallpaperProvider interface.
+type wallhavenProvider struct{}
+
+func (wallhavenProvider) Name() string {
+	return "wallhaven"
+}
+
+func (wallhavenProvider) resolveAPIKey(c *gin.Context) string {
+	return wallhavenAPIKey(c)
+}
+
+func (wallhavenProvider) Search(ctx context.Context, req WallpaperRequest, query WallpaperSearchQuery) (*WallpaperSearchResult, error) {
+	q := url.Values{}
+	for key, values := range query.Filters {
+		q[key] = values
+	}
+	if query.Query != "" {
+		q.Set("q", query.Query)
+	}
+	q.Set("page", strconv.Itoa(max(query.Page, 1)))
+
+	resp, err := sharedWallhavenCache().fetch(ctx, wallhavenCacheSearch, wallhavenBase()+"/search?"+q.Encode(), fetchOptions{
+		Header: wallhavenHeaders(req.APIKey),
+	}, req.APIKey)
+	if err != nil {
+		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, wallhavenStatusError(resp.StatusCode)
+	}
+
+	var parsed wallhavenSearchResponse
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "unexpected wallhaven response"}
+	}
+
+	result := &WallpaperSearchResult{
+		Items:    make([]Wallpaper, 0, len(parsed.Data)),
+		Page:     max(parsed.Meta.CurrentPage, 1),
+		LastPage: max(parsed.Meta.LastPage, 1),
+		Total:    parsed.Meta.Total,
+	}
+	for _, data := range parsed.Data {
+		result.Items = append(result.Items, data.normalize())
+	}
+	return result, nil
+}
+
+func (wallhavenProvider) Get(ctx context.Context, req WallpaperRequest, id string) (*Wallpaper, error) {
+	data, err := getWallhavenWallpaper(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	wallpaper := data.normalize()
+	return &wallpaper, nil
+}
+
+func (wallhavenProvider) Download(ctx context.Context, req WallpaperRequest, id string, limits ImageLimits) (*WallpaperImage, error) {
+	data, err := getWallhavenWallpaper(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if data.Path == "" {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "unexpected wallhaven response"}
+	}
+
+	resp, err := fetchRemoteImage(ctx, data.Path, limits)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: fmt.Sprintf("image host returned status %d", resp.StatusCode)}
+	}
+
+	return &WallpaperImage{Data: resp.Body, ContentType: resp.ContentType()}, nil
+}
+
+func getWallhavenWallpaper(ctx context.Context, req WallpaperRequest, id string) (*wallhavenWallpaperData, error) {
+	if id == "" {
+		return nil, &statusError{Status: http.StatusBadRequest, Message: "id required"}
+	}
+
+	resp, err := fetchWallhavenWallpaper(ctx, id, req.APIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &statusError{Status: http.StatusNotFound, Message: "wallpaper not found"}
+	case resp.StatusCode != http.StatusOK:
+		return nil, wallhavenStatusError(resp.StatusCode)
+	}
+
+	var parsed wallhavenWallpaperResponse
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil || parsed.Data.ID == "" {
+		return nil, &statusError{Status: http.StatusBadGateway, Message: "unexpected wallhaven response"}
+	}
+	return &parsed.Data, nil
+}
+
+// wallhavenStatusError passes client errors such as a rejected API key through
+// and reports upstream failures as 502.
+func wallhavenStatusError(upstreamStatus int) error {
+	status := upstreamStatus
+	if status >= http.StatusInternalServerError || status < http.StatusBadRequest {
+		status = http.StatusBadGateway
+	}
+	return &statusError{Status: status, Message: fmt.Sprintf("wallhaven returned status %d", upstreamStatus)}
+}
 
-	c.Status(resp.StatusCode)
-	c.Header("Content-Type", contentType)
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		_ = c.Error(err)
+func (d wallhavenWallpaperData) normalize() Wallpaper {
+	return Wallpaper{
+		ID:           d.ID,
+		Provider:     "wallhaven",
+		Width:        d.DimensionX,
+		Height:       d.DimensionY,
+		FileType:     d.FileType,
+		FileSize:     d.FileSize,
+		ThumbnailURL: d.Thumbs.Original,
+		DownloadURL:  wallpaperDownloadPath("wallhaven", d.ID),
+		SourceURL:    d.URL,
+		Colors:       d.Colors,
 	}
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"image"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const localWallpapersPerPage = 24
+
+var localWallpaperExtensions = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// localDirectoryProvider serves the images directly inside Root. Wallpaper IDs
+// are file names; subdirectories are not listed.
+type localDirectoryProvider struct {
+	Root string
+}
+
+func (localDirectoryProvider) Name() string {
+	return "local"
+}
+
+// Search matches the query case-insensitively against file names and pages
+// through the results in name order.
+func (p localDirectoryProvider) Search(_ context.Context, _ WallpaperRequest, query WallpaperSearchQuery) (*WallpaperSearchResult, error) {
+	root, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	entries, err := fs.ReadDir(root.FS(), ".")
+	if err != nil {
+		return nil, &statusError{Status: http.StatusInternalServerError, Message: "failed to list local wallpapers"}
+	}
+
+	needle := strings.ToLower(query.Query)
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !isLocalWallpaperName(name) {
+			continue
+		}
+		if needle != "" && !strings.Contains(strings.ToLower(name), needle) {
+			continue
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	lastPage := max((len(names)+localWallpapersPerPage-1)/localWallpapersPerPage, 1)
+	page := min(max(query.Page, 1), lastPage)
+	start := min((page-1)*localWallpapersPerPage, len(names))
+	end := min(start+localWallpapersPerPage, len(names))
+
+	result := &WallpaperSearchResult{
+		Items:    make([]Wallpaper, 0, end-start),
+		Page:     page,
+		LastPage: lastPage,
+		Total:    len(names),
+	}
+	for _, name := range names[start:end] {
+		wallpaper, err := p.describe(root, name)
+		if err != nil {
+			continue
+		}
+		result.Items = append(result.Items, *wallpaper)
+	}
+	return result, nil
+}
+
+func (p localDirectoryProvider) Get(_ context.Context, _ WallpaperRequest, id string) (*Wallpaper, error) {
+	if !isLocalWallpaperName(id) {
+		return nil, errLocalWallpaperNotFound()
+	}
+
+	root, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	return p.describe(root, id)
+}
+
+func (p localDirectoryProvider) Download(_ context.Context, _ WallpaperRequest, id string, limits ImageLimits) (*WallpaperImage, error) {
+	if !isLocalWallpaperName(id) {
+		return nil, errLocalWallpaperNotFound()
+	}
+
+	root, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	file, err := root.Open(id)
+	if err != nil {
+		return nil, errLocalWallpaperNotFound()
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, errLocalWallpaperNotFound()
+	}
+	if limitErr := limits.checkEncodedSize(info.Size()); limitErr != nil {
+		return nil, limitErr
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, limits.MaxEncodedBytes+1))
+	if err != nil {
+		return nil, &statusError{Status: http.StatusInternalServerError, Message: "failed to read local wallpaper"}
+	}
+	if limitErr := limits.checkEncodedSize(int64(len(data))); limitErr != nil {
+		return nil, limitErr
+	}
+
+	return &WallpaperImage{Data: data, ContentType: localWallpaperContentType(id)}, nil
+}
+
+// open confines all file access to Root, so IDs cannot escape it through
+// symlinks or relative paths.
+func (p localDirectoryProvider) open() (*os.Root, error) {
+	root, err := os.OpenRoot(p.Root)
+	if err != nil {
+		return nil, &statusError{Status: http.StatusServiceUnavailable, Message: "local wallpaper directory is not available"}
+	}
+	return root, nil
+}
+
+func (p localDirectoryProvider) describe(root *os.Root, name string) (*Wallpaper, error) {
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, errLocalWallpaperNotFound()
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, errLocalWallpaperNotFound()
+	}
+
+	downloadURL := wallpaperDownloadPath(p.Name(), name)
+	wallpaper := &Wallpaper{
+		ID:           name,
+		Provider:     p.Name(),
+		Title:        strings.TrimSuffix(name, filepath.Ext(name)),
+		FileType:     localWallpaperContentType(name),
+		FileSize:     info.Size(),
+		ThumbnailURL: downloadURL,
+		DownloadURL:  downloadURL,
+	}
+
+	// Only the header is decoded; files that fail to parse are still listed.
+	if cfg, _, err := image.DecodeConfig(file); err == nil {
+		wallpaper.Width = cfg.Width
+		wallpaper.Height = cfg.Height
+	}
+
+	return wallpaper, nil
+}
+
+func isLocalWallpaperName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	_, ok := localWallpaperExtensions[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+func localWallpaperContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if contentType, ok := localWallpaperExtensions[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func errLocalWallpaperNotFound() error {
+	return &statusError{Status: http.StatusNotFound, Message: "wallpaper not found"}
+}
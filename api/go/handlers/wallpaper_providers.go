@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Wallpaper is the provider-independent description of a wallpaper. URLs
+// starting with "/" are relative to this API.
+type Wallpaper struct {
+	ID           string   `json:"id"`
+	Provider     string   `json:"provider"`
+	Title        string   `json:"title,omitempty"`
+	Width        int      `json:"width,omitempty"`
+	Height       int      `json:"height,omitempty"`
+	FileType     string   `json:"fileType,omitempty"`
+	FileSize     int64    `json:"fileSize,omitempty"`
+	ThumbnailURL string   `json:"thumbnailUrl,omitempty"`
+	DownloadURL  string   `json:"downloadUrl"`
+	SourceURL    string   `json:"sourceUrl,omitempty"`
+	Colors       []string `json:"colors,omitempty"`
+}
+
+type WallpaperSearchQuery struct {
+	Query string
+	Page  int
+	// Filters carries the remaining query parameters. Providers pick the
+	// ones they understand and ignore the rest.
+	Filters url.Values
+}
+
+type WallpaperSearchResult struct {
+	Items    []Wallpaper `json:"items"`
+	Page     int         `json:"page"`
+	LastPage int         `json:"lastPage"`
+	Total    int         `json:"total"`
+}
+
+// WallpaperRequest carries per-request credentials for providers that need
+// them.
+type WallpaperRequest struct {
+	APIKey string
+}
+
+type WallpaperImage struct {
+	Data        []byte
+	ContentType string
+}
+
+// WallpaperProvider is a source of wallpapers. Errors should be *statusError
+// or *ImageLimitError values so handlers can report them as is; a missing
+// wallpaper is a 404.
+type WallpaperProvider interface {
+	Name() string
+	Search(ctx context.Context, req WallpaperRequest, query WallpaperSearchQuery) (*WallpaperSearchResult, error)
+	Get(ctx context.Context, req WallpaperRequest, id string) (*Wallpaper, error)
+	Download(ctx context.Context, req WallpaperRequest, id string, limits ImageLimits) (*WallpaperImage, error)
+}
+
+// wallpaperKeyResolver is implemented by providers that can supply an API key
+// beyond the X-API-Key header, such as one stored for the signed-in user.
+type wallpaperKeyResolver interface {
+	resolveAPIKey(c *gin.Context) string
+}
+
+var (
+	wallpaperProvidersMu sync.RWMutex
+	wallpaperProviders   = map[string]WallpaperProvider{}
+)
+
+// RegisterWallpaperProvider adds a provider, or replaces the one with the same
+// name, making it available under /wallpapers/:provider.
+func RegisterWallpaperProvider(provider WallpaperProvider) {
+	wallpaperProvidersMu.Lock()
+	defer wallpaperProvidersMu.Unlock()
+	wallpaperProviders[provider.Name()] = provider
+}
+
+// builtinWallpaperProviders returns Wallhaven and, when WALLPAPER_LOCAL_DIR is
+// set, the local directory provider.
+func builtinWallpaperProviders() []WallpaperProvider {
+	providers := []WallpaperProvider{wallhavenProvider{}}
+	if dir := strings.TrimSpace(os.Getenv("WALLPAPER_LOCAL_DIR")); dir != "" {
+		providers = append(providers, localDirectoryProvider{Root: dir})
+	}
+	return providers
+}
+
+func findWallpaperProvider(name string) (WallpaperProvider, bool) {
+	wallpaperProvidersMu.RLock()
+	provider, ok := wallpaperProviders[name]
+	wallpaperProvidersMu.RUnlock()
+	if ok {
+		return provider, true
+	}
+
+	for _, provider := range builtinWallpaperProviders() {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+func wallpaperProviderNames() []string {
+	names := map[string]struct{}{}
+	for _, provider := range builtinWallpaperProviders() {
+		names[provider.Name()] = struct{}{}
+	}
+
+	wallpaperProvidersMu.RLock()
+	for name := range wallpaperProviders {
+		names[name] = struct{}{}
+	}
+	wallpaperProvidersMu.RUnlock()
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
+
+func wallpaperProviderFromRequest(c *gin.Context) (WallpaperProvider, WallpaperRequest, bool) {
+	provider, ok := findWallpaperProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown wallpaper provider"})
+		return nil, WallpaperRequest{}, false
+	}
+
+	req := WallpaperRequest{APIKey: c.GetHeader("X-API-Key")}
+	if resolver, ok := provider.(wallpaperKeyResolver); ok {
+		req.APIKey = resolver.resolveAPIKey(c)
+	}
+	return provider, req, true
+}
+
+func wallpaperDownloadPath(provider string, id string) string {
+	return "/wallpapers/" + url.PathEscape(provider) + "/" + url.PathEscape(id) + "/download"
+}
+
+func ListWallpaperProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": wallpaperProviderNames()})
+}
+
+func WallpaperSearchHandler(c *gin.Context) {
+	provider, req, ok := wallpaperProviderFromRequest(c)
+	if !ok {
+		return
+	}
+
+	filters := url.Values{}
+	for key, values := range c.Request.URL.Query() {
+		if key != "q" && key != "page" {
+			filters[key] = values
+		}
+	}
+
+	page := 1
+	if raw := c.Query("page"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+			return
+		}
+		page = v
+	}
+
+	result, err := provider.Search(c.Request.Context(), req, WallpaperSearchQuery{
+		Query:   strings.TrimSpace(c.Query("q")),
+		Page:    page,
+		Filters: filters,
+	})
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func WallpaperGetHandler(c *gin.Context) {
+	provider, req, ok := wallpaperProviderFromRequest(c)
+	if !ok {
+		return
+	}
+
+	wallpaper, err := provider.Get(c.Request.Context(), req, c.Param("id"))
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wallpaper)
+}
+
+func WallpaperDownloadHandler(c *gin.Context) {
+	provider, req, ok := wallpaperProviderFromRequest(c)
+	if !ok {
+		return
+	}
+
+	limits := loadImageLimits()
+	wallpaperImage, err := provider.Download(c.Request.Context(), req, c.Param("id"), limits)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	var limitErr *ImageLimitError
+	if err := limits.checkDecodedSize(wallpaperImage.Data); errors.As(err, &limitErr) {
+		respondImageLimitError(c, limitErr)
+		return
+	}
+
+	c.Data(http.StatusOK, wallpaperImage.ContentType, wallpaperImage.Data)
+}
+
+// WallpaperApplyPaletteHandler recolors a wallpaper from any provider. It
+// accepts the same form fields as ApplyPaletteHandler except for the file.
+func WallpaperApplyPaletteHandler(c *gin.Context) {
+	provider, req, ok := wallpaperProviderFromRequest(c)
+	if !ok {
+		return
+	}
+
+	applyPaletteToWallpaper(c, provider, req, c.Param("id"))
+}
+
+func applyPaletteToWallpaper(c *gin.Context, provider WallpaperProvider, req WallpaperRequest, id string) {
+	params, err := parseApplyPaletteParams(c)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	limits := loadImageLimits()
+	wallpaperImage, err := provider.Download(c.Request.Context(), req, id, limits)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	serveRecolor(c, wallpaperImage.Data, storeSourceImage(wallpaperImage.Data), params, limits)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupLocalWallpapers(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "forest.png"), encodeTestPNG(t, createTestImage(16, 10)), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ocean.png"), encodeTestPNG(t, createTestImage(4, 4)), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(dir), "outside.png"), []byte("secret"), 0o644))
+	t.Setenv("WALLPAPER_LOCAL_DIR", dir)
+	return dir
+}
+
+func TestWallpaperProviderRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupLocalWallpapers(t)
+	router := NewRouter()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	t.Run("Lists providers", func(t *testing.T) {
+		w := get("/wallpapers/providers")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"providers":["local","wallhaven"]}`, w.Body.String())
+	})
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/wallpapers/nope/search").Code)
+	})
+
+	t.Run("Local search", func(t *testing.T) {
+		w := get("/wallpapers/local/search")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result WallpaperSearchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, 2, result.Total)
+		require.Len(t, result.Items, 2)
+		assert.Equal(t, "forest.png", result.Items[0].ID)
+		assert.Equal(t, "local", result.Items[0].Provider)
+		assert.Equal(t, 16, result.Items[0].Width)
+		assert.Equal(t, 10, result.Items[0].Height)
+		assert.Equal(t, "/wallpapers/local/forest.png/download", result.Items[0].DownloadURL)
+
+		w = get("/wallpapers/local/search?q=OCEAN")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.Len(t, result.Items, 1)
+		assert.Equal(t, "ocean.png", result.Items[0].ID)
+	})
+
+	t.Run("Local get and download", func(t *testing.T) {
+		w := get("/wallpapers/local/ocean.png")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"ocean"`)
+
+		w = get("/wallpapers/local/ocean.png/download")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		cfg, err := png.DecodeConfig(w.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 4, cfg.Width)
+	})
+
+	t.Run("Local provider stays inside its directory", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/wallpapers/local/notes.txt").Code)
+		assert.Equal(t, http.StatusNotFound, get("/wallpapers/local/..%2Foutside.png/download").Code)
+		assert.Equal(t, http.StatusNotFound, get("/wallpapers/local/missing.png").Code)
+	})
+
+	t.Run("Local apply palette", func(t *testing.T) {
+		req := newApplyPaletteRequest(t, "/wallpapers/local/forest.png/apply-palette", nil, map[string]string{
+			"palette": `["#FF0000","#00FF00"]`,
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	})
+}
+
+func TestWallhavenProviderNormalizesResults(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			assert.Equal(t, "cats", r.URL.Query().Get("q"))
+			assert.Equal(t, "2", r.URL.Query().Get("page"))
+			assert.Equal(t, "100", r.URL.Query().Get("purity"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"id":"abc123","url":"https://wallhaven.cc/w/abc123","path":"https://w.wallhaven.cc/full/ab/wallhaven-abc123.png","file_type":"image/png","file_size":1024,"dimension_x":1920,"dimension_y":1080,"colors":["#000000"],"thumbs":{"original":"https://th.wallhaven.cc/orig/ab/abc123.jpg"}}],"meta":{"current_page":2,"last_page":5,"total":120}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	t.Setenv("WALLHAVEN_API_BASE", upstream.URL)
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+	useTestWallhavenCache(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/wallpapers/:provider/search", WallpaperSearchHandler)
+	router.GET("/wallpapers/:provider/:id", WallpaperGetHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/wallpapers/wallhaven/search?q=cats&page=2&purity=100", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result WallpaperSearchResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Page)
+	assert.Equal(t, 5, result.LastPage)
+	assert.Equal(t, 120, result.Total)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, Wallpaper{
+		ID:           "abc123",
+		Provider:     "wallhaven",
+		Width:        1920,
+		Height:       1080,
+		FileType:     "image/png",
+		FileSize:     1024,
+		ThumbnailURL: "https://th.wallhaven.cc/orig/ab/abc123.jpg",
+		DownloadURL:  "/wallpapers/wallhaven/abc123/download",
+		SourceURL:    "https://wallhaven.cc/w/abc123",
+		Colors:       []string{"#000000"},
+	}, result.Items[0])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/wallpapers/wallhaven/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/wallpapers/wallhaven/search?page=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -17,19 +17,28 @@ type User struct {
 	UpdatedAt    time.Time `json:"updatedAt"`
 	Palettes     []Palette `json:"palettes" gorm:"foreignKey:UserID"`
 	Themes       []Theme   `json:"themes" gorm:"foreignKey:UserID"`
+	// ThemeRevisionLimit caps how many revisions are kept per theme; nil means
+	// the server default.
+	ThemeRevisionLimit *int `json:"themeRevisionLimit"`
 }
 
 type Palette struct {
-	ID        uint       `json:"id" gorm:"primaryKey"`
-	UserID    *uint      `json:"userId" gorm:"index"`
-	User      *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Name      string     `json:"name" gorm:"size:255;not null"`
-	JsonData  string     `json:"jsonData" gorm:"type:jsonb;not null"`
-	IsSystem  bool       `json:"isSystem" gorm:"default:false"`
-	IsShared  bool       `json:"isShared" gorm:"default:false;index"`
-	SharedAt  *time.Time `json:"sharedAt" gorm:"index"`
-	CreatedAt time.Time  `json:"createdAt"`
-	UpdatedAt time.Time  `json:"updatedAt"`
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	UserID   *uint      `json:"userId" gorm:"index"`
+	User     *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name     string     `json:"name" gorm:"size:255;not null"`
+	JsonData string     `json:"jsonData" gorm:"type:jsonb;not null"`
+	IsSystem bool       `json:"isSystem" gorm:"default:false"`
+	IsShared bool       `json:"isShared" gorm:"default:false;index"`
+	SharedAt *time.Time `json:"sharedAt" gorm:"index"`
+	Version  int        `json:"version" gorm:"not null;default:1"`
+	// ForkedFromID and ForkedFromUserID record the shared palette this one
+	// was forked from and its owner; ForkCount counts forks of this palette.
+	ForkedFromID     *uint     `json:"forkedFromId" gorm:"index"`
+	ForkedFromUserID *uint     `json:"forkedFromUserId" gorm:"index"`
+	ForkCount        int       `json:"forkCount" gorm:"not null;default:0"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
 }
 
 type Theme struct {
@@ -42,8 +51,29 @@ type Theme struct {
 	JsonData   string     `json:"jsonData" gorm:"type:jsonb;not null"`
 	IsShared   bool       `json:"isShared" gorm:"default:false;index"`
 	SharedAt   *time.Time `json:"sharedAt" gorm:"index"`
-	CreatedAt  time.Time  `json:"createdAt"`
-	UpdatedAt  time.Time  `json:"updatedAt"`
+	Version    int        `json:"version" gorm:"not null;default:1"`
+	// ForkedFromID and ForkedFromUserID record the shared theme this one was
+	// forked from and its owner; ForkCount counts forks of this theme.
+	ForkedFromID     *uint     `json:"forkedFromId" gorm:"index"`
+	ForkedFromUserID *uint     `json:"forkedFromUserId" gorm:"index"`
+	ForkCount        int       `json:"forkCount" gorm:"not null;default:0"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// ThemeRevision is a snapshot of a theme taken before it was overwritten.
+// Revision numbers increase per theme.
+type ThemeRevision struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Theme      *Theme    `json:"-" gorm:"foreignKey:ThemeID;constraint:OnDelete:CASCADE"`
+	ThemeID    uint      `json:"themeId" gorm:"not null;uniqueIndex:idx_theme_revision"`
+	UserID     uint      `json:"userId" gorm:"index"`
+	Revision   int       `json:"revision" gorm:"not null;uniqueIndex:idx_theme_revision"`
+	Name       string    `json:"name" gorm:"size:255;not null"`
+	EditorType string    `json:"editorType" gorm:"size:20"`
+	Signature  string    `json:"signature" gorm:"size:128"`
+	JsonData   string    `json:"jsonData" gorm:"type:jsonb;not null"`
+	CreatedAt  time.Time `json:"createdAt"`
 }
 
 type UserPreferences struct {
@@ -51,6 +81,19 @@ type UserPreferences struct {
 	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	UserID    uint      `json:"userId" gorm:"uniqueIndex"`
 	JsonData  string    `json:"jsonData" gorm:"type:jsonb;not null"`
+	Version   int       `json:"version" gorm:"not null;default:1"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// WallhavenCredential holds a user's Wallhaven API key, encrypted with the
+// server key from WALLHAVEN_KEY_SECRET.
+type WallhavenCredential struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	User         *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	UserID       uint      `json:"userId" gorm:"uniqueIndex"`
+	EncryptedKey string    `json:"-" gorm:"type:text;not null"`
+	KeyHint      string    `json:"keyHint" gorm:"size:8"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
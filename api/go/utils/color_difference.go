@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"image/color"
+	"math"
+)
+
+type Lab struct {
+	L float64
+	A float64
+	B float64
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labPivot(t float64) float64 {
+	const epsilon = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+	if t > epsilon {
+		return math.Cbrt(t)
+	}
+	return (kappa*t + 16) / 116
+}
+
+// RGBToLab converts an sRGB color to CIELAB using the D65 reference white.
+func RGBToLab(c color.RGBA) Lab {
+	r := srgbToLinear(c.R)
+	g := srgbToLinear(c.G)
+	b := srgbToLinear(c.B)
+
+	x := (r*0.4124564 + g*0.3575761 + b*0.1804375) / 0.95047
+	y := r*0.2126729 + g*0.7151522 + b*0.0721750
+	z := (r*0.0193339 + g*0.1191920 + b*0.9503041) / 1.08883
+
+	fx := labPivot(x)
+	fy := labPivot(y)
+	fz := labPivot(z)
+
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+// DeltaE2000 returns the CIEDE2000 color difference between two CIELAB colors.
+func DeltaE2000(lab1, lab2 Lab) float64 {
+	const rad = math.Pi / 180
+
+	c1 := math.Hypot(lab1.A, lab1.B)
+	c2 := math.Hypot(lab2.A, lab2.B)
+	cMean := (c1 + c2) / 2
+	cMean7 := math.Pow(cMean, 7)
+	g := 0.5 * (1 - math.Sqrt(cMean7/(cMean7+math.Pow(25, 7))))
+
+	a1 := lab1.A * (1 + g)
+	a2 := lab2.A * (1 + g)
+	c1p := math.Hypot(a1, lab1.B)
+	c2p := math.Hypot(a2, lab2.B)
+
+	h1p := hueAngle(lab1.B, a1)
+	h2p := hueAngle(lab2.B, a2)
+
+	dL := lab2.L - lab1.L
+	dC := c2p - c1p
+
+	var dh float64
+	switch {
+	case c1p*c2p == 0:
+		dh = 0
+	case math.Abs(h2p-h1p) <= 180:
+		dh = h2p - h1p
+	case h2p-h1p > 180:
+		dh = h2p - h1p - 360
+	default:
+		dh = h2p - h1p + 360
+	}
+	dH := 2 * math.Sqrt(c1p*c2p) * math.Sin(dh/2*rad)
+
+	lMean := (lab1.L + lab2.L) / 2
+	cpMean := (c1p + c2p) / 2
+
+	var hMean float64
+	switch {
+	case c1p*c2p == 0:
+		hMean = h1p + h2p
+	case math.Abs(h1p-h2p) <= 180:
+		hMean = (h1p + h2p) / 2
+	case h1p+h2p < 360:
+		hMean = (h1p + h2p + 360) / 2
+	default:
+		hMean = (h1p + h2p - 360) / 2
+	}
+
+	t := 1 -
+		0.17*math.Cos((hMean-30)*rad) +
+		0.24*math.Cos(2*hMean*rad) +
+		0.32*math.Cos((3*hMean+6)*rad) -
+		0.20*math.Cos((4*hMean-63)*rad)
+
+	dTheta := 30 * math.Exp(-math.Pow((hMean-275)/25, 2))
+	cpMean7 := math.Pow(cpMean, 7)
+	rc := 2 * math.Sqrt(cpMean7/(cpMean7+math.Pow(25, 7)))
+	lMeanSq := (lMean - 50) * (lMean - 50)
+	sl := 1 + (0.015*lMeanSq)/math.Sqrt(20+lMeanSq)
+	sc := 1 + 0.045*cpMean
+	sh := 1 + 0.015*cpMean*t
+	rt := -math.Sin(2*dTheta*rad) * rc
+
+	lTerm := dL / sl
+	cTerm := dC / sc
+	hTerm := dH / sh
+
+	return math.Sqrt(lTerm*lTerm + cTerm*cTerm + hTerm*hTerm + rt*cTerm*hTerm)
+}
+
+func hueAngle(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func NearestPaletteIndex(c color.RGBA, paletteRGBAs []color.RGBA) int {
+	best := -1
+	bestDistance := math.MaxFloat64
+	for i, p := range paletteRGBAs {
+		d := colorDistanceSquared(c, p)
+		if d < bestDistance {
+			bestDistance = d
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaE2000(t *testing.T) {
+	// Reference pairs from Sharma, Wu and Dalal, "The CIEDE2000 Color-Difference Formula".
+	tests := []struct {
+		name     string
+		lab1     Lab
+		lab2     Lab
+		expected float64
+	}{
+		{"Pair 1", Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}, 2.0425},
+		{"Pair 7", Lab{50, 0, 0}, Lab{50, -1, 2}, 2.3669},
+		{"Pair 17", Lab{50, 2.5, 0}, Lab{73, 25, -18}, 27.1492},
+		{"Pair 25", Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{"Pair 34", Lab{22.7233, 20.0904, -46.694}, Lab{23.0331, 14.973, -42.5619}, 2.0373},
+		{"Identical", Lab{42, 10, -10}, Lab{42, 10, -10}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, DeltaE2000(tt.lab1, tt.lab2), 0.0001)
+			assert.InDelta(t, tt.expected, DeltaE2000(tt.lab2, tt.lab1), 0.0001)
+		})
+	}
+}
+
+func TestRGBToLab(t *testing.T) {
+	white := RGBToLab(color.RGBA{255, 255, 255, 255})
+	assert.InDelta(t, 100, white.L, 0.01)
+	assert.InDelta(t, 0, white.A, 0.01)
+	assert.InDelta(t, 0, white.B, 0.01)
+
+	black := RGBToLab(color.RGBA{0, 0, 0, 255})
+	assert.InDelta(t, 0, black.L, 0.01)
+
+	red := RGBToLab(color.RGBA{255, 0, 0, 255})
+	assert.InDelta(t, 53.24, red.L, 0.05)
+	assert.InDelta(t, 80.09, red.A, 0.05)
+	assert.InDelta(t, 67.20, red.B, 0.05)
+}
+
+func TestNearestPaletteIndex(t *testing.T) {
+	palette := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+
+	assert.Equal(t, 0, NearestPaletteIndex(color.RGBA{200, 30, 30, 255}, palette))
+	assert.Equal(t, 2, NearestPaletteIndex(color.RGBA{10, 20, 240, 255}, palette))
+	assert.Equal(t, -1, NearestPaletteIndex(color.RGBA{10, 20, 240, 255}, nil))
+}
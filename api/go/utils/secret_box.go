@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const secretBoxPrefix = "v1:"
+
+var ErrInvalidSecretKey = errors.New("secret key must be 32 bytes, base64 encoded")
+
+// ParseSecretKey decodes a base64 encoded AES-256 key as found in environment
+// variables. Both standard and URL-safe alphabets are accepted.
+func ParseSecretKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(encoded); err == nil && len(key) == 32 {
+			return key, nil
+		}
+	}
+	return nil, ErrInvalidSecretKey
+}
+
+// EncryptSecret seals plaintext with AES-256-GCM. associatedData is
+// authenticated but not stored, so the same value must be passed to
+// DecryptSecret; callers use it to bind a ciphertext to its owner.
+func EncryptSecret(key []byte, plaintext string, associatedData []byte) (string, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), associatedData)
+	return secretBoxPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptSecret(key []byte, ciphertext string, associatedData []byte) (string, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, ok := strings.CutPrefix(ciphertext, secretBoxPrefix)
+	if !ok {
+		return "", errors.New("unsupported secret format")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("secret is truncated")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], associatedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newSecretGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidSecretKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
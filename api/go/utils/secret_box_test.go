@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecretKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xAB}, 32)
+
+	key, err := ParseSecretKey(base64.StdEncoding.EncodeToString(raw))
+	require.NoError(t, err)
+	assert.Equal(t, raw, key)
+
+	key, err = ParseSecretKey(" " + base64.RawURLEncoding.EncodeToString(raw) + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, raw, key)
+
+	_, err = ParseSecretKey(base64.StdEncoding.EncodeToString(raw[:16]))
+	assert.ErrorIs(t, err, ErrInvalidSecretKey)
+
+	_, err = ParseSecretKey("not base64!")
+	assert.ErrorIs(t, err, ErrInvalidSecretKey)
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+
+	sealed, err := EncryptSecret(key, "wallhaven-api-key", []byte("user:1"))
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "wallhaven-api-key")
+
+	again, err := EncryptSecret(key, "wallhaven-api-key", []byte("user:1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "each encryption uses a fresh nonce")
+
+	plaintext, err := DecryptSecret(key, sealed, []byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "wallhaven-api-key", plaintext)
+
+	_, err = DecryptSecret(key, sealed, []byte("user:2"))
+	assert.Error(t, err, "associated data must match")
+
+	_, err = DecryptSecret(bytes.Repeat([]byte{0x02}, 32), sealed, []byte("user:1"))
+	assert.Error(t, err, "wrong key")
+
+	_, err = DecryptSecret(key, "v1:AAAA", []byte("user:1"))
+	assert.Error(t, err, "truncated")
+
+	_, err = EncryptSecret(key[:16], "x", nil)
+	assert.ErrorIs(t, err, ErrInvalidSecretKey)
+}
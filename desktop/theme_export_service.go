@@ -6,13 +6,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"unicode"
 )
 
 type ThemeExportService struct{}
 
+// jetbrainsProductDirectory matches per-IDE config directories such as
+// GoLand2024.3 or IntelliJIdea2025.1.
+var jetbrainsProductDirectory = regexp.MustCompile(`^[A-Za-z]+[0-9]{4}\.[0-9]+$`)
+
+// emacsDeftheme captures the theme symbol of a generated <name>-theme.el;
+// Emacs only finds the theme when the file is named after it.
+var emacsDeftheme = regexp.MustCompile(`(?m)^\(deftheme ([a-z0-9][a-z0-9-]*)[\s)]`)
+
 type vscodePackageJSON struct {
 	Name        string                       `json:"name"`
 	DisplayName string                       `json:"displayName"`
@@ -47,6 +57,29 @@ func (s *ThemeExportService) SaveThemeToEditorTarget(editorType string, themeNam
 		return saveThemeToVSCode(themeName, themeJSON)
 	case "zed":
 		return saveThemeToZed(themeName, themeJSON)
+	case "jetbrains":
+		return saveThemeToJetBrains(themeName, themeJSON)
+	case "neovim":
+		return saveThemeFile("Neovim", resolveNeovimColorsDirectory, themeName, ".lua", themeJSON)
+	case "vim":
+		return saveThemeFile("Vim", resolveVimColorsDirectory, themeName, ".vim", themeJSON)
+	case "helix":
+		return saveThemeFile("Helix", resolveHelixThemeDirectory, themeName, ".toml", themeJSON)
+	case "sublime":
+		return saveThemeFile("Sublime Text", resolveSublimeUserPackageDirectory, themeName, ".sublime-color-scheme", themeJSON)
+	case "emacs":
+		return saveThemeToEmacs(themeJSON)
+	case "kde":
+		return saveThemeFile("KDE", resolveKDEColorSchemesDirectory, themeName, ".colors", themeJSON)
+	case "gtk":
+		return saveGTKStylesheet(themeJSON)
+	case "xresources":
+		return saveXresources(themeJSON)
+	case "base16", "base24":
+		system := strings.ToLower(strings.TrimSpace(editorType))
+		return saveThemeFile(system, func() (string, error) { return resolveTintedSchemesDirectory(system) }, themeName, ".yaml", themeJSON)
+	case "pywal":
+		return savePywalColorscheme(themeName, themeJSON)
 	default:
 		return "", fmt.Errorf("unsupported editor type: %s", editorType)
 	}
@@ -129,6 +162,398 @@ func resolveZedThemeDirectory() (string, error) {
 	}
 }
 
+// saveThemeToJetBrains installs an .icls editor color scheme into the colors
+// directory of every JetBrains IDE configuration found, returning the written
+// paths.
+func saveThemeToJetBrains(themeName string, schemeXML string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(string(trimUTF8BOM([]byte(schemeXML)))), "<scheme") {
+		return "", errors.New("JetBrains target expects an .icls color scheme")
+	}
+
+	resolvedThemeName := sanitizeThemeName(themeName)
+	if resolvedThemeName == "" {
+		resolvedThemeName = "generated-theme"
+	}
+
+	configDirectory, err := resolveJetBrainsConfigDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(configDirectory)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read JetBrains config directory: %w", err)
+	}
+
+	var products []string
+	for _, entry := range entries {
+		if entry.IsDir() && jetbrainsProductDirectory.MatchString(entry.Name()) {
+			products = append(products, entry.Name())
+		}
+	}
+	if len(products) == 0 {
+		return "", fmt.Errorf("no JetBrains IDE configuration found in %s", configDirectory)
+	}
+	sort.Strings(products)
+
+	written := make([]string, 0, len(products))
+	for _, product := range products {
+		colorsDirectory := filepath.Join(configDirectory, product, "colors")
+		if err := os.MkdirAll(colorsDirectory, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create JetBrains colors directory: %w", err)
+		}
+
+		filePath := filepath.Join(colorsDirectory, resolvedThemeName+".icls")
+		if err := os.WriteFile(filePath, []byte(schemeXML), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write JetBrains color scheme: %w", err)
+		}
+		written = append(written, filePath)
+	}
+
+	return strings.Join(written, "\n"), nil
+}
+
+func resolveJetBrainsConfigDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if appData, ok := os.LookupEnv("APPDATA"); ok && strings.TrimSpace(appData) != "" {
+			return filepath.Join(appData, "JetBrains"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "JetBrains"), nil
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "JetBrains"), nil
+	case "linux":
+		if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && strings.TrimSpace(xdgConfigHome) != "" {
+			return filepath.Join(xdgConfigHome, "JetBrains"), nil
+		}
+		return filepath.Join(home, ".config", "JetBrains"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for JetBrains target: %s", runtime.GOOS)
+	}
+}
+
+// saveThemeFile writes pre-rendered theme content into the directory returned
+// by resolveDirectory, as <sanitized theme name><extension>. It is shared by
+// every target whose theme is a single file.
+func saveThemeFile(editorName string, resolveDirectory func() (string, error), themeName string, extension string, content string) (string, error) {
+	resolvedThemeName := sanitizeThemeName(themeName)
+	if resolvedThemeName == "" {
+		resolvedThemeName = "generated-theme"
+	}
+
+	targetDirectory, err := resolveDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(targetDirectory, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s theme directory: %w", editorName, err)
+	}
+
+	filePath := filepath.Join(targetDirectory, resolvedThemeName+extension)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s theme file: %w", editorName, err)
+	}
+
+	return filePath, nil
+}
+
+func resolveNeovimColorsDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if localAppData, ok := os.LookupEnv("LOCALAPPDATA"); ok && strings.TrimSpace(localAppData) != "" {
+			return filepath.Join(localAppData, "nvim", "colors"), nil
+		}
+		return filepath.Join(home, "AppData", "Local", "nvim", "colors"), nil
+	case "darwin", "linux":
+		if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && strings.TrimSpace(xdgConfigHome) != "" {
+			return filepath.Join(xdgConfigHome, "nvim", "colors"), nil
+		}
+		return filepath.Join(home, ".config", "nvim", "colors"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for Neovim target: %s", runtime.GOOS)
+	}
+}
+
+func resolveVimColorsDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(home, "vimfiles", "colors"), nil
+	case "darwin", "linux":
+		return filepath.Join(home, ".vim", "colors"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for Vim target: %s", runtime.GOOS)
+	}
+}
+
+func resolveHelixThemeDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if appData, ok := os.LookupEnv("APPDATA"); ok && strings.TrimSpace(appData) != "" {
+			return filepath.Join(appData, "helix", "themes"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "helix", "themes"), nil
+	case "darwin", "linux":
+		if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && strings.TrimSpace(xdgConfigHome) != "" {
+			return filepath.Join(xdgConfigHome, "helix", "themes"), nil
+		}
+		return filepath.Join(home, ".config", "helix", "themes"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for Helix target: %s", runtime.GOOS)
+	}
+}
+
+func resolveSublimeUserPackageDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if appData, ok := os.LookupEnv("APPDATA"); ok && strings.TrimSpace(appData) != "" {
+			return filepath.Join(appData, "Sublime Text", "Packages", "User"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "Sublime Text", "Packages", "User"), nil
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "Sublime Text", "Packages", "User"), nil
+	case "linux":
+		if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && strings.TrimSpace(xdgConfigHome) != "" {
+			return filepath.Join(xdgConfigHome, "sublime-text", "Packages", "User"), nil
+		}
+		return filepath.Join(home, ".config", "sublime-text", "Packages", "User"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for Sublime Text target: %s", runtime.GOOS)
+	}
+}
+
+// saveThemeToEmacs installs a generated deftheme file as <symbol>-theme.el.
+// The themes directory still has to be on custom-theme-load-path.
+func saveThemeToEmacs(themeSource string) (string, error) {
+	match := emacsDeftheme.FindStringSubmatch(themeSource)
+	if match == nil {
+		return "", errors.New("Emacs target expects a -theme.el file with a deftheme form")
+	}
+
+	targetDirectory, err := resolveEmacsThemesDirectory()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(targetDirectory, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create Emacs theme directory: %w", err)
+	}
+
+	filePath := filepath.Join(targetDirectory, match[1]+"-theme.el")
+	if err := os.WriteFile(filePath, []byte(themeSource), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write Emacs theme file: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// resolveEmacsThemesDirectory follows Emacs' own init directory lookup:
+// ~/.emacs.d when it exists, otherwise $XDG_CONFIG_HOME/emacs.
+func resolveEmacsThemesDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if emacsHome, ok := os.LookupEnv("HOME"); ok && strings.TrimSpace(emacsHome) != "" {
+			return filepath.Join(emacsHome, ".emacs.d", "themes"), nil
+		}
+		if appData, ok := os.LookupEnv("APPDATA"); ok && strings.TrimSpace(appData) != "" {
+			return filepath.Join(appData, ".emacs.d", "themes"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", ".emacs.d", "themes"), nil
+	case "darwin", "linux":
+		if info, err := os.Stat(filepath.Join(home, ".emacs.d")); err == nil && info.IsDir() {
+			return filepath.Join(home, ".emacs.d", "themes"), nil
+		}
+		if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && strings.TrimSpace(xdgConfigHome) != "" {
+			return filepath.Join(xdgConfigHome, "emacs", "themes"), nil
+		}
+		return filepath.Join(home, ".config", "emacs", "themes"), nil
+	default:
+		return "", fmt.Errorf("unsupported OS for Emacs target: %s", runtime.GOOS)
+	}
+}
+
+// resolveXDGDirectory joins elem onto the XDG base directory named by envName,
+// falling back to fallback under the home directory when it is unset. The
+// desktop-environment targets only exist on Linux and macOS.
+func resolveXDGDirectory(targetName string, envName string, fallback []string, elem ...string) (string, error) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return "", fmt.Errorf("unsupported OS for %s target: %s", targetName, runtime.GOOS)
+	}
+
+	if base, ok := os.LookupEnv(envName); ok && strings.TrimSpace(base) != "" {
+		return filepath.Join(append([]string{base}, elem...)...), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+	return filepath.Join(append(append([]string{home}, fallback...), elem...)...), nil
+}
+
+func resolveKDEColorSchemesDirectory() (string, error) {
+	return resolveXDGDirectory("KDE", "XDG_DATA_HOME", []string{".local", "share"}, "color-schemes")
+}
+
+// resolveTintedSchemesDirectory is tinty's custom scheme directory for
+// system, which is base16 or base24.
+func resolveTintedSchemesDirectory(system string) (string, error) {
+	return resolveXDGDirectory(system, "XDG_DATA_HOME", []string{".local", "share"}, "tinted-theming", "tinty", "custom-schemes", system)
+}
+
+// saveGTKStylesheet writes the color overrides to themesmith-colors.css for
+// both GTK 3 and GTK 4 and imports it from each gtk.css, leaving the rest of
+// the user's gtk.css alone.
+func saveGTKStylesheet(stylesheet string) (string, error) {
+	if !strings.Contains(stylesheet, "@define-color") {
+		return "", errors.New("GTK target expects a gtk.css stylesheet with @define-color rules")
+	}
+
+	var written []string
+	for _, version := range []string{"gtk-3.0", "gtk-4.0"} {
+		directory, err := resolveXDGDirectory("GTK", "XDG_CONFIG_HOME", []string{".config"}, version)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(directory, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create %s directory: %w", version, err)
+		}
+
+		colorsPath := filepath.Join(directory, "themesmith-colors.css")
+		if err := os.WriteFile(colorsPath, []byte(stylesheet), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write %s colors: %w", version, err)
+		}
+		if err := ensureFileIncludes(filepath.Join(directory, "gtk.css"), `@import url("themesmith-colors.css");`, true); err != nil {
+			return "", fmt.Errorf("failed to update %s gtk.css: %w", version, err)
+		}
+		written = append(written, colorsPath)
+	}
+
+	return strings.Join(written, "\n"), nil
+}
+
+// saveXresources writes the resources to $XDG_CONFIG_HOME/X11 and includes
+// them from ~/.Xresources, which xrdb loads at login.
+func saveXresources(resources string) (string, error) {
+	directory, err := resolveXDGDirectory("Xresources", "XDG_CONFIG_HOME", []string{".config"}, "X11")
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve user home directory: %w", err)
+	}
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create X11 config directory: %w", err)
+	}
+
+	filePath := filepath.Join(directory, "themesmith.Xresources")
+	if err := os.WriteFile(filePath, []byte(resources), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write Xresources: %w", err)
+	}
+	if err := ensureFileIncludes(filepath.Join(home, ".Xresources"), fmt.Sprintf("#include %q", filePath), false); err != nil {
+		return "", fmt.Errorf("failed to update ~/.Xresources: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// savePywalColorscheme installs a colors.json as a named pywal theme, under
+// colorschemes/dark or colorschemes/light by its background, for
+// wal --theme <name>.
+func savePywalColorscheme(themeName string, colorsJSON string) (string, error) {
+	var colors struct {
+		Special map[string]string `json:"special"`
+		Colors  map[string]string `json:"colors"`
+	}
+	if err := json.Unmarshal([]byte(colorsJSON), &colors); err != nil {
+		return "", fmt.Errorf("invalid pywal colors JSON: %w", err)
+	}
+	if colors.Special["background"] == "" || len(colors.Colors) == 0 {
+		return "", errors.New("pywal colors JSON needs special.background and colors")
+	}
+
+	variant := "dark"
+	if isLightHexColor(colors.Special["background"]) {
+		variant = "light"
+	}
+	return saveThemeFile("pywal", func() (string, error) {
+		return resolveXDGDirectory("pywal", "XDG_CONFIG_HOME", []string{".config"}, "wal", "colorschemes", variant)
+	}, themeName, ".json", string(prettyJSON(colorsJSON, "    ")))
+}
+
+// ensureFileIncludes adds line to the file at path unless it is already
+// there, creating the file if needed. prepend puts it first, as CSS requires
+// of @import.
+func ensureFileIncludes(path string, line string, prepend bool) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, current := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(current) == line {
+			return nil
+		}
+	}
+
+	content := string(existing)
+	switch {
+	case content == "":
+		content = line + "\n"
+	case prepend:
+		content = line + "\n" + content
+	default:
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += line + "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// isLightHexColor reports whether a #rrggbb color is light, using the Rec. 709
+// luma of its gamma-encoded channels with a midpoint threshold.
+func isLightHexColor(hex string) bool {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) < 6 {
+		return false
+	}
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex[:6], "%02x%02x%02x", &r, &g, &b); err != nil {
+		return false
+	}
+	return 0.2126*float64(r)+0.7152*float64(g)+0.0722*float64(b) > 127.5
+}
+
 func updateVSCodePackageJSON(extensionDirectory string, themeLabel string, themeFileName string, uiTheme string) error {
 	packagePath := filepath.Join(extensionDirectory, "package.json")
 
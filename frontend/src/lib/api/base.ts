@@ -26,11 +26,27 @@ export function buildZigURL(path: string, params?: Record<string, QueryParamValu
 	return url.toString();
 }
 
+// ApiError is thrown for non-2xx responses. It keeps the status and the
+// decoded body so callers can act on error payloads such as the server copy
+// returned with a 412.
+export class ApiError extends Error {
+	readonly status: number;
+	readonly body: unknown;
+
+	constructor(message: string, status: number, body: unknown) {
+		super(message);
+		this.name = 'ApiError';
+		this.status = status;
+		this.body = body;
+	}
+}
+
 export async function ensureOk(res: Response): Promise<Response> {
 	if (!res.ok) {
 		let msg = `HTTP ${res.status}`;
+		let data: unknown = null;
 		try {
-			const data = await res.json().catch(() => null);
+			data = await res.json().catch(() => null);
 			if (data && typeof data === 'object') {
 				const obj = data as { error?: string; message?: string };
 				if (typeof obj.error === 'string') {
@@ -42,7 +58,7 @@ export async function ensureOk(res: Response): Promise<Response> {
 		} catch {
 			// ignore JSON parse errors
 		}
-		throw new Error(msg);
+		throw new ApiError(msg, res.status, data);
 	}
 	return res;
 }
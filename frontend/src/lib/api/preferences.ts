@@ -1,12 +1,25 @@
-import { buildURL, ensureOk } from './base';
+import { ApiError, buildURL, ensureOk } from './base';
 import { getAuthHeaders } from './auth';
 
 export type PreferencesPayload = Record<string, unknown>;
 
 export type PreferencesResponse<T = PreferencesPayload> = {
 	preferences: T | null;
+	version?: number;
 };
 
+// The server only accepts a save that names the version it last returned, so
+// remember it from every response. A save that names no version or an old one
+// throws an ApiError whose body holds the server copy; callers apply it before
+// saving again, and that save names its version.
+let preferencesVersion: number | undefined;
+
+function rememberVersion(body: { version?: number } | null) {
+	if (typeof body?.version === 'number') {
+		preferencesVersion = body.version;
+	}
+}
+
 export async function getPreferences<T = PreferencesPayload>(): Promise<PreferencesResponse<T>> {
 	const response = await fetch(buildURL('/auth/preferences'), {
 		method: 'GET',
@@ -14,16 +27,39 @@ export async function getPreferences<T = PreferencesPayload>(): Promise<Preferen
 	});
 
 	await ensureOk(response);
-	return response.json();
+	const body: PreferencesResponse<T> = await response.json();
+	rememberVersion(body);
+	return body;
 }
 
 export async function savePreferences<T = PreferencesPayload>(preferences: T): Promise<PreferencesResponse<T>> {
+	const headers = getAuthHeaders();
+	if (preferencesVersion !== undefined) {
+		headers['If-Match'] = `"${preferencesVersion}"`;
+	}
 	const response = await fetch(buildURL('/auth/preferences'), {
 		method: 'PUT',
-		headers: getAuthHeaders(),
+		headers,
 		body: JSON.stringify(preferences)
 	});
 
-	await ensureOk(response);
-	return response.json();
+	try {
+		await ensureOk(response);
+	} catch (error) {
+		if (isStalePreferencesError(error)) {
+			rememberVersion(error.body);
+		}
+		throw error;
+	}
+	const body: PreferencesResponse<T> = await response.json();
+	rememberVersion(body);
+	return body;
+}
+
+// isStalePreferencesError reports whether a save was rejected for naming an old
+// version (412) or none at all (428), as happens when preferences are saved
+// before they were ever loaded. Either way the error body carries the server's
+// preferences.
+export function isStalePreferencesError(error: unknown): error is ApiError & { body: PreferencesResponse | null } {
+	return error instanceof ApiError && (error.status === 412 || error.status === 428);
 }
@@ -2,7 +2,7 @@ import type { SavedThemeResponse, SavedThemesBatchResponse, ThemesResponse } fro
 import type { SavedThemeItem } from '$lib/types/theme';
 
 import { getAuthHeaders } from './auth';
-import { buildURL, ensureOk } from './base';
+import { ApiError, buildURL, ensureOk } from './base';
 
 export async function getThemes(): Promise<ThemesResponse<SavedThemeItem>> {
 	const response = await fetch(buildURL('/themes'), {
@@ -37,9 +37,13 @@ export async function saveThemes(themes: SavedThemeItem[]): Promise<SavedThemesB
 }
 
 export async function updateTheme(themeId: string, theme: SavedThemeItem): Promise<SavedThemeResponse<SavedThemeItem>> {
+	const headers = getAuthHeaders();
+	if (theme.version !== undefined) {
+		headers['If-Match'] = `"${theme.version}"`;
+	}
 	const response = await fetch(buildURL(`/themes/${themeId}`), {
 		method: 'PUT',
-		headers: getAuthHeaders(),
+		headers,
 		body: JSON.stringify(theme)
 	});
 
@@ -87,3 +91,15 @@ export async function unshareTheme(themeId: string): Promise<SavedThemeResponse<
 	await ensureOk(response);
 	return response.json();
 }
+
+// isStaleThemeError reports whether an update named an outdated version. The
+// error body carries the current server copy of the theme.
+export function isStaleThemeError(error: unknown): error is ApiError & { body: { theme?: SavedThemeItem } | null } {
+	return error instanceof ApiError && error.status === 412;
+}
+
+// isThemeVersionRequiredError reports whether an update was sent without a
+// version, which happens for themes cached before versions were tracked.
+export function isThemeVersionRequiredError(error: unknown): error is ApiError {
+	return error instanceof ApiError && error.status === 428;
+}
@@ -1,7 +1,20 @@
 import { buildURL, ensureOk } from './base';
 import type { QueryParamValue } from './base';
+import { getAuthHeaders, getAuthToken } from './auth';
 import type { WallhavenSearchResponse, WallhavenSettings } from '$lib/types/wallhaven';
 
+export type WallhavenKeyStatus = {
+	configured: boolean;
+	keyHint?: string;
+	updatedAt?: string;
+};
+
+// Signed-in requests let the API use the Wallhaven key stored on the server.
+function wallhavenHeaders(): Record<string, string> {
+	const token = getAuthToken();
+	return token ? { Authorization: `Bearer ${token}` } : {};
+}
+
 export async function searchWallhaven(
 	settings: WallhavenSettings,
 	query: string,
@@ -23,7 +36,7 @@ export async function searchWallhaven(
 
 	const url = buildURL('/wallhaven/search', params);
 
-	const headers: HeadersInit = {};
+	const headers = wallhavenHeaders();
 	if (settings.apikey) {
 		headers['X-API-Key'] = settings.apikey;
 	}
@@ -34,7 +47,7 @@ export async function searchWallhaven(
 }
 
 export async function getWallpaper(id: string) {
-	const res = await fetch(buildURL(`/wallhaven/w/${encodeURIComponent(id)}`));
+	const res = await fetch(buildURL(`/wallhaven/w/${encodeURIComponent(id)}`), { headers: wallhavenHeaders() });
 	await ensureOk(res);
 	return res.json();
 }
@@ -44,3 +57,43 @@ export async function downloadImage(imageUrl: string): Promise<Blob> {
 	await ensureOk(res);
 	return res.blob();
 }
+
+export function thumbnailURL(thumbUrl: string): string {
+	return buildURL('/wallhaven/thumbnail', { url: thumbUrl });
+}
+
+export async function getWallhavenKeyStatus(): Promise<WallhavenKeyStatus> {
+	const res = await fetch(buildURL('/auth/wallhaven-key'), { headers: getAuthHeaders() });
+	await ensureOk(res);
+	return res.json();
+}
+
+export async function saveWallhavenKey(apiKey: string): Promise<WallhavenKeyStatus> {
+	const res = await fetch(buildURL('/auth/wallhaven-key'), {
+		method: 'PUT',
+		headers: getAuthHeaders(),
+		body: JSON.stringify({ apiKey })
+	});
+	await ensureOk(res);
+	return res.json();
+}
+
+export async function testWallhavenKey(apiKey?: string): Promise<boolean> {
+	const res = await fetch(buildURL('/auth/wallhaven-key/test'), {
+		method: 'POST',
+		headers: getAuthHeaders(),
+		body: apiKey ? JSON.stringify({ apiKey }) : undefined
+	});
+	await ensureOk(res);
+	const data = (await res.json()) as { valid: boolean };
+	return data.valid;
+}
+
+export async function clearWallhavenKey(): Promise<WallhavenKeyStatus> {
+	const res = await fetch(buildURL('/auth/wallhaven-key'), {
+		method: 'DELETE',
+		headers: getAuthHeaders()
+	});
+	await ensureOk(res);
+	return res.json();
+}
@@ -9,7 +9,8 @@ import { searchWallhaven } from '$lib/api/wallhaven';
 import { SEARCH_DEBOUNCE_MS } from './search';
 
 vi.mock('$lib/api/wallhaven', () => ({
-	searchWallhaven: vi.fn()
+	searchWallhaven: vi.fn(),
+	thumbnailURL: (url: string) => url
 }));
 
 vi.mock('svelte-french-toast', () => ({
@@ -23,12 +23,14 @@ function buildSavedTheme({
 	id,
 	name,
 	editorType,
-	themeResult
+	themeResult,
+	version
 }: {
 	id?: string;
 	name: string;
 	editorType: EditorThemeType;
 	themeResult: ThemeGenerationResponse;
+	version?: number;
 }): SavedThemeItem {
 	return {
 		id: id ?? `local_${Date.now()}`,
@@ -36,7 +38,8 @@ function buildSavedTheme({
 		editorType,
 		themeResult,
 		createdAt: new Date().toISOString(),
-		signature: appStore.getThemeSignature(themeResult)
+		signature: appStore.getThemeSignature(themeResult),
+		version
 	};
 }
 
@@ -71,7 +74,8 @@ export async function saveTheme({ name, editorType, themeResult }: SaveThemeArgs
 				id: nameMatch.id,
 				name: trimmedName,
 				editorType,
-				themeResult
+				themeResult,
+				version: nameMatch.version
 			});
 			appStore.replaceSavedTheme(nameMatch.id, saved);
 			return;
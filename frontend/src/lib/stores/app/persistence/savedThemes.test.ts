@@ -32,7 +32,8 @@ describe('savedThemes storage helpers', () => {
 				colors: [{ hex: '#101010' }, { hex: 42 }],
 				boostCoefficient: 1
 			},
-			signature: 'sig-1'
+			signature: 'sig-1',
+			version: 7
 		};
 
 		const invalid = {
@@ -49,6 +50,7 @@ describe('savedThemes storage helpers', () => {
 		expect(loaded).toHaveLength(1);
 		expect(loaded[0].id).toBe('theme-1');
 		expect(loaded[0].signature).toBe('sig-1');
+		expect(loaded[0].version).toBe(7);
 		expect(loaded[0].themeResult.colors).toEqual([{ hex: '#101010' }]);
 	});
 
@@ -94,7 +96,8 @@ describe('savedThemes storage helpers', () => {
 						colors: [{ hex: '#ABCDEF' }, { hex: 12 }],
 						boostCoefficient: 'invalid'
 					},
-					signature: 123
+					signature: 123,
+					version: '3'
 				}
 			])
 		);
@@ -110,5 +113,6 @@ describe('savedThemes storage helpers', () => {
 			}
 		});
 		expect(entry.signature).toBeUndefined();
+		expect(entry.version).toBeUndefined();
 	});
 });
@@ -42,7 +42,8 @@ function normalizeSavedThemeItem(value: unknown): SavedThemeItem | null {
 			boostCoefficient
 		},
 		createdAt,
-		signature: typeof value.signature === 'string' ? value.signature : undefined
+		signature: typeof value.signature === 'string' ? value.signature : undefined,
+		version: typeof value.version === 'number' ? value.version : undefined
 	};
 }
 
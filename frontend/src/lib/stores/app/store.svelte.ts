@@ -447,10 +447,47 @@ function createAppStore() {
 					await themesApi.deleteTheme(themeId);
 				}
 			} catch (error) {
+				if (action === 'update' && preparedTheme && themeId) {
+					if (themesApi.isStaleThemeError(error) && error.body?.theme) {
+						await this.resolveThemeConflict(themeId, preparedTheme, error.body.theme);
+						return;
+					}
+					if (themesApi.isThemeVersionRequiredError(error)) {
+						toast.error('Your saved themes were out of date and have been reloaded. Please save the theme again.');
+						await this.loadSavedThemesFromApi();
+						return;
+					}
+				}
 				console.error('Failed to sync theme change:', error);
 			}
 		},
 
+		// resolveThemeConflict runs when another device updated a theme after we
+		// last loaded it. The user either keeps the server copy or overwrites it
+		// with the local change, which is retried against the server's version.
+		async resolveThemeConflict(themeId: string, localTheme: SavedThemeItem, serverTheme: SavedThemeItem) {
+			const overwrite = await dialogStore.confirm({
+				title: 'Theme changed on another device',
+				message: `"${serverTheme.name}" was updated elsewhere since you loaded it. Overwrite it with your version?`,
+				confirmLabel: 'Overwrite',
+				cancelLabel: 'Keep other version',
+				variant: 'danger'
+			});
+			if (!overwrite) {
+				this.applyThemeResponse(serverTheme, themeId);
+				return;
+			}
+
+			try {
+				const response = await themesApi.updateTheme(themeId, { ...localTheme, version: serverTheme.version });
+				this.applyThemeResponse(response.theme, themeId);
+			} catch (error) {
+				console.error('Failed to overwrite theme:', error);
+				this.applyThemeResponse(serverTheme, themeId);
+				toast.error('Could not save the theme. The latest version has been loaded.');
+			}
+		},
+
 		async syncSavedThemesOnAuth() {
 			if (!browser) return;
 
@@ -595,6 +632,13 @@ function createAppStore() {
 					await preferencesApi.savePreferences(this.buildPreferences());
 					localStorage.removeItem('appPreferences');
 				} catch (error) {
+					if (preferencesApi.isStalePreferencesError(error)) {
+						// The server holds preferences we have not seen. Take them rather
+						// than overwriting them; the next change saves on top of that copy.
+						this.applyPreferences(toPreferencesPayload(error.body?.preferences));
+						localStorage.removeItem('appPreferences');
+						return;
+					}
 					console.error('Failed to persist preferences:', error);
 				}
 			}, 300);
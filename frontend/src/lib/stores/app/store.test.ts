@@ -51,18 +51,27 @@ vi.mock('$lib/api/theme', () => ({
 	generateOverridable: vi.fn()
 }));
 
-vi.mock('$lib/api/preferences', () => ({
-	getPreferences: vi.fn(),
-	savePreferences: vi.fn()
-}));
+vi.mock('$lib/api/preferences', async () => {
+	const actual = await vi.importActual<typeof import('$lib/api/preferences')>('$lib/api/preferences');
+	return {
+		getPreferences: vi.fn(),
+		savePreferences: vi.fn(),
+		isStalePreferencesError: actual.isStalePreferencesError
+	};
+});
 
-vi.mock('$lib/api/savedThemes', () => ({
-	getThemes: vi.fn(),
-	saveTheme: vi.fn(),
-	saveThemes: vi.fn(),
-	updateTheme: vi.fn(),
-	deleteTheme: vi.fn()
-}));
+vi.mock('$lib/api/savedThemes', async () => {
+	const actual = await vi.importActual<typeof import('$lib/api/savedThemes')>('$lib/api/savedThemes');
+	return {
+		getThemes: vi.fn(),
+		saveTheme: vi.fn(),
+		saveThemes: vi.fn(),
+		updateTheme: vi.fn(),
+		deleteTheme: vi.fn(),
+		isStaleThemeError: actual.isStaleThemeError,
+		isThemeVersionRequiredError: actual.isThemeVersionRequiredError
+	};
+});
 
 vi.mock('$lib/api/wallhaven', () => ({
 	downloadImage: vi.fn()
@@ -76,6 +85,7 @@ vi.mock('svelte-french-toast', () => ({
 	}
 }));
 
+import { ApiError } from '$lib/api/base';
 import * as paletteApi from '$lib/api/palette';
 import * as preferencesApi from '$lib/api/preferences';
 import * as themeApi from '$lib/api/theme';
@@ -390,6 +400,43 @@ describe('appStore', () => {
 			expect(localStorage.getItem('appPreferences')).toBeNull();
 		});
 
+		it('applies the server copy instead of resaving after a stale preferences save', async () => {
+			vi.useFakeTimers();
+			authStoreMock.state.isAuthenticated = true;
+			vi.mocked(preferencesApi.savePreferences).mockRejectedValue(
+				new ApiError('the resource was modified since it was read', 412, {
+					version: 4,
+					preferences: { themeExport: { appearance: 'light' } }
+				})
+			);
+
+			appStore.state.themeExport.appearance = 'dark';
+			appStore.persistPreferencesLocal();
+			await vi.advanceTimersByTimeAsync(301);
+
+			expect(preferencesApi.savePreferences).toHaveBeenCalledTimes(1);
+			expect(appStore.state.themeExport.appearance).toBe('light');
+			expect(localStorage.getItem('appPreferences')).toBeNull();
+		});
+
+		it('applies the server copy when preferences are saved before they were loaded', async () => {
+			vi.useFakeTimers();
+			authStoreMock.state.isAuthenticated = true;
+			vi.mocked(preferencesApi.savePreferences).mockRejectedValue(
+				new ApiError('If-Match header is required', 428, {
+					version: 2,
+					preferences: { themeExport: { saveOnCopy: true } }
+				})
+			);
+
+			appStore.state.themeExport.saveOnCopy = false;
+			appStore.persistPreferencesLocal();
+			await vi.advanceTimersByTimeAsync(301);
+
+			expect(appStore.state.themeExport.saveOnCopy).toBe(true);
+			expect(localStorage.getItem('appPreferences')).toBeNull();
+		});
+
 		it('prefers remote non-default preferences over local cache', async () => {
 			authStoreMock.state.isAuthenticated = true;
 			vi.mocked(preferencesApi.getPreferences).mockResolvedValue({
@@ -732,6 +779,60 @@ describe('appStore', () => {
 			expect(appStore.state.savedThemes).toEqual([]);
 		});
 
+		it('keeps the server copy of a theme changed on another device', async () => {
+			authStoreMock.state.isAuthenticated = true;
+			const local = { ...makeTheme('theme-1', 'Local'), version: 2 };
+			const server = { ...makeTheme('theme-1', 'Server'), version: 3 };
+			appStore.state.savedThemes = [local];
+			dialogStoreMock.confirm.mockResolvedValue(false);
+			vi.mocked(themesApi.updateTheme).mockRejectedValue(
+				new ApiError('the resource was modified since it was read', 412, { version: 3, theme: server })
+			);
+
+			await appStore.persistThemeChange(local, 'update', 'theme-1');
+
+			expect(dialogStoreMock.confirm).toHaveBeenCalledTimes(1);
+			expect(themesApi.updateTheme).toHaveBeenCalledTimes(1);
+			expect(appStore.state.savedThemes).toHaveLength(1);
+			expect(appStore.state.savedThemes[0]).toMatchObject({ id: 'theme-1', name: 'Server', version: 3 });
+		});
+
+		it('overwrites a theme changed on another device when the user confirms', async () => {
+			authStoreMock.state.isAuthenticated = true;
+			const local = { ...makeTheme('theme-1', 'Local'), version: 2 };
+			const server = { ...makeTheme('theme-1', 'Server'), version: 3 };
+			appStore.state.savedThemes = [local];
+			dialogStoreMock.confirm.mockResolvedValue(true);
+			vi.mocked(themesApi.updateTheme)
+				.mockRejectedValueOnce(
+					new ApiError('the resource was modified since it was read', 412, { version: 3, theme: server })
+				)
+				.mockResolvedValueOnce({ message: 'ok', theme: { ...makeTheme('theme-1', 'Local'), version: 4 } });
+
+			await appStore.persistThemeChange(local, 'update', 'theme-1');
+
+			expect(themesApi.updateTheme).toHaveBeenCalledTimes(2);
+			expect(themesApi.updateTheme).toHaveBeenLastCalledWith(
+				'theme-1',
+				expect.objectContaining({ name: 'Local', version: 3 })
+			);
+			expect(appStore.state.savedThemes[0]).toMatchObject({ id: 'theme-1', name: 'Local', version: 4 });
+		});
+
+		it('reloads themes when an update is sent without a version', async () => {
+			authStoreMock.state.isAuthenticated = true;
+			vi.mocked(themesApi.updateTheme).mockRejectedValue(new ApiError('If-Match header is required', 428, null));
+			vi.mocked(themesApi.getThemes).mockResolvedValue({
+				themes: [{ ...makeTheme('theme-1', 'Server'), version: 3 }]
+			});
+
+			await appStore.persistThemeChange(makeTheme('theme-1', 'Local'), 'update', 'theme-1');
+
+			expect(themesApi.getThemes).toHaveBeenCalledTimes(1);
+			expect(toast.error).toHaveBeenCalled();
+			expect(appStore.state.savedThemes).toEqual([expect.objectContaining({ id: 'theme-1', version: 3 })]);
+		});
+
 		it('keeps execution safe when remote theme sync throws', async () => {
 			authStoreMock.state.isAuthenticated = true;
 			vi.spyOn(console, 'error').mockImplementation(() => {});
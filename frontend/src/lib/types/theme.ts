@@ -62,6 +62,7 @@ export type SavedThemeItem = {
 	signature?: string;
 	isShared?: boolean;
 	sharedAt?: string | null;
+	version?: number;
 };
 
 export const DEFAULT_THEME_EXPORT_PREFERENCES: ThemeExportPreferences = {